@@ -0,0 +1,171 @@
+package headless
+
+import (
+	"fmt"
+	adapter "gui/adapters"
+	"gui/element"
+	"image"
+	ic "image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Headless is a software rasterizer, every frame is composited into an image.RGBA instead of a window
+// + so grim can run on machines without a GPU (CI, golden image tests)
+type Headless struct {
+	Adapter    *adapter.Adapter
+	Width      int
+	Height     int
+	Background ic.RGBA
+	// OutputDir when set writes every frame as a PNG (frame-00001.png, frame-00002.png, ...)
+	OutputDir string
+	// Err is the first error writing a frame to OutputDir, no more frames are written after it
+	Err error
+	// MaxFrames dispatches a close event after n frames, 0 renders until the loop is stopped
+	MaxFrames int
+	Frames    int
+	Textures  map[string]*image.RGBA
+	frame     *image.RGBA
+}
+
+func Init() *Headless {
+	a := adapter.Adapter{}
+	a.Options = adapter.Options{
+		RenderText:     true,
+		RenderElements: true,
+		RenderBorders:  true,
+	}
+
+	h := &Headless{
+		Adapter:  &a,
+		Textures: map[string]*image.RGBA{},
+	}
+
+	a.Init = func(width, height int) {
+		h.Background = a.Settings.Background
+		h.Width = width
+		h.Height = height
+		h.frame = image.NewRGBA(image.Rect(0, 0, width, height))
+		a.Library.UnloadCallback = func(key string) {
+			delete(h.Textures, key)
+		}
+		// Let gui know if the requested size is out of the min/max bounds
+		h.Resize(width, height)
+	}
+	a.Load = h.LoadTextures
+	a.Render = func(state []element.State) {
+		h.Draw(state)
+		h.Frames++
+		if h.OutputDir != "" && h.Err == nil {
+			path := filepath.Join(h.OutputDir, fmt.Sprintf("frame-%05d.png", h.Frames))
+			h.Err = h.SavePNG(path)
+		}
+		if h.MaxFrames > 0 && h.Frames >= h.MaxFrames {
+			a.DispatchEvent(element.Event{Name: "close"})
+		}
+	}
+	return h
+}
+
+// Frame returns the last composited frame
+func (h *Headless) Frame() *image.RGBA {
+	return h.frame
+}
+
+// Resize changes the size of the next frame and lets gui know the same way a window would
+func (h *Headless) Resize(width, height int) {
+	width, height = h.clamp(width, height)
+	if width == h.Width && height == h.Height {
+		return
+	}
+	h.Width = width
+	h.Height = height
+	h.Adapter.DispatchEvent(element.Event{
+		Name: "windowresize",
+		Data: map[string]int{"width": width, "height": height},
+	})
+}
+
+// clamp keeps the size within the min/max dimensions of the adapter settings
+func (h *Headless) clamp(width, height int) (int, int) {
+	s := h.Adapter.Settings
+	if s.MinWidth > 0 && width < s.MinWidth {
+		width = s.MinWidth
+	}
+	if s.MinHeight > 0 && height < s.MinHeight {
+		height = s.MinHeight
+	}
+	if s.MaxWidth > 0 && width > s.MaxWidth {
+		width = s.MaxWidth
+	}
+	if s.MaxHeight > 0 && height > s.MaxHeight {
+		height = s.MaxHeight
+	}
+	return width, height
+}
+
+func (h *Headless) SavePNG(path string) error {
+	if h.frame == nil {
+		return fmt.Errorf("headless: no frame has been rendered")
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return png.Encode(f, h.frame)
+}
+
+// LoadTextures keeps a reference to every texture used by the state so it can still be drawn
+// + if the library is cleaned before the next render
+func (h *Headless) LoadTextures(nodes []element.State) {
+	for _, node := range nodes {
+		for _, key := range node.Textures {
+			texture, inLibrary := h.Adapter.Library.Get(key)
+			if inLibrary {
+				h.Textures[key] = texture
+			} else {
+				delete(h.Textures, key)
+			}
+		}
+	}
+}
+
+// Draw composites all nodes into the frame from the lowest Z index to the highest
+func (h *Headless) Draw(nodes []element.State) {
+	if h.frame == nil || h.frame.Bounds().Dx() != h.Width || h.frame.Bounds().Dy() != h.Height {
+		h.frame = image.NewRGBA(image.Rect(0, 0, h.Width, h.Height))
+	}
+	draw.Draw(h.frame, h.frame.Bounds(), &image.Uniform{h.Background}, image.Point{}, draw.Src)
+
+	order := make([]int, len(nodes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return nodes[order[i]].Z < nodes[order[j]].Z
+	})
+
+	for _, i := range order {
+		node := nodes[i]
+		if node.Hidden {
+			continue
+		}
+		for _, v := range node.Textures {
+			texture, exists := h.Textures[v]
+			if !exists {
+				continue
+			}
+			source := texture.Bounds()
+			if node.Crop.X != 0 || node.Crop.Y != 0 || node.Crop.Width != 0 || node.Crop.Height != 0 {
+				source = image.Rect(node.Crop.X, node.Crop.Y, node.Crop.X+node.Crop.Width, node.Crop.Y+node.Crop.Height).Intersect(texture.Bounds())
+			}
+			x, y := int(node.X), int(node.Y)+node.Crop.Y
+			dst := image.Rect(x, y, x+source.Dx(), y+source.Dy())
+			draw.Draw(h.frame, dst, texture, source.Min, draw.Over)
+		}
+	}
+}
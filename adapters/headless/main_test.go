@@ -0,0 +1,86 @@
+package headless
+
+import (
+	"flag"
+	"gui"
+	"gui/library"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOutputDirError(t *testing.T) {
+	h := Init()
+	h.Adapter.Library = &library.Shelf{}
+	h.Adapter.Init(10, 10)
+	h.OutputDir = filepath.Join(t.TempDir(), "missing")
+
+	h.Adapter.Render(nil)
+	if h.Err == nil {
+		t.Fatal("writing to a missing directory didn't set Err")
+	}
+	h.Adapter.Render(nil)
+	if h.Frames != 2 {
+		t.Fatalf("Frames = %d, want 2", h.Frames)
+	}
+}
+
+var update = flag.Bool("update", false, "write the golden images again")
+
+// TestGolden renders the pages in testdata and compares them pixel by pixel with their .png, the pages don't use
+// + text as it depends on the fonts of the system
+func TestGolden(t *testing.T) {
+	pages, err := filepath.Glob("testdata/*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, page := range pages {
+		h := Init()
+		w, err := gui.Open(page, h.Adapter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := gui.NewRuntime(&w, 200, 150)
+		r.Step()
+		r.Close()
+
+		golden := strings.TrimSuffix(page, ".html") + ".png"
+		if *update {
+			if err := h.SavePNG(golden); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		f, err := os.Open(golden)
+		if err != nil {
+			t.Fatalf("%v, run the test with -update to make it", err)
+		}
+		want, err := png.Decode(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := h.Frame()
+		if got.Bounds() != want.Bounds() {
+			t.Errorf("%s: the frame is %v, want %v", page, got.Bounds(), want.Bounds())
+			continue
+		}
+		diff := 0
+		for y := got.Bounds().Min.Y; y < got.Bounds().Max.Y; y++ {
+			for x := got.Bounds().Min.X; x < got.Bounds().Max.X; x++ {
+				if color.RGBAModel.Convert(want.At(x, y)) != got.RGBAAt(x, y) {
+					diff++
+				}
+			}
+		}
+		if diff > 0 {
+			path := filepath.Join(t.TempDir(), filepath.Base(golden))
+			h.SavePNG(path)
+			t.Errorf("%s: %d pixels are different from %s, the frame is in %s", page, diff, golden, path)
+		}
+	}
+}
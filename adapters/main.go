@@ -3,20 +3,34 @@ package adapter
 import (
 	"gui/element"
 	"gui/library"
+	ic "image/color"
 )
 
-// !TODO: For things like fonts the file system interaction works fine, but if you want to run grim on a pi pico it doesn't have the file system int like
-// + computers have
-// + Option 1: make a file system adapter where authors can control how data is read
-// + Option 2: at build time fetch all files needed and bundle them
+// !NOTE: Documents and the files they link to can be bundled into the binary with gui.OpenFS (ex: embed.FS) for devices
+// + without a file system. System fonts are still loaded from disk
 
 type Adapter struct {
-	Init    func(width int, height int)
-	Render  func(state []element.State)
-	Load    func(state []element.State)
-	events  map[string][]func(element.Event)
-	Library *library.Shelf
-	Options Options
+	Init   func(width int, height int)
+	Render func(state []element.State)
+	Load   func(state []element.State)
+	// Close is optional, it is called once the main loop has stopped
+	Close    func()
+	events   map[string][]func(element.Event)
+	Library  *library.Shelf
+	Options  Options
+	Settings Settings
+}
+
+// Settings are set by gui before Init is called, adapters should honor the ones they can
+type Settings struct {
+	Title      string
+	FPS        int
+	Resizable  bool
+	MinWidth   int
+	MinHeight  int
+	MaxWidth   int
+	MaxHeight  int
+	Background ic.RGBA
 }
 
 type Options struct {
@@ -58,6 +58,7 @@ func Init() *adapter.Adapter {
 		}
 		wm.Draw(state)
 	}
+	a.Close = rl.CloseWindow
 	return &a
 }
 
@@ -88,12 +89,25 @@ func NewWindowManager(a *adapter.Adapter) *WindowManager {
 
 // OpenWindow opens the window
 func (wm *WindowManager) OpenWindow(width, height int32) {
-	rl.InitWindow(width, height, "")
-	rl.SetTargetFPS(120)
+	settings := wm.Adapter.Settings
+	rl.InitWindow(width, height, settings.Title)
+	fps := settings.FPS
+	if fps == 0 {
+		fps = 120
+	}
+	wm.SetFPS(fps)
 	wm.Width = width
 	wm.Height = height
-	// Enable window resizing
-	rl.SetWindowState(rl.FlagWindowResizable)
+	if settings.Resizable {
+		// Enable window resizing
+		rl.SetWindowState(rl.FlagWindowResizable)
+	}
+	if settings.MinWidth > 0 || settings.MinHeight > 0 {
+		rl.SetWindowMinSize(settings.MinWidth, settings.MinHeight)
+	}
+	if settings.MaxWidth > 0 || settings.MaxHeight > 0 {
+		rl.SetWindowMaxSize(settings.MaxWidth, settings.MaxHeight)
+	}
 }
 
 func (wm *WindowManager) SetFPS(fps int) {
@@ -139,6 +153,7 @@ func (wm *WindowManager) LoadTextures(nodes []element.State) {
 func (wm *WindowManager) Draw(nodes []element.State) {
 	indexes := []float32{0}
 	rl.BeginDrawing()
+	rl.ClearBackground(wm.Adapter.Settings.Background)
 	wm.GetEvents()
 	for a := 0; a < len(indexes); a++ {
 		for _, node := range nodes {
@@ -113,26 +113,6 @@ func Parse(cssProperties map[string]string, self, parent element.State) (element
 	bottomParsedColor := color.Color(bottomColor)
 	leftParsedColor := color.Color(leftColor)
 
-	width := self.Width + self.Border.Left.Width + self.Border.Right.Width
-	height := self.Height + self.Border.Top.Width + self.Border.Bottom.Width
-
-	if topLeftRadius+topRightRadius > width {
-		topLeftRadius = width / 2
-		topRightRadius = width / 2
-	}
-	if bottomLeftRadius+bottomRightRadius > width {
-		bottomLeftRadius = width / 2
-		bottomRightRadius = width / 2
-	}
-	if topLeftRadius+bottomLeftRadius > height {
-		topLeftRadius = height / 2
-		bottomLeftRadius = height / 2
-	}
-	if topRightRadius+bottomRightRadius > height {
-		topRightRadius = height / 2
-		bottomRightRadius = height / 2
-	}
-
 	return element.Border{
 		Top: element.BorderSide{
 			Width: topWidthPx,
@@ -163,6 +143,31 @@ func Parse(cssProperties map[string]string, self, parent element.State) (element
 	}, nil
 }
 
+// Fit shrinks the radii that don't fit in the border box of n, it runs on the final size as plugins can still resize
+// + a node after its border has been parsed
+func Fit(n *element.State) {
+	r := &n.Border.Radius
+	width := n.Width + n.Border.Left.Width + n.Border.Right.Width
+	height := n.Height + n.Border.Top.Width + n.Border.Bottom.Width
+
+	if r.TopLeft+r.TopRight > width {
+		r.TopLeft = width / 2
+		r.TopRight = width / 2
+	}
+	if r.BottomLeft+r.BottomRight > width {
+		r.BottomLeft = width / 2
+		r.BottomRight = width / 2
+	}
+	if r.TopLeft+r.BottomLeft > height {
+		r.TopLeft = height / 2
+		r.BottomLeft = height / 2
+	}
+	if r.TopRight+r.BottomRight > height {
+		r.TopRight = height / 2
+		r.BottomRight = height / 2
+	}
+}
+
 func Draw(n *element.State, shelf *library.Shelf) {
 	// lastChange := time.Now()
 	if n.Border.Top.Width > 0 ||
@@ -3,6 +3,7 @@ package color
 import (
 	"fmt"
 	ic "image/color"
+	"math"
 	"strconv"
 	"strings"
 )
@@ -375,6 +376,19 @@ var namedColors = map[string]ic.RGBA{
 	"yellowgreen":          {154, 205, 50, 255},
 }
 
+// Format writes c the way computed styles show colors, rgb(r, g, b) or rgba(r, g, b, a) when it isn't opaque
+func Format(c ic.RGBA) string {
+	if c.A == 255 {
+		return fmt.Sprintf("rgb(%d, %d, %d)", c.R, c.G, c.B)
+	}
+	// Like browsers the alpha is written with 2 decimals when they are enough to get back the same byte
+	alpha := math.Round(float64(c.A)/255*100) / 100
+	if uint8(math.Round(alpha*255)) != c.A {
+		alpha = math.Round(float64(c.A)/255*1000) / 1000
+	}
+	return fmt.Sprintf("rgba(%d, %d, %d, %s)", c.R, c.G, c.B, strconv.FormatFloat(alpha, 'f', -1, 64))
+}
+
 func CalculateBackgroundColor(styles map[string]string) ic.RGBA {
 	// Extract the "background-color" or "background" property from the styles
 	backgroundColor, ok := styles["background-color"]
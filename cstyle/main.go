@@ -7,15 +7,24 @@ import (
 	"gui/color"
 	"gui/element"
 	"gui/font"
+	"gui/img"
 	"gui/library"
+	"gui/media"
 	"gui/parser"
 	"gui/selector"
 	"gui/utils"
 	"image"
-	"os"
+	"image/draw"
+	"io/fs"
+	"math"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"unicode"
 
 	imgFont "golang.org/x/image/font"
 )
@@ -41,9 +50,35 @@ type CSS struct {
 	Fonts        map[string]imgFont.Face
 	StyleMap     map[string][]*parser.StyleMap
 	Options      adapter.Options
+	// FS is where StyleSheet reads from, nil reads from the os file system
+	FS fs.FS
+	// Dir is the directory of the document, the @import's of style tags are resolved against it
+	Dir string
+	// Files are the stylesheets that were read including the imported ones, dev mode watches them
+	Files []string
+	// Structural is set when a selector depends on the siblings or children of a node, changing one node can then
+	// + restyle the nodes next to it and its ancestors
+	Structural bool
+	// Errors are the parse errors of the stylesheets and style tags, the rules they are in were skipped
+	Errors []error
+	// Media holds the @media queries of the stylesheets by their text, UpdateMedia tests them against the viewport
+	Media map[string]*MediaRule
+	// ColorScheme is matched by prefers-color-scheme and PixelRatio (device pixels per CSS pixel) by resolution
+	ColorScheme string
+	PixelRatio  float32
+}
+
+// MediaRule is a group of rules that only apply while Queries match
+type MediaRule struct {
+	Queries media.List
+	Active  bool
 }
 
 func (c *CSS) Transform(n *element.Node) *element.Node {
+	// A node that is laid out from its cache has been transformed already
+	if n.Properties.Cache != nil {
+		return n
+	}
 	for _, v := range c.Transformers {
 		if v.Selector(n) {
 			n = v.Handler(n, c)
@@ -58,10 +93,63 @@ func (c *CSS) Transform(n *element.Node) *element.Node {
 	return n
 }
 
-func (c *CSS) StyleSheet(path string) {
-	// Parse the CSS file
-	dat, _ := os.ReadFile(path)
-	styles, styleMaps := parser.ParseCSS(string(dat))
+// StyleSheet reads the stylesheet at path and the ones it @import's, imports are resolved relative to the sheet.
+// + An import that can't be read is added to Errors
+func (c *CSS) StyleSheet(path string) error {
+	return c.styleSheet(path, nil, nil)
+}
+
+// styleSheet reads an imported or linked sheet, media are the conditions of the @import's that lead to it and
+// + importing the sheets that are being read to find cycles
+func (c *CSS) styleSheet(file string, media, importing []string) error {
+	if slices.Contains(importing, file) {
+		return fmt.Errorf("import cycle %s", strings.Join(append(importing, file), " -> "))
+	}
+	dat, err := utils.ReadFile(c.FS, file)
+	if err != nil {
+		return fmt.Errorf("stylesheet %s: %w", file, err)
+	}
+	c.Files = append(c.Files, file)
+
+	dir := filepath.Dir(file)
+	if c.FS != nil {
+		dir = path.Dir(file)
+	}
+	c.styleTag(string(dat), file, dir, parser.Author, media, append(slices.Clip(importing), file))
+	return nil
+}
+
+func (c *CSS) StyleTag(css string) {
+	dir := c.Dir
+	if dir == "" {
+		dir = "."
+	}
+	c.styleTag(css, "<style>", dir, parser.Author, nil, nil)
+}
+
+// UserAgentStyleTag adds the default styles of the browser (master.css), they lose to any author rule
+func (c *CSS) UserAgentStyleTag(css string) {
+	c.styleTag(css, "master.css", ".", parser.UserAgent, nil, nil)
+}
+
+// styleTag adds a stylesheet after the ones it imports, source is the name its parse errors are reported with and
+// + dir is where its imports are resolved from
+func (c *CSS) styleTag(css, source, dir string, origin parser.Origin, media, importing []string) {
+	sheet := parser.Parse(css)
+	for _, v := range sheet.Imports() {
+		queries := media
+		if v.Media != "" {
+			queries = append(slices.Clip(media), v.Media)
+		}
+		if err := c.styleSheet(utils.ResolvePath(c.FS, dir, v.URL), queries, importing); err != nil {
+			c.Errors = append(c.Errors, fmt.Errorf("%s:%d:%d: %w", source, v.Line, v.Column, err))
+		}
+	}
+
+	styles, styleMaps := sheet.StyleMaps()
+	for _, v := range sheet.Errors {
+		c.Errors = append(c.Errors, fmt.Errorf("%s:%w", source, v))
+	}
 
 	if c.StyleMap == nil {
 		c.StyleMap = map[string][]*parser.StyleMap{}
@@ -73,6 +161,16 @@ func (c *CSS) StyleSheet(path string) {
 		}
 		for styleMapKey := range v {
 			v[styleMapKey].SheetNumber = len(c.StyleSheets)
+			v[styleMapKey].Origin = origin
+			if v[styleMapKey].Selector.Structural() {
+				c.Structural = true
+			}
+			if len(media) > 0 {
+				v[styleMapKey].Media = append(slices.Clip(media), v[styleMapKey].Media...)
+			}
+			for _, query := range v[styleMapKey].Media {
+				c.addMedia(query, source)
+			}
 		}
 		c.StyleMap[k] = append(c.StyleMap[k], v...)
 	}
@@ -80,46 +178,155 @@ func (c *CSS) StyleSheet(path string) {
 	c.StyleSheets = append(c.StyleSheets, styles)
 }
 
-func (c *CSS) StyleTag(css string) {
-	styles, styleMaps := parser.ParseCSS(css)
-
-	if c.StyleMap == nil {
-		c.StyleMap = map[string][]*parser.StyleMap{}
+func (c *CSS) addMedia(query, source string) {
+	if c.Media == nil {
+		c.Media = map[string]*MediaRule{}
 	}
+	if c.Media[query] != nil {
+		return
+	}
+	queries, err := media.Parse(query)
+	if err != nil {
+		c.Errors = append(c.Errors, fmt.Errorf("%s: %w", source, err))
+	}
+	c.Media[query] = &MediaRule{Queries: queries, Active: queries.Match(c.environment())}
+}
 
-	for k, v := range styleMaps {
-		if c.StyleMap[k] == nil {
-			c.StyleMap[k] = []*parser.StyleMap{}
+// UpdateMedia tests the @media queries against the current viewport, it returns true if a group of rules
+// + was turned on or off and the document has to be restyled
+func (c *CSS) UpdateMedia() bool {
+	env := c.environment()
+	changed := false
+	for _, v := range c.Media {
+		if active := v.Queries.Match(env); active != v.Active {
+			v.Active = active
+			changed = true
 		}
-		for styleMapKey := range v {
-			v[styleMapKey].SheetNumber = len(c.StyleSheets)
+	}
+	return changed
+}
+
+func (c *CSS) environment() media.Environment {
+	return media.Environment{
+		Width:       c.Width,
+		Height:      c.Height,
+		PixelRatio:  c.PixelRatio,
+		ColorScheme: c.ColorScheme,
+	}
+}
+
+// mediaActive is true when every @media rule around a style rule matches
+func (c *CSS) mediaActive(queries []string) bool {
+	for _, v := range queries {
+		if m := c.Media[v]; m == nil || !m.Active {
+			return false
 		}
-		c.StyleMap[k] = append(c.StyleMap[k], v...)
 	}
+	return true
+}
 
-	c.StyleSheets = append(c.StyleSheets, styles)
+// Property is what the cascade knows about a property without a value from a rule
+type Property struct {
+	// Initial is the value of the property when nothing sets it. It is left empty when the layout already treats a
+	// + missing value as the initial one (width: auto), initial then removes the property
+	Initial   string
+	Inherited bool
+}
+
+// Properties holds the initial value of the properties the layout and the plugins read and if they are inherited.
+// + A property that isn't listed isn't inherited and has no initial value
+var Properties = map[string]Property{
+	"color":           {Initial: "#000000", Inherited: true},
+	"cursor":          {Inherited: true},
+	"font":            {Inherited: true},
+	"font-family":     {Initial: "serif", Inherited: true},
+	"font-size":       {Initial: "16px", Inherited: true},
+	"font-style":      {Initial: "normal", Inherited: true},
+	"font-weight":     {Initial: "400", Inherited: true},
+	"letter-spacing":  {Initial: "normal", Inherited: true},
+	"line-height":     {Initial: "normal", Inherited: true},
+	"text-indent":     {Initial: "0", Inherited: true},
+	"text-justify":    {Initial: "auto", Inherited: true},
+	"text-shadow":     {Inherited: true},
+	"text-transform":  {Initial: "none", Inherited: true},
+	"text-decoration": {Inherited: true},
+	"visibility":      {Initial: "visible", Inherited: true},
+	"word-spacing":    {Initial: "normal", Inherited: true},
+	"white-space":     {Initial: "normal", Inherited: true},
+	"scrollbar-color": {Inherited: true},
+	"list-style-type": {Initial: "disc", Inherited: true},
+
+	// !NOTE: text-align is inherited in CSS but the textAlign plugin lines up the children of the node it is set on,
+	// + inheriting it would align every level again
+	"text-align": {Initial: "start"},
+	"display":    {Initial: "inline"},
+	"position":   {Initial: "static"},
+	"top":        {},
+	"right":      {},
+	"bottom":     {},
+	"left":       {},
+	"z-index":    {},
+	"width":      {},
+	"height":     {},
+	"min-width":  {},
+	"min-height": {},
+	"max-width":  {},
+	"max-height": {},
+	"box-sizing": {Initial: "content-box"},
+	"float":      {Initial: "none"},
+	"clear":      {Initial: "none"},
+
+	"margin":         {Initial: "0"},
+	"margin-top":     {Initial: "0"},
+	"margin-right":   {Initial: "0"},
+	"margin-bottom":  {Initial: "0"},
+	"margin-left":    {Initial: "0"},
+	"padding":        {Initial: "0"},
+	"padding-top":    {Initial: "0"},
+	"padding-right":  {Initial: "0"},
+	"padding-bottom": {Initial: "0"},
+	"padding-left":   {Initial: "0"},
+	"border":         {},
+	"border-top":     {},
+	"border-right":   {},
+	"border-bottom":  {},
+	"border-left":    {},
+	"border-width":   {},
+	"border-style":   {},
+	"border-color":   {},
+	"border-radius":  {},
+	"outline":        {},
+
+	"background":       {},
+	"background-color": {},
+	"background-image": {},
+	"opacity":          {Initial: "1"},
+	"overflow":         {Initial: "visible"},
+	"overflow-x":       {Initial: "visible"},
+	"overflow-y":       {Initial: "visible"},
+	"object-fit":       {Initial: "fill"},
+	"object-position":  {Initial: "50% 50%"},
+	"vertical-align":   {Initial: "baseline"},
+	"content":          {},
+
+	"flex-direction":  {Initial: "row"},
+	"flex-wrap":       {Initial: "nowrap"},
+	"flex-grow":       {Initial: "0"},
+	"flex-shrink":     {Initial: "1"},
+	"flex-basis":      {},
+	"justify-content": {},
+	"align-items":     {},
+	"align-content":   {},
+	"align-self":      {},
+	"order":           {Initial: "0"},
+	"gap":             {},
+	"row-gap":         {},
+	"column-gap":      {},
 }
 
-var inheritedProps = []string{
-	"color",
-	"cursor",
-	"font",
-	"font-family",
-	"font-size",
-	"font-style",
-	"font-weight",
-	"letter-spacing",
-	"line-height",
-	// "text-align",
-	"text-indent",
-	"text-justify",
-	"text-shadow",
-	"text-transform",
-	"text-decoration",
-	"visibility",
-	"word-spacing",
-	"display",
-	"scrollbar-color",
+// inherits is true for the properties a node takes from its parent, custom properties always inherit
+func inherits(property string) bool {
+	return Properties[property].Inherited || strings.HasPrefix(property, "--")
 }
 
 func (c *CSS) QuickStyles(n *element.Node) map[string]string {
@@ -127,10 +334,9 @@ func (c *CSS) QuickStyles(n *element.Node) map[string]string {
 
 	// Inherit styles from parent
 	if n.Parent != nil {
-		ps := n.Parent.Style
-		for _, prop := range inheritedProps {
-			if value, ok := ps[prop]; ok && value != "" {
-				styles[prop] = value
+		for k, v := range n.Parent.Style {
+			if v != "" && inherits(k) {
+				styles[k] = v
 			}
 		}
 	}
@@ -149,119 +355,351 @@ func (c *CSS) GetStyles(n *element.Node) (map[string]string, map[string]map[stri
 
 	// Inherit styles from parent
 	if n.Parent != nil {
-		ps := n.Parent.Style
-		for _, prop := range inheritedProps {
-			if value, ok := ps[prop]; ok && value != "" {
-				styles[prop] = value
+		for k, v := range n.Parent.Style {
+			if v != "" && inherits(k) {
+				styles[k] = v
 			}
 		}
 	}
 
-	// Add node's own styles
-	for k, v := range n.Style {
-		styles[k] = v
+	// Text nodes can't be matched by a selector
+	if n.TagName == "#text" {
+		for k, v := range n.Style {
+			styles[k] = v
+		}
+		styles["display"] = "inline"
+		styles["font-size"] = "1em"
+		return styles, pseudoStyles
 	}
 
 	// !IDEA: Might be able to only reload page if element that is being hoverved over has a possible :hover class
 	// + might addeventlisteners here?????
 
-	// Apply styles from style sheets
-	selectors := []string{}
+	// Declarations come in the order of the cascade so the last one of a property wins
+	userAgent := map[string]string{}
+	c.cascade(n, func(d Declaration) {
+		if d.PseudoElement == "" {
+			styles[d.Property] = d.Value
+			if d.Origin == parser.UserAgent && !d.Inline {
+				userAgent[d.Property] = d.Value
+			}
+			return
+		}
+		if pseudoStyles[d.PseudoElement] == nil {
+			pseudoStyles[d.PseudoElement] = map[string]string{}
+		}
+		pseudoStyles[d.PseudoElement][d.Property] = d.Value
+	})
 
-	selectors = append(selectors, n.TagName)
+	var parentStyles map[string]string
+	if n.Parent != nil {
+		parentStyles = n.Parent.Style
+	}
+	resolveKeywords(styles, parentStyles, userAgent)
+	resolveVariables(styles, parentStyles)
+	for _, v := range pseudoStyles {
+		// Pseudo-elements can use the custom properties of their element
+		for k, value := range styles {
+			if _, ok := v[k]; !ok && strings.HasPrefix(k, "--") {
+				v[k] = value
+			}
+		}
+		resolveKeywords(v, styles, nil)
+		resolveVariables(v, styles)
+	}
 
-	if n.Id != "" {
-		selectors = append(selectors, "#"+n.Id)
+	// Handle z-index inheritance
+	if n.Parent != nil && styles["z-index"] == "" {
+		if parentZIndex, ok := n.Parent.Style["z-index"]; ok && parentZIndex != "" {
+			z, _ := strconv.Atoi(parentZIndex)
+			z += 1
+			styles["z-index"] = strconv.Itoa(z)
+		}
 	}
 
-	for _, class := range n.ClassList.Classes {
-		if class[0] == ':' {
-			selectors = append(selectors, class)
+	return styles, pseudoStyles
+}
+
+// resolveKeywords replaces the CSS-wide keywords with the value they stand for. inherit takes the value of the
+// + parent, initial the one from Properties, unset does inherit for inherited properties and initial for the others
+// + and revert goes back to the value master.css gave the property (userAgent) or does unset when it gave none
+func resolveKeywords(styles, parent, userAgent map[string]string) {
+	for k, v := range styles {
+		keyword := strings.ToLower(strings.TrimSpace(v))
+		switch keyword {
+		case "revert", "revert-layer":
+			if value, ok := userAgent[k]; ok && !isKeyword(value) {
+				styles[k] = value
+				continue
+			}
+			keyword = "unset"
+		case "inherit", "initial", "unset":
+		default:
+			continue
+		}
+		if keyword == "unset" {
+			keyword = "initial"
+			if inherits(k) {
+				keyword = "inherit"
+			}
+		}
+
+		if value, ok := parent[k]; ok && keyword == "inherit" {
+			styles[k] = value
+		} else if initial := Properties[k].Initial; initial != "" {
+			styles[k] = initial
 		} else {
-			selectors = append(selectors, "."+class)
+			delete(styles, k)
 		}
 	}
+}
 
-	styleMaps := []*parser.StyleMap{}
-	for _, v := range selectors {
-		styleMaps = append(styleMaps, c.StyleMap[v]...)
+func isKeyword(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "inherit", "initial", "unset", "revert", "revert-layer":
+		return true
 	}
+	return false
+}
 
-	for _, styleMap := range styleMaps {
-		parts := styleMap.Selector
-		currentElement := n
-		isPseudo := false
-		pseudoSelector := ""
-		for i, part := range parts {
-			for i, v := range part {
-				if len(v) < 2 {
-					continue
-				}
-				if v[0:2] == "::" {
-					part = append(part[:i], part[i+1:]...)
-					isPseudo = true
-					pseudoSelector = v
+// resolveVariables replaces the var()'s in styles. Custom properties are resolved first so they can use each other,
+// + the ones in a cycle are dropped. A property with a var() that can't be resolved and has no fallback is dropped
+// + too, inherited properties then take the value of the parent
+func resolveVariables(styles, parent map[string]string) {
+	const (
+		resolving = iota + 1
+		resolved
+	)
+	state := map[string]int{}
+	stack := []string{}
+	inCycle := map[string]bool{}
+
+	var lookup func(name string) (string, bool)
+	lookup = func(name string) (string, bool) {
+		value, ok := styles[name]
+		if !ok || !strings.HasPrefix(name, "--") {
+			return "", false
+		}
+		switch state[name] {
+		case resolving:
+			// Everything on the stack since name is part of the cycle
+			for i := len(stack) - 1; i >= 0; i-- {
+				inCycle[stack[i]] = true
+				if stack[i] == name {
 					break
 				}
 			}
+			return "", false
+		case resolved:
+			return value, true
+		}
 
-			has := selector.Contains(part, selectors)
-
-			if i == len(parts)-1 || !has {
-				if has {
-					if isPseudo {
-						for k, v := range *styleMap.Styles {
-							if pseudoStyles[pseudoSelector] == nil {
-								pseudoStyles[pseudoSelector] = map[string]string{}
-							}
-							pseudoStyles[pseudoSelector][k] = v
-						}
-
-					} else {
-						for k, v := range *styleMap.Styles {
-							styles[k] = v
-						}
-					}
-				}
-				break
-			} else {
-				selectors = []string{}
-				currentElement = currentElement.Parent
-
-				for _, class := range currentElement.ClassList.Classes {
-					if class[0] == ':' {
-						selectors = append(selectors, class)
-					} else {
-						selectors = append(selectors, "."+class)
-					}
-				}
+		state[name] = resolving
+		stack = append(stack, name)
+		value, ok = substitute(value, lookup)
+		stack = stack[:len(stack)-1]
+		state[name] = resolved
+		if !ok || inCycle[name] {
+			delete(styles, name)
+			return "", false
+		}
+		styles[name] = value
+		return value, true
+	}
 
-				if n.Id != "" {
-					selectors = append(selectors, "#"+currentElement.Id)
-				}
+	for k := range styles {
+		if strings.HasPrefix(k, "--") {
+			lookup(k)
+		}
+	}
+	for k, v := range styles {
+		if strings.HasPrefix(k, "--") || !strings.Contains(v, "var(") {
+			continue
+		}
+		value, ok := substitute(v, lookup)
+		if ok {
+			styles[k] = value
+		} else if inherited := parent[k]; inherited != "" && inherits(k) {
+			styles[k] = inherited
+		} else {
+			delete(styles, k)
+		}
+	}
+}
 
-				selectors = append(selectors, currentElement.TagName)
+// substitute replaces the var(--name, fallback) functions in value, ok is false when one can't be resolved
+func substitute(value string, lookup func(string) (string, bool)) (string, bool) {
+	var b strings.Builder
+	for {
+		i := strings.Index(value, "var(")
+		if i == -1 {
+			b.WriteString(value)
+			return b.String(), true
+		}
+		if i > 0 && (value[i-1] == '-' || value[i-1] == '_' || unicode.IsLetter(rune(value[i-1])) || unicode.IsDigit(rune(value[i-1]))) {
+			// Part of a longer function name
+			b.WriteString(value[:i+4])
+			value = value[i+4:]
+			continue
+		}
+		end := closingParen(value, i+3)
+		if end == -1 {
+			return "", false
+		}
+		b.WriteString(value[:i])
+
+		name, fallback, hasFallback := strings.Cut(value[i+4:end], ",")
+		if v, ok := lookup(strings.TrimSpace(name)); ok {
+			b.WriteString(v)
+		} else if hasFallback {
+			v, ok := substitute(strings.TrimSpace(fallback), lookup)
+			if !ok {
+				return "", false
+			}
+			b.WriteString(v)
+		} else {
+			return "", false
+		}
+		value = value[end+1:]
+	}
+}
 
+// closingParen finds the ) that closes the ( at i, skipping quoted strings
+func closingParen(s string, i int) int {
+	depth := 0
+	var quote byte
+	for j := i; j < len(s); j++ {
+		c := s[j]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				j++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return j
 			}
 		}
 	}
+	return -1
+}
 
-	// Parse inline styles
-	inlineStyles := parser.ParseStyleAttribute(n.GetAttribute("style"))
-	for k, v := range inlineStyles {
-		styles[k] = v
+// Declaration is one property set by a rule or an inline style, see Explain
+type Declaration struct {
+	Property string
+	Value    string
+	// Selector is empty for inline styles
+	Selector      string
+	PseudoElement string
+	Important     bool
+	Inline        bool
+	Origin        parser.Origin
+	Specificity   selector.Specificity
+	SheetNumber   int
+	Order         int
+}
+
+// Explain returns the declaration that sets property on n and the ones it won over, most important first. Winner
+// + is nil when nothing sets the property, it can still be inherited
+func (c *CSS) Explain(n *element.Node, property string) (*Declaration, []Declaration) {
+	found := []Declaration{}
+	c.cascade(n, func(d Declaration) {
+		if d.Property == property && d.PseudoElement == "" {
+			found = append(found, d)
+		}
+	})
+	if len(found) == 0 {
+		return nil, nil
 	}
+	slices.Reverse(found)
+	return &found[0], found[1:]
+}
 
-	// Handle z-index inheritance
-	if n.Parent != nil && styles["z-index"] == "" {
-		if parentZIndex, ok := n.Parent.Style["z-index"]; ok && parentZIndex != "" {
-			z, _ := strconv.Atoi(parentZIndex)
-			z += 1
-			styles["z-index"] = strconv.Itoa(z)
+// cascade calls apply with every declaration that matches n from the least to the most important: normal
+// + master.css, normal author rules, normal inline styles, !important author rules, !important inline styles and
+// + !important master.css. Rules from the same origin are sorted by specificity then by where they were written.
+// + Inline styles are the ones set with SetStyle and the style attribute
+func (c *CSS) cascade(n *element.Node, apply func(Declaration)) {
+	// Only the rules indexed by a part of the node can match it
+	keys := []string{"*", n.TagName}
+
+	if n.Id != "" {
+		keys = append(keys, "#"+n.Id)
+	}
+
+	for _, class := range n.ClassList.Classes {
+		if class[0] != ':' {
+			keys = append(keys, "."+class)
 		}
 	}
 
-	return styles, pseudoStyles
+	matched := []*parser.StyleMap{}
+	for _, v := range keys {
+		for _, styleMap := range c.StyleMap[v] {
+			if c.mediaActive(styleMap.Media) && n.MatchesSelector(styleMap.Selector) {
+				matched = append(matched, styleMap)
+			}
+		}
+	}
+	slices.SortFunc(matched, func(a, b *parser.StyleMap) int {
+		if cmp := a.Specificity.Compare(b.Specificity); cmp != 0 {
+			return cmp
+		}
+		if a.SheetNumber != b.SheetNumber {
+			return a.SheetNumber - b.SheetNumber
+		}
+		return a.Order - b.Order
+	})
+
+	inline := []map[string]string{n.Style, parser.ParseStyleAttribute(n.GetAttribute("style"))}
+
+	rules := func(origin parser.Origin, important bool) {
+		for _, v := range matched {
+			if v.Origin != origin {
+				continue
+			}
+			for k, value := range *v.Styles {
+				if v.Important[k] != important {
+					continue
+				}
+				apply(Declaration{
+					Property:      k,
+					Value:         value,
+					Selector:      v.Selector.Text,
+					PseudoElement: v.Selector.PseudoElement,
+					Important:     important,
+					Origin:        origin,
+					Specificity:   v.Specificity,
+					SheetNumber:   v.SheetNumber,
+					Order:         v.Order,
+				})
+			}
+		}
+	}
+	inlines := func(important bool) {
+		for _, styles := range inline {
+			for k, v := range styles {
+				value, isImportant := parser.Important(v)
+				if isImportant == important {
+					apply(Declaration{Property: k, Value: value, Important: important, Inline: true})
+				}
+			}
+		}
+	}
+
+	rules(parser.UserAgent, false)
+	rules(parser.Author, false)
+	inlines(false)
+	rules(parser.Author, true)
+	inlines(true)
+	rules(parser.UserAgent, true)
 }
 
 func (c *CSS) AddPlugin(plugin Plugin) {
@@ -285,28 +723,43 @@ func (c *CSS) ComputeNodeStyle(n *element.Node, state *map[string]element.State,
 
 	s := *state
 	self := s[n.Properties.Id]
-	plugins := c.Plugins
 	parent := s[n.Parent.Properties.Id]
 
 	// Cache the style map
 	style := n.Style
 
-	self.Background = color.Parse(style, "background")
-	self.Border, _ = border.Parse(style, self, parent)
-	border.Draw(&self, shelf)
-
 	fs := utils.ConvertToPixels(style["font-size"], parent.EM, parent.Width)
 	self.EM = fs
 
+	self.Background = color.Parse(style, "background")
+	self.Border, _ = border.Parse(style, self, parent)
+
 	if style["display"] == "none" {
 		self.X, self.Y, self.Width, self.Height = 0, 0, 0, 0
 		(*state)[n.Properties.Id] = self
 		return n
 	}
 
+	// The floats of a block formatting context are collected again as they are placed
+	if utils.IsBFC(n) {
+		n.Properties.Floats = nil
+	}
+
+	// Floats are blocks, the inline plugin doesn't place them on the line
+	if utils.IsFloat(n) {
+		if style["display"] == "" || style["display"] == "inline" {
+			style["display"] = "block"
+		} else if strings.HasPrefix(style["display"], "inline-") {
+			style["display"] = strings.TrimPrefix(style["display"], "inline-")
+		}
+	}
+
 	// Set Z index value to be sorted in window
 	if zIndex, err := strconv.Atoi(style["z-index"]); err == nil {
 		self.Z = float32(zIndex)
+	} else if style["position"] == "fixed" || style["position"] == "sticky" {
+		// Fixed and sticky elements are drawn over the content that scrolls under them
+		self.Z = parent.Z + 1
 	}
 	if parent.Z > 0 {
 		self.Z = parent.Z + 1
@@ -330,48 +783,42 @@ func (c *CSS) ComputeNodeStyle(n *element.Node, state *map[string]element.State,
 
 	var top, left, right, bottom bool
 
-	if style["position"] == "absolute" {
+	if outOfFlow(n) {
 		bas := utils.GetPositionOffsetNode(n.Parent)
 		base := s[bas.Properties.Id]
+		percent := parent
+		if style["position"] == "fixed" {
+			// Fixed elements are placed in the viewport (the root state has the size of the window)
+			base = s[root(n).Properties.Id]
+			percent = base
+		}
 		if topVal := style["top"]; topVal != "" {
-			y = utils.ConvertToPixels(topVal, self.EM, parent.Width) + base.Y
+			y = utils.ConvertToPixels(topVal, self.EM, percent.Width) + base.Y
 			top = true
 		}
 		if leftVal := style["left"]; leftVal != "" {
-			x = utils.ConvertToPixels(leftVal, self.EM, parent.Width) + base.X
+			x = utils.ConvertToPixels(leftVal, self.EM, percent.Width) + base.X
 			left = true
 		}
 		if rightVal := style["right"]; rightVal != "" {
-			x = base.X + ((base.Width - width) - utils.ConvertToPixels(rightVal, self.EM, parent.Width))
+			x = base.X + ((base.Width - width) - utils.ConvertToPixels(rightVal, self.EM, percent.Width))
 			right = true
 		}
 		if bottomVal := style["bottom"]; bottomVal != "" {
-			y = (base.Height - height) - utils.ConvertToPixels(bottomVal, self.EM, parent.Width)
+			y = (base.Height - height) - utils.ConvertToPixels(bottomVal, self.EM, percent.Width)
 			bottom = true
 		}
 	} else {
-		for i, v := range n.Parent.Children {
-			if v.Style["position"] != "absolute" {
-				if v.Properties.Id == n.Properties.Id {
-					if i > 0 {
-						sib := n.Parent.Children[i-1]
-						sibling := s[sib.Properties.Id]
-						if sib.Style["position"] != "absolute" {
-							if style["display"] == "inline" {
-								y = sibling.Y
-								if sib.Style["display"] != "inline" {
-									y += sibling.Height
-								}
-							} else {
-								y = sibling.Y + sibling.Height + sibling.Border.Top.Width + sibling.Border.Bottom.Width + sibling.Margin.Bottom
-							}
-						}
-					}
-					break
-				} else if style["display"] != "inline" {
-					vState := s[v.Properties.Id]
-					y += vState.Margin.Top + vState.Margin.Bottom + vState.Padding.Top + vState.Padding.Bottom + vState.Height + self.Border.Top.Width
+		// The element goes after the last sibling in the flow, floats are moved by the float plugin
+		if sib := previousInFlow(n); sib != nil {
+			sibling := s[sib.Properties.Id]
+			if style["display"] == "inline" {
+				y = sibling.Y
+				if sib.Style["display"] != "inline" {
+					y += sibling.Height
 				}
+			} else {
+				y = sibling.Y + sibling.Height + sibling.Border.Top.Width + sibling.Border.Bottom.Width + sibling.Margin.Bottom
 			}
 		}
 	}
@@ -390,6 +837,13 @@ func (c *CSS) ComputeNodeStyle(n *element.Node, state *map[string]element.State,
 		y -= m.Bottom
 	}
 
+	// Clearance moves the border box below the floats before it, the children are laid out from there
+	if !outOfFlow(n) && !utils.IsFloat(n) {
+		if floatBottom := utils.FloatBottom(n, state, style["clear"]); y < floatBottom {
+			y = floatBottom
+		}
+	}
+
 	self.X = x
 	self.Y = y
 
@@ -400,10 +854,19 @@ func (c *CSS) ComputeNodeStyle(n *element.Node, state *map[string]element.State,
 
 	(*state)[n.Properties.Id] = self
 
-	if !utils.ChildrenHaveText(n) && len(n.InnerText) > 0 {
-		n.InnerText = strings.TrimSpace(n.InnerText)
-		self = genTextNode(n, state, c, shelf)
+	// A node that didn't change and starts out the same as the last time (it can have moved) isn't laid out again
+	if cache := n.Properties.Cache; cache != nil && reusable(n, cache, self, parent) {
+		(*state)[n.Parent.Properties.Id] = parent
+		c.restore(n, self.X-cache.Start.X, self.Y-cache.Start.Y, state, shelf)
+		return n
+	}
+	cache := &element.Cache{Parent: parent, Start: self, Floats: len(utils.GetFloats(n)) > 0}
 
+	// Whitespace in text nodes has already been collapsed by the text transformer
+	hasText := len(strings.TrimSpace(n.InnerText)) > 0 || (n.TagName == "#text" && n.InnerText != "")
+	genText := !utils.ChildrenHaveText(n) && hasText
+	if genText {
+		self = genTextNode(n, state, c, shelf)
 	}
 
 	// Load canvas into textures
@@ -423,10 +886,38 @@ func (c *CSS) ComputeNodeStyle(n *element.Node, state *map[string]element.State,
 		}
 	}
 
+	// Images are scaled to the content box, the texture is keyed by everything that changes how it's drawn
+	if n.TagName == "img" && n.Image != nil {
+		bw := int(self.Width + self.Border.Left.Width + self.Border.Right.Width)
+		bh := int(self.Height + self.Border.Top.Width + self.Border.Bottom.Width)
+		cw := int(self.Width - self.Padding.Left - self.Padding.Right)
+		ch := int(self.Height - self.Padding.Top - self.Padding.Bottom)
+		key := "img" + n.Src + strconv.Itoa(bw) + "x" + strconv.Itoa(bh) + strconv.Itoa(cw) + "x" + strconv.Itoa(ch) + style["object-fit"] + style["object-position"]
+		if bw > 0 && bh > 0 && cw > 0 && ch > 0 {
+			if !shelf.Check(key) {
+				fitted := img.Fit(n.Image, cw, ch, style["object-fit"], style["object-position"])
+				texture := image.NewRGBA(image.Rect(0, 0, bw, bh))
+				offset := image.Pt(int(self.Border.Left.Width+self.Padding.Left), int(self.Border.Top.Width+self.Padding.Top))
+				draw.Draw(texture, fitted.Bounds().Add(offset), fitted, image.Point{}, draw.Src)
+				shelf.Set(key, texture)
+			}
+			// Drop the texture from the last size
+			textures := []string{}
+			for _, v := range self.Textures {
+				if v != self.ImageTexture {
+					textures = append(textures, v)
+				}
+			}
+			self.Textures = append(textures, key)
+			self.ImageTexture = key
+		}
+	}
+
 	self.Value = n.InnerText
 	self.TabIndex = n.TabIndex
 	(*state)[n.Properties.Id] = self
 	(*state)[n.Parent.Properties.Id] = parent
+	cache.Mid = self
 	self.ScrollHeight = 0
 	var childYOffset float32
 
@@ -435,11 +926,23 @@ func (c *CSS) ComputeNodeStyle(n *element.Node, state *map[string]element.State,
 		v.Parent = n
 		n.Children[i] = c.ComputeNodeStyle(v, state, shelf)
 		cState := (*state)[n.Children[i].Properties.Id]
-		if style["height"] == "" && style["max-height"] == "" {
+		if v.Properties.Cache != nil && v.Properties.Cache.Reach-1 > cache.Reach {
+			cache.Reach = v.Properties.Cache.Reach - 1
+		}
+		if outOfFlow(v) && anchor(n, v) > cache.Reach {
+			cache.Reach = anchor(n, v)
+		}
+		// Fixed elements are in the viewport, they don't make their parent bigger
+		if v.Style["position"] == "fixed" {
+			continue
+		}
+		// Floats only make a block formatting context bigger, the float plugin does that
+		if style["height"] == "" && style["max-height"] == "" && !utils.IsFloat(v) {
 			if v.Style["position"] != "absolute" && cState.Y+cState.Height > childYOffset {
 				childYOffset = cState.Y + cState.Height
+				// The child's Y already has its top margin and the padding of self in it
 				self.Height = cState.Y - self.Border.Top.Width - self.Y + cState.Height
-				self.Height += cState.Margin.Top + cState.Margin.Bottom + cState.Padding.Top + cState.Padding.Bottom + cState.Border.Top.Width + cState.Border.Bottom.Width
+				self.Height += cState.Margin.Bottom + cState.Border.Top.Width + cState.Border.Bottom.Width
 			}
 		}
 		sh := int((cState.Y + cState.Height) - self.Y)
@@ -452,27 +955,202 @@ func (c *CSS) ComputeNodeStyle(n *element.Node, state *map[string]element.State,
 		}
 	}
 
-	if style["height"] == "" {
+	// GetWH already has the padding in the height when there are no children to grow it
+	if style["height"] == "" && (childYOffset > 0 || genText) {
 		self.Height += self.Padding.Bottom
 	}
 
 	self.ScrollHeight += int(self.Padding.Bottom)
 
 	(*state)[n.Properties.Id] = self
+	n.Properties.Cache = cache
+
+	// The inline plugin lines the children up with the ones after them, then they aren't where their own cache has them
+	if c.runPlugins(n, state) || !done(n, *state) {
+		cache.States = subtree(n, *state, nil)
+	}
+	cache.Done = (*state)[n.Properties.Id]
+	// Floats in the node are added to the block formatting context it is in
+	cache.Floats = cache.Floats || len(utils.GetFloats(n)) > 0
+
+	if n.Properties.Id == "input7" {
+		fmt.Println(n.Properties.Id, self.Width, self.Border)
+	}
 
-	for _, v := range plugins {
+	return n
+}
+
+// runPlugins runs the plugins on n after its children have been laid out, it reports if any of them (or a relative
+// + offset) could have changed the children
+func (c *CSS) runPlugins(n *element.Node, state *map[string]element.State) bool {
+	ran := false
+	for _, v := range c.Plugins {
 		if v.Selector(n) {
 			v.Handler(n, state)
+			ran = true
 		}
 	}
 
-	if n.Properties.Id == "input7" {
-		fmt.Println(n.Properties.Id, self.Width, self.Border)
+	// Relative offsets don't change the flow, they are added after the plugins have placed the children
+	for _, v := range n.Children {
+		if v.Style["position"] == "relative" {
+			dx, dy := relativeOffset(v, (*state)[v.Properties.Id], (*state)[n.Properties.Id])
+			utils.Move(v, dx, dy, state)
+			ran = true
+		}
+	}
+	return ran
+}
+
+// done reports if the children of n are still in the state they were in when they were laid out
+func done(n *element.Node, s map[string]element.State) bool {
+	for _, v := range n.Children {
+		if v.Properties.Cache != nil && !reflect.DeepEqual(s[v.Properties.Id], v.Properties.Cache.Done) {
+			return false
+		}
+	}
+	return true
+}
+
+// subtree appends the states of everything in n to states in document order
+func subtree(n *element.Node, s map[string]element.State, states []element.State) []element.State {
+	for _, v := range n.Children {
+		states = append(states, s[v.Properties.Id])
+		states = subtree(v, s, states)
 	}
+	return states
+}
 
+// restore puts the states of n and everything in it back from the cache moved by dx, dy. The cache is moved too so
+// + the children still start where their own cache says when they are restored one by one
+func (c *CSS) restore(n *element.Node, dx, dy float32, state *map[string]element.State, shelf *library.Shelf) {
+	cache := n.Properties.Cache
+	cache.Start = moved(cache.Start, dx, dy)
+	cache.Mid = moved(cache.Mid, dx, dy)
+	cache.Done = moved(cache.Done, dx, dy)
+	set := func(v *element.Node, s element.State) {
+		// Keep the textures from being cleaned from the shelf
+		for _, t := range s.Textures {
+			shelf.Check(t)
+		}
+		(*state)[v.Properties.Id] = s
+	}
+
+	if cache.States != nil {
+		i := 0
+		var walk func(p *element.Node)
+		walk = func(p *element.Node) {
+			for _, v := range p.Children {
+				// Nodes that weren't laid out (display: none) aren't placed
+				if v.Properties.Cache != nil {
+					cache.States[i] = moved(cache.States[i], dx, dy)
+				}
+				set(v, cache.States[i])
+				i++
+				walk(v)
+			}
+		}
+		walk(n)
+	} else {
+		// Nothing moved the children after they were laid out, they are restored from their own cache
+		set(n, cache.Mid)
+		for _, v := range n.Children {
+			v.Parent = n
+			if v.Properties.Cache != nil {
+				c.restore(v, dx, dy, state, shelf)
+			} else {
+				c.ComputeNodeStyle(v, state, shelf)
+			}
+		}
+	}
+	set(n, cache.Done)
+}
+
+// reusable reports if n can be restored from its cache, self is its box this time before its text and children
+func reusable(n *element.Node, cache *element.Cache, self, parent element.State) bool {
+	if cache.Reach > 0 || cache.Floats || !sameBox(self, cache.Start) || !sameBox(parent, cache.Parent) {
+		return false
+	}
+	// Inline nodes are placed on the line after the node before them
+	if display := n.Style["display"]; display == "inline" || display == "" {
+		return false
+	}
+	// The node goes around the floats before it and the floats in it move what comes after it
+	return len(utils.GetFloats(n)) == 0
+}
+
+// sameBox reports if a and b only differ in where they are, the textures are set again once the text is laid out
+func sameBox(a, b element.State) bool {
+	a.X, a.Y, a.Textures, a.ImageTexture = b.X, b.Y, b.Textures, b.ImageTexture
+	return reflect.DeepEqual(a, b)
+}
+
+func moved(s element.State, dx, dy float32) element.State {
+	s.X += dx
+	s.Y += dy
+	return s
+}
+
+// anchor returns how many levels above n the out of flow child v is placed against
+func anchor(n, v *element.Node) int {
+	// Fixed elements are placed in the viewport and bottom is measured from the top of the page
+	if v.Style["position"] == "fixed" || v.Style["bottom"] != "" {
+		return math.MaxInt32
+	}
+	base := utils.GetPositionOffsetNode(n)
+	level := 0
+	for p := n; p != base; p = p.Parent {
+		if p == nil {
+			return math.MaxInt32
+		}
+		level++
+	}
+	return level
+}
+
+// outOfFlow reports if n is taken out of the flow, the siblings of n are placed as if it wasn't there
+func outOfFlow(n *element.Node) bool {
+	return n.Style["position"] == "absolute" || n.Style["position"] == "fixed"
+}
+
+// previousInFlow returns the sibling before n that n is placed after, nil if n is the first one in the flow
+func previousInFlow(n *element.Node) *element.Node {
+	var prev *element.Node
+	for _, v := range n.Parent.Children {
+		if v.Properties.Id == n.Properties.Id {
+			break
+		}
+		if !outOfFlow(v) && !utils.IsFloat(v) {
+			prev = v
+		}
+	}
+	return prev
+}
+
+func root(n *element.Node) *element.Node {
+	for n.Parent != nil {
+		n = n.Parent
+	}
 	return n
 }
 
+// relativeOffset reads top/left (or bottom/right when they are not set) of a relative element, percentages are of
+// + the size of its parent
+func relativeOffset(n *element.Node, self, parent element.State) (float32, float32) {
+	var dx, dy float32
+	if value := n.Style["left"]; value != "" && value != "auto" {
+		dx = utils.ConvertToPixels(value, self.EM, parent.Width)
+	} else if value := n.Style["right"]; value != "" && value != "auto" {
+		dx = -utils.ConvertToPixels(value, self.EM, parent.Width)
+	}
+	if value := n.Style["top"]; value != "" && value != "auto" {
+		dy = utils.ConvertToPixels(value, self.EM, parent.Height)
+	} else if value := n.Style["bottom"]; value != "" && value != "auto" {
+		dy = -utils.ConvertToPixels(value, self.EM, parent.Height)
+	}
+	return dx, dy
+}
+
 func genTextNode(n *element.Node, state *map[string]element.State, css *CSS, shelf *library.Shelf) element.State {
 	s := *state
 	self := s[n.Properties.Id]
@@ -583,7 +1261,7 @@ func genTextNode(n *element.Node, state *map[string]element.State, css *CSS, she
 		if _, found := lookup[key]; !found {
 			self.Textures = append(self.Textures, key)
 		}
-		width = font.MeasureText(&text, text.Text+" ")
+		width = font.MeasureText(&text, text.Text)
 	} else {
 		var data *image.RGBA
 		data, width = font.Render(&text)
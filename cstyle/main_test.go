@@ -0,0 +1,188 @@
+package cstyle
+
+import (
+	"gui/element"
+	"maps"
+	"testing"
+)
+
+func TestCascade(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		sheets    []string
+		inline    string
+		want      string
+	}{
+		{"author over user agent", "p { color: black }", []string{"p { color: blue }"}, "", "blue"},
+		{"id over classes", "", []string{"#x { color: red } p.a.b { color: blue }"}, "", "red"},
+		{"later rule with the same specificity", "", []string{".a { color: red } .b { color: blue }"}, "", "blue"},
+		{"later sheet with the same specificity", "", []string{".a { color: red }", ".b { color: blue }"}, "", "blue"},
+		{"specificity over a later sheet", "", []string{"p.a { color: red }", ".b { color: blue }"}, "", "red"},
+		{"inline over author", "", []string{"#x { color: red }"}, "blue", "blue"},
+		{"important author over inline", "", []string{"p { color: red !important }"}, "blue", "red"},
+		{"important inline over important author", "", []string{"#x { color: red !important }"}, "blue !important", "blue"},
+		{"important user agent over everything", "p { color: black !important }", []string{"#x { color: red !important }"}, "blue !important", "black"},
+		{"important before a normal declaration in a rule", "", []string{"p { color: red !important; color: blue }"}, "", "red"},
+		{"important in a less specific rule", "", []string{"p { color: red !important } #x { color: blue }"}, "", "red"},
+	}
+	for _, test := range tests {
+		c := CSS{Width: 800, Height: 600}
+		c.UserAgentStyleTag(test.userAgent)
+		for _, v := range test.sheets {
+			c.StyleTag(v)
+		}
+		n := node()
+		if test.inline != "" {
+			n.Style["color"] = test.inline
+		}
+
+		winner, _ := c.Explain(n, "color")
+		if winner == nil {
+			t.Errorf("%s: nothing sets color, want %q", test.name, test.want)
+		} else if winner.Value != test.want {
+			t.Errorf("%s: color = %q from %q, want %q", test.name, winner.Value, winner.Selector, test.want)
+		}
+	}
+}
+
+func TestCascadeMedia(t *testing.T) {
+	c := CSS{Width: 800, Height: 600}
+	c.StyleTag("p { color: black } @media (min-width: 600px) { p { color: blue } } @media (max-width: 599px) { p { color: red } }")
+	n := node()
+
+	for _, v := range []struct {
+		width float32
+		want  string
+	}{{800, "blue"}, {400, "red"}, {600, "blue"}} {
+		c.Width = v.width
+		c.UpdateMedia()
+		if winner, _ := c.Explain(n, "color"); winner == nil || winner.Value != v.want {
+			t.Errorf("color at a width of %v = %+v, want %q", v.width, winner, v.want)
+		}
+	}
+}
+
+func TestResolveVariables(t *testing.T) {
+	tests := []struct {
+		name   string
+		styles map[string]string
+		parent map[string]string
+		want   map[string]string
+	}{
+		{"custom property", map[string]string{"--a": "red", "color": "var(--a)"}, nil,
+			map[string]string{"--a": "red", "color": "red"}},
+		{"fallback", map[string]string{"color": "var(--missing, blue)"}, nil,
+			map[string]string{"color": "blue"}},
+		{"var() in the fallback", map[string]string{"--b": "green", "color": "var(--missing, var(--b, blue))"}, nil,
+			map[string]string{"--b": "green", "color": "green"}},
+		{"fallback with commas", map[string]string{"font-family": "var(--missing, Georgia, serif)"}, nil,
+			map[string]string{"font-family": "Georgia, serif"}},
+		{"nested", map[string]string{"--a": "var(--b) 2px", "--b": "4px", "margin": "var(--a) var(--b)"}, nil,
+			map[string]string{"--a": "4px 2px", "--b": "4px", "margin": "4px 2px 4px"}},
+		{"cycle", map[string]string{"--a": "var(--b)", "--b": "var(--a)", "--c": "1px", "width": "var(--a)"}, nil,
+			map[string]string{"--c": "1px"}},
+		{"cycle with a fallback", map[string]string{"--a": "var(--a)", "width": "var(--a, 10px)"}, nil,
+			map[string]string{"width": "10px"}},
+		{"property in a cycle", map[string]string{"--a": "var(--b)", "--b": "var(--a)", "--c": "var(--a, 1px)"}, nil,
+			map[string]string{"--c": "1px"}},
+		{"invalid inherited property", map[string]string{"color": "var(--missing)"}, map[string]string{"color": "red"},
+			map[string]string{"color": "red"}},
+		{"invalid property", map[string]string{"width": "var(--missing)"}, map[string]string{"width": "5px"},
+			map[string]string{}},
+	}
+	for _, test := range tests {
+		resolveVariables(test.styles, test.parent)
+		if !maps.Equal(test.styles, test.want) {
+			t.Errorf("%s: %v, want %v", test.name, test.styles, test.want)
+		}
+	}
+}
+
+// TestCustomPropertyInheritance checks that p#x.a.b gets the custom properties of body and can set its own
+func TestCustomPropertyInheritance(t *testing.T) {
+	tests := []struct {
+		sheet    string
+		property string
+		want     string
+	}{
+		{"body { --accent: red } p { color: var(--accent) }", "color", "red"},
+		{"body { --accent: red } p { --accent: blue; color: var(--accent) }", "color", "blue"},
+		{"body { --accent: red } p { color: var(--accent) }", "--accent", "red"},
+		// --accent is resolved on body so the --size of p doesn't change it
+		{"body { --size: 2px; --accent: var(--size) } p { --size: 4px; margin: var(--accent) }", "margin", "2px"},
+	}
+	for _, test := range tests {
+		c := CSS{Width: 800, Height: 600}
+		c.StyleTag(test.sheet)
+		n := node()
+		n.Parent.Style, _ = c.GetStyles(n.Parent)
+		styles, _ := c.GetStyles(n)
+		if got := styles[test.property]; got != test.want {
+			t.Errorf("%q: %s is %q, want %q", test.sheet, test.property, got, test.want)
+		}
+	}
+}
+
+func TestResolveKeywords(t *testing.T) {
+	parent := map[string]string{"color": "red", "width": "10px", "margin-top": "5px"}
+	userAgent := map[string]string{"display": "block", "margin-top": "1em"}
+	tests := []struct {
+		property string
+		value    string
+		want     string
+	}{
+		{"color", "inherit", "red"},
+		{"width", "inherit", "10px"},
+		{"font-size", "inherit", "16px"},
+		{"color", "initial", "#000000"},
+		{"display", "initial", "inline"},
+		{"width", "initial", ""},
+		{"color", "unset", "red"},
+		{"margin-top", "unset", "0"},
+		{"display", "unset", "inline"},
+		{"display", "revert", "block"},
+		{"margin-top", "revert", "1em"},
+		{"color", "revert", "red"},
+		{"position", "revert", "static"},
+		{"color", " INHERIT ", "red"},
+	}
+	for _, test := range tests {
+		styles := map[string]string{test.property: test.value}
+		resolveKeywords(styles, parent, userAgent)
+		if got := styles[test.property]; got != test.want {
+			t.Errorf("%s: %s = %q, want %q", test.property, test.value, got, test.want)
+		}
+	}
+}
+
+// TestRevert checks that revert in an author sheet goes back to the user agent value and not the one of an earlier
+// + author rule
+func TestRevert(t *testing.T) {
+	c := CSS{Width: 800, Height: 600}
+	c.UserAgentStyleTag("p { display: block; margin-top: 1em }")
+	c.StyleTag("p { display: flex; margin-top: 4px; color: blue } #x { display: revert; margin-top: revert; color: revert }")
+	n := node()
+	n.Parent.Style = map[string]string{"color": "red"}
+
+	styles, _ := c.GetStyles(n)
+	for property, want := range map[string]string{"display": "block", "margin-top": "1em", "color": "red"} {
+		if styles[property] != want {
+			t.Errorf("%s: revert = %q, want %q", property, styles[property], want)
+		}
+	}
+}
+
+// node returns p#x.a.b in body
+func node() *element.Node {
+	root := &element.Node{TagName: "ROOT"}
+	html := root.CreateElement("html")
+	body := root.CreateElement("body")
+	p := root.CreateElement("p")
+	p.Id = "x"
+	p.ClassList.Classes = []string{"a", "b"}
+	root.AppendChild(&html)
+	html.AppendChild(&body)
+	body.AppendChild(&p)
+	return &p
+}
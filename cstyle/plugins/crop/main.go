@@ -3,6 +3,7 @@ package crop
 import (
 	"gui/cstyle"
 	"gui/element"
+	"gui/utils"
 	"strings"
 )
 
@@ -71,6 +72,8 @@ func Init() cstyle.Plugin {
 				if (child.Y+child.Height)-float32(scrollTop) < (self.Y) || (child.Y-float32(scrollTop)) > self.Y+self.Height {
 					child.Hidden = true
 					(*state)[v.Properties.Id] = child
+					// Hidden children are still scrolled so the sticky elements in them start from where they are
+					updateChildren(v, state, scrollTop)
 				} else {
 					child.Hidden = false
 					yCrop := 0
@@ -95,6 +98,7 @@ func Init() cstyle.Plugin {
 					updateChildren(v, state, scrollTop)
 				}
 			}
+			stick(n, n, self, scrollTop, state)
 			(*state)[n.Properties.Id] = self
 		},
 	}
@@ -105,7 +109,62 @@ func updateChildren(n *element.Node, state *map[string]element.State, offset int
 	self.Y -= float32(offset)
 	(*state)[n.Properties.Id] = self
 	for _, v := range n.Children {
-		updateChildren(v, state, offset)
+		// Fixed elements don't scroll with their parents
+		if v.Style["position"] != "fixed" {
+			updateChildren(v, state, offset)
+		}
+	}
+}
+
+// stick keeps the sticky elements in n in view of the scroll container after it has been scrolled. They stay
+// + top (or bottom) away from the edge of the container but don't leave their parent. Scroll containers inside of
+// + n handle their own sticky elements
+func stick(container, n *element.Node, self element.State, scrollTop int, state *map[string]element.State) {
+	s := *state
+	for _, v := range n.Children {
+		position := v.Style["position"]
+		if position == "fixed" || v.TagName == "grim-scrollbar" {
+			continue
+		}
+		if position == "sticky" {
+			vState := s[v.Properties.Id]
+			parent := s[n.Properties.Id]
+			outer := vState.Height + vState.Border.Top.Width + vState.Border.Bottom.Width
+
+			// The space the element can move in, the content box of its parent or the whole content when its
+			// + parent is the container
+			low := parent.Y + parent.Border.Top.Width + parent.Padding.Top + vState.Margin.Top
+			high := parent.Y + parent.Border.Top.Width + parent.Height - parent.Padding.Bottom - vState.Margin.Bottom - outer
+			if n == container {
+				low = self.Y + self.Border.Top.Width + self.Padding.Top + vState.Margin.Top - float32(scrollTop)
+				high = low - vState.Margin.Top + float32(self.ScrollHeight) - vState.Margin.Bottom - outer
+			}
+
+			y := vState.Y
+			if value := v.Style["top"]; value != "" && value != "auto" {
+				line := self.Y + self.Border.Top.Width + utils.ConvertToPixels(value, vState.EM, self.Height)
+				if y < line {
+					y = max(min(line, high), vState.Y)
+				}
+			} else if value := v.Style["bottom"]; value != "" && value != "auto" {
+				line := self.Y + self.Border.Top.Width + self.Height - utils.ConvertToPixels(value, vState.EM, self.Height) - outer
+				if y > line {
+					y = min(max(line, low), vState.Y)
+				}
+			}
+
+			if y != vState.Y {
+				updateChildren(v, state, int(vState.Y-y))
+				// It was hidden or cropped with the other children before it moved
+				vState = s[v.Properties.Id]
+				vState.Hidden = false
+				vState.Crop = element.Crop{}
+				(*state)[v.Properties.Id] = vState
+			}
+		}
+		if v.Style["overflow"] == "" && v.Style["overflow-x"] == "" && v.Style["overflow-y"] == "" {
+			stick(container, v, self, scrollTop, state)
+		}
 	}
 }
 
@@ -150,7 +150,7 @@ func Init() cstyle.Plugin {
 						if i > 0 {
 							sState := s[n.Children[i-1].Properties.Id]
 							vState.X = sState.X + sState.Width + sState.Margin.Right + vState.Margin.Left + vState.Border.Left.Width + vState.Border.Right.Width
-							propagateOffsets(v, xStore, vState.Y, vState.X, fState.Y+vState.Margin.Top, state)
+							utils.MoveChildren(v, vState.X-xStore, fState.Y+vState.Margin.Top-vState.Y, state)
 						}
 
 						vState.Y = fState.Y + vState.Margin.Top
@@ -182,7 +182,7 @@ func Init() cstyle.Plugin {
 							if w+sum > selfWidth {
 								sum = w + vState.Margin.Left + vState.Margin.Right + (vState.Border.Left.Width + vState.Border.Right.Width)
 							} else {
-								propagateOffsets(v, vState.X, vState.Y, vState.X, sib.Y, state)
+								utils.MoveChildren(v, 0, sib.Y-vState.Y, state)
 								vState.Y = sib.Y
 								(*state)[v.Properties.Id] = vState
 								sum += w + vState.Margin.Left + vState.Margin.Right + (vState.Border.Left.Width + vState.Border.Right.Width)
@@ -221,7 +221,7 @@ func Init() cstyle.Plugin {
 								start = i
 								maxH = 0
 							}
-							propagateOffsets(v, vState.X, vState.Y, xStore, yStore, state)
+							utils.MoveChildren(v, xStore-vState.X, yStore-vState.Y, state)
 						}
 						vState.X = xStore
 						vState.Y = yStore
@@ -266,7 +266,7 @@ func Init() cstyle.Plugin {
 							vState.Height = minHeight(n.Children[i], state, height)
 							yStore := vState.Y
 							vState.Y = self.Y + self.Padding.Top + yOffset + vState.Margin.Top + vState.Border.Top.Width
-							propagateOffsets(n.Children[i], vState.X, yStore, vState.X, vState.Y, state)
+							utils.MoveChildren(n.Children[i], 0, vState.Y-yStore, state)
 						} else if flexWrapped {
 							if vState.Height+vState.Margin.Top+vState.Margin.Bottom+(vState.Border.Top.Width+vState.Border.Bottom.Width) != float32(v[2]) {
 								height := vState.Height - (vState.Margin.Top + vState.Margin.Bottom + (vState.Border.Top.Width + vState.Border.Bottom.Width))
@@ -274,7 +274,7 @@ func Init() cstyle.Plugin {
 							}
 							yStore := vState.Y
 							vState.Y = self.Y + self.Padding.Top + yOffset + vState.Margin.Top + vState.Border.Top.Width
-							propagateOffsets(n.Children[i], vState.X, yStore, vState.X, vState.Y, state)
+							utils.MoveChildren(n.Children[i], 0, vState.Y-yStore, state)
 						}
 						(*state)[n.Children[i].Properties.Id] = vState
 					}
@@ -335,7 +335,7 @@ func Init() cstyle.Plugin {
 
 							vState.Y = sib.Y + sib.Height + sib.Margin.Bottom + sib.Border.Top.Width + vState.Margin.Top + vState.Border.Top.Width
 						}
-						propagateOffsets(v, vState.X, yStore, vState.X, vState.Y, state)
+						utils.MoveChildren(v, 0, vState.Y-yStore, state)
 
 						(*state)[v.Properties.Id] = vState
 					}
@@ -397,7 +397,7 @@ func Init() cstyle.Plugin {
 							yStore := vState.Y
 							vState.X = self.X + self.Padding.Left + self.Border.Left.Width + xOffset + vState.Margin.Left + vState.Border.Left.Width
 							vState.Y = yOffset + vState.Margin.Top + vState.Border.Top.Width
-							propagateOffsets(v, xStore, yStore, vState.X, vState.Y, state)
+							utils.MoveChildren(v, vState.X-xStore, vState.Y-yStore, state)
 							if innerSizes[index][0] == maxWidths[i] {
 								marginOffset = vState.Margin.Right + vState.Margin.Left + (vState.Border.Left.Width + vState.Border.Right.Width)
 							}
@@ -500,28 +500,11 @@ func applyInline(n *element.Node, state *map[string]element.State) {
 	}
 }
 
-func propagateOffsets(n *element.Node, prevx, prevy, newx, newy float32, state *map[string]element.State) {
-	s := *state
-	for _, v := range n.Children {
-		vState := s[v.Properties.Id]
-		xStore := (vState.X - prevx) + newx
-		yStore := (vState.Y - prevy) + newy
-
-		if len(v.Children) > 0 {
-			propagateOffsets(v, vState.X, vState.Y, xStore, yStore, state)
-		}
-		vState.X = xStore
-		vState.Y = yStore
-		(*state)[v.Properties.Id] = vState
-	}
-
-}
-
 func countText(n *element.Node) int {
 	count := 0
 	groups := []int{}
 	for _, v := range n.Children {
-		if v.TagName == "notaspan" {
+		if v.TagName == "#text" {
 			count += 1
 		}
 		if v.Style["display"] == "block" {
@@ -764,7 +747,7 @@ func colReverse(cols [][]int, n *element.Node, state *map[string]element.State)
 		for i := 0; i < len(tempStates); i++ {
 			e := col[0] + i
 			vState := s[n.Children[e].Properties.Id]
-			propagateOffsets(n.Children[e], vState.X, vState.Y, tempStates[i].X, tempStates[i].Y, state)
+			utils.MoveChildren(n.Children[e], tempStates[i].X-vState.X, tempStates[i].Y-vState.Y, state)
 			vState.Y = tempStates[i].Y
 			(*state)[n.Children[e].Properties.Id] = vState
 		}
@@ -789,7 +772,7 @@ func rowReverse(rows [][]int, n *element.Node, state *map[string]element.State)
 		for i := 0; i < len(tempStates); i++ {
 			e := row[0] + i
 			vState := s[n.Children[e].Properties.Id]
-			propagateOffsets(n.Children[e], vState.X, vState.Y, tempStates[i].X, tempStates[i].Y, state)
+			utils.MoveChildren(n.Children[e], tempStates[i].X-vState.X, tempStates[i].Y-vState.Y, state)
 			vState.X = tempStates[i].X
 			(*state)[n.Children[e].Properties.Id] = vState
 		}
@@ -809,7 +792,7 @@ func rowReverse(rows [][]int, n *element.Node, state *map[string]element.State)
 				xChng = ((((parent.X + parent.Width) - parent.Padding.Right) - vState.Width) - vState.Margin.Right) - (vState.Border.Right.Width)
 
 			}
-			propagateOffsets(n.Children[i], vState.X, vState.Y, xChng, vState.Y, state)
+			utils.MoveChildren(n.Children[i], xChng-vState.X, 0, state)
 			vState.X = xChng
 			(*state)[n.Children[i].Properties.Id] = vState
 		}
@@ -832,7 +815,7 @@ func justifyRow(rows [][]int, n *element.Node, state *map[string]element.State,
 					xChng = ((((parent.X + parent.Width) - parent.Padding.Right) - vState.Width) - vState.Margin.Right) - (vState.Border.Right.Width)
 
 				}
-				propagateOffsets(n.Children[i], vState.X, vState.Y, xChng, vState.Y, state)
+				utils.MoveChildren(n.Children[i], xChng-vState.X, 0, state)
 				vState.X = xChng
 				(*state)[n.Children[i].Properties.Id] = vState
 			}
@@ -848,7 +831,7 @@ func justifyRow(rows [][]int, n *element.Node, state *map[string]element.State,
 					xChng = parent.X + parent.Padding.Right + vState.Margin.Left + vState.Border.Left.Width + parent.Border.Right.Width
 
 				}
-				propagateOffsets(n.Children[i], vState.X, vState.Y, xChng, vState.Y, state)
+				utils.MoveChildren(n.Children[i], xChng-vState.X, 0, state)
 				vState.X = xChng
 				(*state)[n.Children[i].Properties.Id] = vState
 			}
@@ -865,10 +848,10 @@ func justifyRow(rows [][]int, n *element.Node, state *map[string]element.State,
 				vState := s[n.Children[i].Properties.Id]
 
 				if !reversed {
-					propagateOffsets(n.Children[i], vState.X, vState.Y, vState.X+offset, vState.Y, state)
+					utils.MoveChildren(n.Children[i], offset, 0, state)
 					vState.X += offset
 				} else {
-					propagateOffsets(n.Children[i], vState.X, vState.Y, vState.X-offset, vState.Y, state)
+					utils.MoveChildren(n.Children[i], -offset, 0, state)
 					vState.X -= offset
 				}
 				(*state)[n.Children[i].Properties.Id] = vState
@@ -907,7 +890,7 @@ func justifyRow(rows [][]int, n *element.Node, state *map[string]element.State,
 
 					}
 
-					propagateOffsets(n.Children[i], vState.X, vState.Y, offset, vState.Y, state)
+					utils.MoveChildren(n.Children[i], offset-vState.X, 0, state)
 					vState.X = offset
 					(*state)[n.Children[i].Properties.Id] = vState
 				}
@@ -922,7 +905,7 @@ func justifyRow(rows [][]int, n *element.Node, state *map[string]element.State,
 
 			// if !reversed {
 			// 	offset = parent.X + parent.Padding.Left + f.Margin.Left + f.Border.Width
-			// 	propagateOffsets(&n.Children[(row[1]-1)-row[0]], vState.X, vState.Y, offset, vState.Y, state)
+			// 	utils.MoveChildren(&n.Children[(row[1]-1)-row[0]], offset-vState.X, 0, state)
 			// 	vState.X = offset
 
 			// 	(*state)[n.Children[(row[1]-1)-row[0]].Properties.Id] = vState
@@ -951,12 +934,12 @@ func justifyRow(rows [][]int, n *element.Node, state *map[string]element.State,
 
 				if !reversed {
 					offset := po * (float32(i-row[0]) + 1)
-					propagateOffsets(n.Children[i], vState.X, vState.Y, vState.X+offset, vState.Y, state)
+					utils.MoveChildren(n.Children[i], offset, 0, state)
 					vState.X += offset
 				} else {
 					offset := po * float32(((row[1]-1)-row[0])-((i-row[0])-1))
 
-					propagateOffsets(n.Children[i], vState.X, vState.Y, vState.X-offset, vState.Y, state)
+					utils.MoveChildren(n.Children[i], -offset, 0, state)
 					vState.X -= offset
 				}
 				(*state)[n.Children[i].Properties.Id] = vState
@@ -989,14 +972,14 @@ func justifyRow(rows [][]int, n *element.Node, state *map[string]element.State,
 						m -= 0.5
 					}
 					offset := po * m
-					propagateOffsets(n.Children[i], vState.X, vState.Y, vState.X+offset, vState.Y, state)
+					utils.MoveChildren(n.Children[i], offset, 0, state)
 					vState.X += offset
 				} else {
 					m := float32(((row[1] - 1) - row[0]) - ((i - row[0]) - 1))
 					m -= 0.5
 					offset := po * m
 
-					propagateOffsets(n.Children[i], vState.X, vState.Y, vState.X-offset, vState.Y, state)
+					utils.MoveChildren(n.Children[i], -offset, 0, state)
 					vState.X -= offset
 				}
 				(*state)[n.Children[i].Properties.Id] = vState
@@ -1071,7 +1054,7 @@ func alignRow(rows [][]int, n *element.Node, state *map[string]element.State, al
 					offset += ((os) * float32(c))
 				}
 
-				propagateOffsets(n.Children[i], vState.X, vState.Y, vState.X, offset, state)
+				utils.MoveChildren(n.Children[i], 0, offset-vState.Y, state)
 				vState.Y = offset
 				(*state)[n.Children[i].Properties.Id] = vState
 			}
@@ -1088,7 +1071,7 @@ func alignRow(rows [][]int, n *element.Node, state *map[string]element.State, al
 				if vState.Height+vState.Margin.Top+vState.Margin.Bottom+(vState.Border.Top.Width+vState.Border.Bottom.Width) < maxH {
 					offset += (maxH - (vState.Height + vState.Margin.Top + vState.Margin.Bottom + (vState.Border.Top.Width + vState.Border.Bottom.Width))) / 2
 				}
-				propagateOffsets(n.Children[i], vState.X, vState.Y, vState.X, offset, state)
+				utils.MoveChildren(n.Children[i], 0, offset-vState.Y, state)
 				vState.Y = offset
 				(*state)[n.Children[i].Properties.Id] = vState
 			}
@@ -1105,7 +1088,7 @@ func alignRow(rows [][]int, n *element.Node, state *map[string]element.State, al
 				if vState.Height+vState.Margin.Top+vState.Margin.Bottom+(vState.Border.Top.Width+vState.Border.Bottom.Width) < maxH {
 					offset += (maxH - (vState.Height + vState.Margin.Top + vState.Margin.Bottom + (vState.Border.Top.Width + vState.Border.Bottom.Width)))
 				}
-				propagateOffsets(n.Children[i], vState.X, vState.Y, vState.X, offset, state)
+				utils.MoveChildren(n.Children[i], 0, offset-vState.Y, state)
 				vState.Y = offset
 				(*state)[n.Children[i].Properties.Id] = vState
 
@@ -1120,7 +1103,7 @@ func alignRow(rows [][]int, n *element.Node, state *map[string]element.State, al
 					offset += ((os) * float32(c))
 				}
 
-				propagateOffsets(n.Children[i], vState.X, vState.Y, vState.X, offset, state)
+				utils.MoveChildren(n.Children[i], 0, offset-vState.Y, state)
 				vState.Y = offset
 				vState.Height = maxH - (vState.Margin.Top + vState.Margin.Bottom + (vState.Border.Top.Width + vState.Border.Bottom.Width))
 				(*state)[n.Children[i].Properties.Id] = vState
@@ -1153,7 +1136,7 @@ func justifyCols(cols [][]int, n *element.Node, state *map[string]element.State,
 				yStore := vState.Y
 				vState.Y = yCollect + vState.Margin.Top
 				yCollect += vState.Height + vState.Margin.Bottom + vState.Margin.Top + vState.Border.Top.Width + vState.Border.Bottom.Width
-				propagateOffsets(n.Children[i], vState.X, yStore, vState.X, vState.Y, state)
+				utils.MoveChildren(n.Children[i], 0, vState.Y-yStore, state)
 				(*state)[v.Properties.Id] = vState
 			}
 		}
@@ -1167,7 +1150,7 @@ func justifyCols(cols [][]int, n *element.Node, state *map[string]element.State,
 				yStore := vState.Y
 				vState.Y = yCollect + vState.Border.Top.Width + vState.Margin.Top
 				yCollect += vState.Height + vState.Margin.Bottom + vState.Border.Top.Width + vState.Margin.Top + vState.Border.Bottom.Width
-				propagateOffsets(n.Children[i], vState.X, yStore, vState.X, vState.Y, state)
+				utils.MoveChildren(n.Children[i], 0, vState.Y-yStore, state)
 				(*state)[v.Properties.Id] = vState
 			}
 		}
@@ -1180,7 +1163,7 @@ func justifyCols(cols [][]int, n *element.Node, state *map[string]element.State,
 				yStore := vState.Y
 				vState.Y = yCollect + vState.Border.Top.Width + vState.Margin.Top + offset
 				yCollect += vState.Height + vState.Margin.Bottom + vState.Border.Top.Width + vState.Margin.Top + vState.Border.Bottom.Width + offset
-				propagateOffsets(n.Children[i], vState.X, yStore, vState.X, vState.Y, state)
+				utils.MoveChildren(n.Children[i], 0, vState.Y-yStore, state)
 				(*state)[v.Properties.Id] = vState
 			}
 		}
@@ -1198,7 +1181,7 @@ func justifyCols(cols [][]int, n *element.Node, state *map[string]element.State,
 					vState.Y += selfHeight - (vState.Height + vState.Margin.Bottom + vState.Border.Top.Width + vState.Margin.Top + vState.Border.Bottom.Width)
 				}
 				yCollect += vState.Height + vState.Margin.Bottom + vState.Border.Top.Width + vState.Margin.Top + vState.Border.Bottom.Width
-				propagateOffsets(n.Children[i], vState.X, yStore, vState.X, vState.Y, state)
+				utils.MoveChildren(n.Children[i], 0, vState.Y-yStore, state)
 				(*state)[v.Properties.Id] = vState
 			}
 		}
@@ -1215,7 +1198,7 @@ func justifyCols(cols [][]int, n *element.Node, state *map[string]element.State,
 					vState.Y += (offset * float32(i-col[0])) + (offset / 2)
 				}
 				yCollect += vState.Height + vState.Margin.Bottom + vState.Border.Top.Width + vState.Margin.Top + vState.Border.Bottom.Width
-				propagateOffsets(n.Children[i], vState.X, yStore, vState.X, vState.Y, state)
+				utils.MoveChildren(n.Children[i], 0, vState.Y-yStore, state)
 				(*state)[v.Properties.Id] = vState
 			}
 		}
@@ -1263,7 +1246,7 @@ func alignCols(cols [][]int, n *element.Node, state *map[string]element.State, a
 				} else if align == "stretch" {
 					vState.Width = (colWidths[c] - (vState.Margin.Left + vState.Margin.Right + (vState.Border.Left.Width + vState.Border.Right.Width)))
 				}
-				propagateOffsets(n.Children[i], xStore, vState.Y, vState.X, vState.Y, state)
+				utils.MoveChildren(n.Children[i], vState.X-xStore, 0, state)
 				(*state)[v.Properties.Id] = vState
 			}
 			xOffset += colWidths[c]
@@ -1339,7 +1322,7 @@ func alignCols(cols [][]int, n *element.Node, state *map[string]element.State, a
 					}
 				}
 			}
-			propagateOffsets(n.Children[i], xStore, vState.Y, vState.X, vState.Y, state)
+			utils.MoveChildren(n.Children[i], vState.X-xStore, 0, state)
 			(*state)[v.Properties.Id] = vState
 		}
 	}
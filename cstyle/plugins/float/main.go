@@ -0,0 +1,184 @@
+package float
+
+import (
+	"gui/cstyle"
+	"gui/element"
+	"gui/utils"
+)
+
+// !TODO: A float after text on the same line goes under the line instead of at the top of it, the line has already
+// + been laid out when the float is placed
+
+func Init() cstyle.Plugin {
+	return cstyle.Plugin{
+		Selector: func(n *element.Node) bool {
+			return utils.IsFloat(n) || utils.IsBFC(n)
+		},
+		Level: 0,
+		Handler: func(n *element.Node, state *map[string]element.State) {
+			// A float is a block formatting context itself, it contains its own floats before it is placed
+			if utils.IsBFC(n) {
+				contain(n, state)
+			}
+			if utils.IsFloat(n) {
+				shrink(n, state)
+				place(n, state)
+			}
+		},
+	}
+}
+
+// contain grows a block formatting context without a height to the bottom of the floats in it
+func contain(n *element.Node, state *map[string]element.State) {
+	if n.Style["height"] != "" && n.Style["height"] != "auto" {
+		return
+	}
+	s := *state
+	self := s[n.Properties.Id]
+
+	var bottom float32
+	for _, f := range floats(n) {
+		_, _, _, y2 := utils.FloatBox(s[f.Properties.Id])
+		bottom = utils.Max(bottom, y2)
+	}
+	if bottom == 0 {
+		return
+	}
+
+	height := bottom - (self.Y + self.Border.Top.Width) + self.Padding.Bottom
+	if maxHeight := n.Style["max-height"]; maxHeight != "" && maxHeight != "none" {
+		height = utils.Min(height, utils.ConvertToPixels(maxHeight, self.EM, s[n.Parent.Properties.Id].Height))
+	}
+	if height > self.Height {
+		self.Height = height
+	}
+	if sh := int(bottom - self.Y + self.Padding.Bottom); sh > self.ScrollHeight {
+		self.ScrollHeight = sh
+	}
+	(*state)[n.Properties.Id] = self
+}
+
+// floats returns the floats that are in the block formatting context n starts
+func floats(n *element.Node) []*element.Node {
+	list := []*element.Node{}
+	for _, v := range n.Children {
+		if utils.IsFloat(v) {
+			list = append(list, v)
+		} else if !utils.IsBFC(v) && v.Style["display"] != "none" {
+			list = append(list, floats(v)...)
+		}
+	}
+	return list
+}
+
+// shrink makes a float without a width as wide as its content, the blocks in it are made smaller with it
+func shrink(n *element.Node, state *map[string]element.State) {
+	// Flex, grid and table floats are sized by their own plugins
+	if display := n.Style["display"]; n.Style["width"] != "" && n.Style["width"] != "auto" || n.TagName == "img" ||
+		display != "block" && display != "flow-root" && display != "list-item" {
+		return
+	}
+	// A float that only has text is already as wide as the text
+	if len(n.Children) == 0 && n.InnerText != "" {
+		return
+	}
+	s := *state
+	self := s[n.Properties.Id]
+
+	left := self.X + self.Border.Left.Width + self.Padding.Left
+	width := utils.Max(extent(n, state), left) - left
+	d := self.Width - self.Padding.Left - self.Padding.Right - width
+	if minWidth := n.Style["min-width"]; minWidth != "" {
+		d = utils.Min(d, self.Width-self.Padding.Left-self.Padding.Right-utils.ConvertToPixels(minWidth, self.EM, s[n.Parent.Properties.Id].Width))
+	}
+	if d <= 0 {
+		return
+	}
+	self.Width -= d
+	(*state)[n.Properties.Id] = self
+	narrow(n, d, state)
+}
+
+// extent returns the right edge of the content of n, blocks without a width are as wide as their own content
+func extent(n *element.Node, state *map[string]element.State) float32 {
+	s := *state
+	var right float32
+	for _, v := range n.Children {
+		if pos := v.Style["position"]; pos == "absolute" || pos == "fixed" || v.Style["display"] == "none" {
+			continue
+		}
+		vState := s[v.Properties.Id]
+		if autoBlock(v) {
+			r := utils.Max(extent(v, state), vState.X+vState.Border.Left.Width+vState.Padding.Left)
+			right = utils.Max(right, r+vState.Padding.Right+vState.Border.Right.Width+vState.Margin.Right)
+		} else {
+			right = utils.Max(right, vState.X+vState.Width+vState.Border.Left.Width+vState.Border.Right.Width+vState.Margin.Right)
+		}
+	}
+	return right
+}
+
+// narrow takes d off the width of the blocks in n that got their width from n
+func narrow(n *element.Node, d float32, state *map[string]element.State) {
+	for _, v := range n.Children {
+		if autoBlock(v) {
+			vState := (*state)[v.Properties.Id]
+			vState.Width -= d
+			(*state)[v.Properties.Id] = vState
+			narrow(v, d, state)
+		}
+	}
+}
+
+// autoBlock reports if n fills the width of its parent
+func autoBlock(n *element.Node) bool {
+	if n.TagName == "#text" || n.TagName == "img" || utils.IsFloat(n) {
+		return false
+	}
+	if n.Style["width"] != "" && n.Style["width"] != "auto" {
+		return false
+	}
+	if pos := n.Style["position"]; pos == "absolute" || pos == "fixed" {
+		return false
+	}
+	display := n.Style["display"]
+	return display == "block" || display == "flow-root" || display == "list-item"
+}
+
+// place moves a float to the left or right of its containing block, below the floats that leave no room for it
+func place(n *element.Node, state *map[string]element.State) {
+	s := *state
+	self := s[n.Properties.Id]
+	parent := s[n.Parent.Properties.Id]
+
+	left := parent.X + parent.Border.Left.Width + parent.Padding.Left
+	right := parent.X + parent.Border.Left.Width + parent.Width - parent.Padding.Right
+
+	before := utils.GetFloats(n)
+	x1, y1, x2, y2 := utils.FloatBox(self)
+	w, h := x2-x1, y2-y1
+
+	// A float is never higher than the floats before it
+	y := y1
+	for _, f := range before {
+		_, fy, _, _ := utils.FloatBox(s[f.Properties.Id])
+		y = utils.Max(y, fy)
+	}
+	y = utils.Max(y, utils.FloatBottom(n, state, n.Style["clear"]))
+
+	var x float32
+	for {
+		l, r, next := utils.FloatSpace(before, state, y, h, left, right)
+		if r-l >= w || next == 0 {
+			x = l
+			if n.Style["float"] == "right" {
+				x = r - w
+			}
+			break
+		}
+		y = next
+	}
+
+	utils.Move(n, x-x1, y-y1, state)
+	utils.AddFloat(n)
+}
@@ -0,0 +1,99 @@
+package float_test
+
+import (
+	"gui"
+	"gui/adapters/headless"
+	"gui/element"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const floats = "body { margin: 0 } #c { width: 400px } .f { width: 100px; height: 50px } .l { float: left } .r { float: right }"
+
+// open lays a page out in the headless runtime, the runtime is closed when the test ends
+func open(t *testing.T, style, body string) *element.Node {
+	w, err := gui.OpenString("<html><head><style>"+style+"</style></head><body>"+body+"</body></html>", headless.Init().Adapter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gui.NewRuntime(&w, 600, 400)
+	t.Cleanup(r.Close)
+	r.Step()
+	return &w.Document
+}
+
+// TestFloat checks the x, y, width and height of floats and the blocks around them in a 400px wide #c
+func TestFloat(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want map[string][4]float32
+	}{
+		{"left and right",
+			"<div id=c><div id=a class='f l'></div><div id=b class='f l'></div><div id=d class='f r' style='width: 150px'></div></div>",
+			map[string][4]float32{"a": {0, 0, 100, 50}, "b": {100, 0, 100, 50}, "d": {250, 0, 150, 50}}},
+		{"no room left",
+			"<div id=c><div id=a class='f l' style='width: 300px'></div><div id=b class='f r' style='width: 150px'></div></div>",
+			map[string][4]float32{"a": {0, 0, 300, 50}, "b": {250, 50, 150, 50}}},
+		{"clear",
+			"<div id=c><div class='f l'></div><div class='f r' style='height: 30px'></div><div id=a style='clear: right; height: 5px'></div><div id=b style='clear: left; height: 5px'></div></div>",
+			map[string][4]float32{"a": {0, 30, 400, 5}, "b": {0, 50, 400, 5}, "c": {0, 0, 400, 55}}},
+		{"clear both",
+			"<div id=c><div class='f l'></div><div class='f r' style='height: 30px'></div><div id=a style='clear: both; height: 5px'></div></div>",
+			map[string][4]float32{"a": {0, 50, 400, 5}}},
+		{"floats leave their parent",
+			"<div id=c><div class='f l'></div></div><div id=a style='height: 5px'></div>",
+			map[string][4]float32{"c": {0, 0, 400, 0}, "a": {0, 0, 600, 5}}},
+		{"overflow contains floats",
+			"<div id=c style='overflow: hidden'><div class='f l'></div></div><div id=a style='height: 5px'></div>",
+			map[string][4]float32{"c": {0, 0, 400, 50}, "a": {0, 50, 600, 5}}},
+		{"flow-root contains floats",
+			"<div id=c style='display: flow-root'><div class='f l' style='height: 70px'></div></div><div id=a style='height: 5px'></div>",
+			map[string][4]float32{"c": {0, 0, 400, 70}, "a": {0, 70, 600, 5}}},
+	}
+	for _, test := range tests {
+		doc := open(t, floats, test.body)
+		for id, want := range test.want {
+			s := doc.QuerySelector("#" + id).Properties.State
+			if got := [4]float32{s.X, s.Y, s.Width, s.Height}; got != want {
+				t.Errorf("%s: #%s is at %v, want %v", test.name, id, got, want)
+			}
+		}
+	}
+}
+
+// TestFloatLines wraps words around a 100x50 left and an 80x30 right float, the words depend on the fonts of the
+// + system so only where the lines start and end is checked
+func TestFloatLines(t *testing.T) {
+	var words []string
+	for i := range 30 {
+		words = append(words, "<span>word"+strconv.Itoa(i)+"</span>")
+	}
+	doc := open(t, floats, "<div id=c><div class='f l'></div><div class='f r' style='width: 80px; height: 30px'></div><p id=p style='margin: 0'>"+strings.Join(words, " ")+"</p></div>")
+
+	var last element.State
+	for i, v := range doc.QuerySelector("#p").Children {
+		if v.TagName != "span" {
+			continue
+		}
+		s := v.Properties.State
+		left, right := float32(0), float32(400)
+		if s.Y < 50 {
+			left = 100
+		}
+		if s.Y < 30 {
+			right = 320
+		}
+		if s.X < left || s.X+s.Width > right {
+			t.Errorf("word %d at %v, %v with a width of %v is outside of %v to %v", i/2, s.X, s.Y, s.Width, left, right)
+		}
+		if i > 0 && s.Y != last.Y && s.X != left {
+			t.Errorf("the line at %v starts at %v, want %v", s.Y, s.X, left)
+		}
+		last = s
+	}
+	if last.Y < 50 {
+		t.Errorf("the last line is at %v, want it below the floats", last.Y)
+	}
+}
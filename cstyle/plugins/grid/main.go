@@ -0,0 +1,1160 @@
+package grid
+
+import (
+	"gui/cstyle"
+	"gui/element"
+	"gui/utils"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// !TODO: The grid-template and grid shorthands, subgrid and baseline alignment (items are aligned to the start
+// + instead) aren't supported
+
+func Init() cstyle.Plugin {
+	return cstyle.Plugin{
+		Selector: func(n *element.Node) bool {
+			return n.Style["display"] == "grid" || n.Style["display"] == "inline-grid"
+		},
+		Level: 4,
+		Handler: func(n *element.Node, state *map[string]element.State) {
+			s := *state
+			self := s[n.Properties.Id]
+
+			width := self.Width - self.Padding.Left - self.Padding.Right
+			height := self.Height - self.Padding.Top - self.Padding.Bottom
+			// Rows can only use the height of the grid when it is set, otherwise the rows decide it. The same goes
+			// + for the columns of a inline-grid
+			definiteHeight := n.Style["height"] != ""
+			definiteWidth := n.Style["display"] == "grid" || n.Style["width"] != ""
+
+			rowGap, columnGap := gaps(n.Style, self.EM, width, height)
+
+			areas := parseAreas(n.Style["grid-template-areas"])
+			columns := parseTracks(n.Style["grid-template-columns"], self.EM, width, definiteWidth, columnGap)
+			rows := parseTracks(n.Style["grid-template-rows"], self.EM, height, definiteHeight, rowGap)
+			areas.lines(&rows, &columns)
+
+			items := []*item{}
+			for _, v := range n.Children {
+				if v.Style["display"] == "none" || v.Style["position"] == "absolute" || v.Style["position"] == "fixed" {
+					continue
+				}
+				order, _ := strconv.Atoi(v.Style["order"])
+				items = append(items, &item{node: v, order: order})
+			}
+			slices.SortStableFunc(items, func(a, b *item) int {
+				return a.order - b.order
+			})
+
+			for _, v := range items {
+				v.place(areas, rows, columns)
+			}
+			flow := strings.Fields(n.Style["grid-auto-flow"])
+			rowCount, columnCount := autoPlace(items, len(rows.tracks), len(columns.tracks), !slices.Contains(flow, "column"), slices.Contains(flow, "dense"))
+
+			columns.grow(columnCount, n.Style["grid-auto-columns"], self.EM, width, definiteWidth)
+			rows.grow(rowCount, n.Style["grid-auto-rows"], self.EM, height, definiteHeight)
+			columns.collapse(items, 1)
+			rows.collapse(items, 0)
+
+			columnSizes := columns.size(items, 1, width, definiteWidth, columnGap, n.Style["justify-content"], state)
+			columnOffsets := distribute(columnSizes, columns.collapsed, width, columnGap, n.Style["justify-content"], definiteWidth)
+
+			// Stretched items are resized before the rows are sized so the rows see their final height
+			for _, v := range items {
+				justifyItem(v, n, columnSizes, columnOffsets, self, state)
+			}
+
+			rowSizes := rows.size(items, 0, height, definiteHeight, rowGap, n.Style["align-content"], state)
+			rowOffsets := distribute(rowSizes, rows.collapsed, height, rowGap, n.Style["align-content"], definiteHeight)
+
+			for _, v := range items {
+				alignItem(v, n, rowSizes, rowOffsets, self, state)
+			}
+
+			if n.Style["height"] == "" {
+				self.Height = self.Padding.Top + self.Padding.Bottom
+				if len(rowOffsets) > 0 {
+					self.Height += rowOffsets[len(rowOffsets)-1] + rowSizes[len(rowSizes)-1]
+				}
+				self.Height = utils.MinHeight(n, self.Height, state)
+			}
+			if !definiteWidth {
+				self.Width = self.Padding.Left + self.Padding.Right
+				if len(columnOffsets) > 0 {
+					self.Width += columnOffsets[len(columnOffsets)-1] + columnSizes[len(columnSizes)-1]
+				}
+			}
+			self.ScrollHeight = 0
+			for _, v := range items {
+				vState := s[v.node.Properties.Id]
+				self.ScrollHeight = max(self.ScrollHeight, int(vState.Y+vState.Height+vState.Border.Bottom.Width+vState.Margin.Bottom-self.Y))
+			}
+			self.ScrollHeight += int(self.Padding.Bottom)
+			(*state)[n.Properties.Id] = self
+		},
+	}
+}
+
+// maxTracks is the most tracks an axis can have, repeat() counts, line numbers and spans are clamped to it like
+// + browsers do so a large number can't use up all of the memory
+const maxTracks = 10000
+
+type sizeKind int
+
+const (
+	fixed sizeKind = iota
+	// auto, min-content and max-content are sized by the items in the track
+	auto
+	fr
+	// fitContent is sized by the items but not bigger than value
+	fitContent
+)
+
+type size struct {
+	kind  sizeKind
+	value float32
+}
+
+// track is a row or a column, min and max are the two sides of minmax(), a single size is used for both
+type track struct {
+	min size
+	max size
+	// autoFit is set on the tracks of repeat(auto-fit, ...), they collapse when they are empty
+	autoFit bool
+}
+
+// axis holds the tracks of the rows or the columns and the named lines between them
+type axis struct {
+	tracks []track
+	// names maps a line name to the lines (starting at 1) that have it
+	names map[string][]int
+	// explicit is the amount of tracks from grid-template-*, the rest are implicit
+	explicit  int
+	collapsed []bool
+}
+
+func parseSize(value string, em, available float32, definite bool) size {
+	switch {
+	case value == "auto" || value == "min-content" || value == "max-content" || value == "":
+		return size{kind: auto}
+	case strings.HasSuffix(value, "fr"):
+		f, _ := strconv.ParseFloat(strings.TrimSuffix(value, "fr"), 32)
+		return size{kind: fr, value: float32(f)}
+	case strings.HasPrefix(value, "fit-content(") && strings.HasSuffix(value, ")"):
+		limit := parseSize(strings.TrimSpace(value[len("fit-content("):len(value)-1]), em, available, definite)
+		return size{kind: fitContent, value: limit.value}
+	case strings.HasSuffix(value, "%") && !definite:
+		// A percentage of a size that isn't known yet
+		return size{kind: auto}
+	}
+	return size{kind: fixed, value: utils.ConvertToPixels(value, em, available)}
+}
+
+func parseTrack(value string, em, available float32, definite bool) track {
+	if strings.HasPrefix(value, "minmax(") && strings.HasSuffix(value, ")") {
+		parts := splitTopLevel(value[len("minmax("):len(value)-1], ',')
+		if len(parts) == 2 {
+			t := track{
+				min: parseSize(strings.TrimSpace(parts[0]), em, available, definite),
+				max: parseSize(strings.TrimSpace(parts[1]), em, available, definite),
+			}
+			// A flexible minimum isn't allowed, it is auto
+			if t.min.kind == fr {
+				t.min = size{kind: auto}
+			}
+			return t
+		}
+	}
+	s := parseSize(value, em, available, definite)
+	if s.kind == fr {
+		// 1fr is minmax(auto, 1fr)
+		return track{min: size{kind: auto}, max: s}
+	}
+	if s.kind == fitContent {
+		return track{min: size{kind: auto}, max: s}
+	}
+	return track{min: s, max: s}
+}
+
+// parseTracks reads grid-template-columns/rows. gap is needed to know how many tracks repeat(auto-fill, ...) makes
+func parseTracks(value string, em, available float32, definite bool, gap float32) axis {
+	if value == "" || value == "none" {
+		return axis{names: map[string][]int{}}
+	}
+
+	// build makes the tracks with repeat(auto-fill/auto-fit, ...) repeated count times, the first pass uses 0 to
+	// + find the space the other tracks leave for it
+	var repeated []string
+	build := func(count int) axis {
+		a := axis{names: map[string][]int{}}
+		var add func(fields []string, autoFit bool)
+		add = func(fields []string, autoFit bool) {
+			for _, v := range fields {
+				switch {
+				case strings.HasPrefix(v, "["):
+					for _, name := range strings.Fields(strings.Trim(v, "[]")) {
+						a.names[name] = append(a.names[name], len(a.tracks)+1)
+					}
+				case strings.HasPrefix(v, "repeat(") && strings.HasSuffix(v, ")"):
+					times, list, ok := strings.Cut(v[len("repeat("):len(v)-1], ",")
+					if !ok {
+						continue
+					}
+					times = strings.TrimSpace(times)
+					fields := splitFields(list)
+					if times == "auto-fill" || times == "auto-fit" {
+						// Only one automatic repeat is allowed
+						if repeated == nil || slices.Equal(repeated, fields) {
+							repeated = fields
+							for range count {
+								if len(a.tracks) >= maxTracks {
+									break
+								}
+								add(fields, times == "auto-fit")
+							}
+						}
+						continue
+					}
+					if t, err := strconv.Atoi(times); err == nil {
+						for range min(t, maxTracks) {
+							if len(a.tracks) >= maxTracks {
+								break
+							}
+							add(fields, autoFit)
+						}
+					}
+				default:
+					if len(a.tracks) >= maxTracks {
+						continue
+					}
+					t := parseTrack(v, em, available, definite)
+					t.autoFit = autoFit
+					a.tracks = append(a.tracks, t)
+				}
+			}
+		}
+		add(splitFields(value), false)
+		a.explicit = len(a.tracks)
+		return a
+	}
+
+	a := build(0)
+	if repeated == nil {
+		return a
+	}
+
+	// The tracks are counted with their fixed size, the minimum of minmax() when the maximum isn't fixed
+	var others, size float32
+	for _, t := range a.tracks {
+		others += fixedSize(t)
+	}
+	tracks := 0
+	for _, v := range repeated {
+		if !strings.HasPrefix(v, "[") {
+			size += fixedSize(parseTrack(v, em, available, definite))
+			tracks++
+		}
+	}
+	count := 1
+	if definite && size+gap*float32(tracks) > 0 {
+		free := available - others - gap*float32(len(a.tracks)-1)
+		count = min(max(1, int(free/(size+gap*float32(tracks)))), maxTracks)
+	}
+	return build(count)
+}
+
+func fixedSize(t track) float32 {
+	if t.max.kind == fixed && t.min.kind != fixed {
+		return t.max.value
+	}
+	if t.min.kind == fixed {
+		return t.min.value
+	}
+	return 0
+}
+
+// grow adds the implicit tracks from grid-auto-rows/columns until there are count tracks
+func (a *axis) grow(count int, value string, em, available float32, definite bool) {
+	autoTracks := []track{}
+	for _, v := range splitFields(value) {
+		autoTracks = append(autoTracks, parseTrack(v, em, available, definite))
+	}
+	if len(autoTracks) == 0 {
+		autoTracks = []track{{min: size{kind: auto}, max: size{kind: auto}}}
+	}
+	for i := 0; len(a.tracks) < min(count, maxTracks); i++ {
+		a.tracks = append(a.tracks, autoTracks[i%len(autoTracks)])
+	}
+}
+
+// collapse marks the empty tracks of repeat(auto-fit, ...), they are sized 0 and the gaps around them are removed
+func (a *axis) collapse(items []*item, index int) {
+	a.collapsed = make([]bool, len(a.tracks))
+	for i, t := range a.tracks {
+		if !t.autoFit {
+			continue
+		}
+		a.collapsed[i] = true
+		for _, v := range items {
+			if v.area[index].start <= i+1 && v.area[index].end > i+1 {
+				a.collapsed[i] = false
+				break
+			}
+		}
+	}
+}
+
+// areas is grid-template-areas as the lines around each named area
+type areas struct {
+	named   map[string][2]span
+	rows    int
+	columns int
+}
+
+type span struct {
+	start int
+	end   int
+}
+
+func parseAreas(value string) areas {
+	a := areas{named: map[string][2]span{}}
+	for row, line := range quoted(value) {
+		cells := strings.Fields(line)
+		a.rows++
+		a.columns = max(a.columns, len(cells))
+		for column, name := range cells {
+			if strings.Trim(name, ".") == "" {
+				continue
+			}
+			area, ok := a.named[name]
+			if !ok {
+				area = [2]span{{row + 1, row + 2}, {column + 1, column + 2}}
+			}
+			area[0].start = min(area[0].start, row+1)
+			area[0].end = max(area[0].end, row+2)
+			area[1].start = min(area[1].start, column+1)
+			area[1].end = max(area[1].end, column+2)
+			a.named[name] = area
+		}
+	}
+	return a
+}
+
+// lines adds the tracks the areas need and the name-start and name-end lines of every area
+func (a areas) lines(rows, columns *axis) {
+	for _, v := range []struct {
+		axis  *axis
+		count int
+		index int
+	}{{rows, a.rows, 0}, {columns, a.columns, 1}} {
+		for len(v.axis.tracks) < v.count {
+			v.axis.tracks = append(v.axis.tracks, track{min: size{kind: auto}, max: size{kind: auto}})
+		}
+		v.axis.explicit = len(v.axis.tracks)
+		for name, area := range a.named {
+			v.axis.names[name+"-start"] = append(v.axis.names[name+"-start"], area[v.index].start)
+			v.axis.names[name+"-end"] = append(v.axis.names[name+"-end"], area[v.index].end)
+		}
+	}
+}
+
+type item struct {
+	node  *element.Node
+	order int
+	// area is the rows (0) and columns (1) the item covers, end is the line after the last track
+	area [2]span
+	// definite is set for the axes the item was placed on by its styles
+	definite [2]bool
+}
+
+// line is one side of grid-row or grid-column: auto, a line number, a line name or a span
+type line struct {
+	auto   bool
+	span   bool
+	number int
+	name   string
+}
+
+func parseLine(value string) line {
+	l := line{}
+	for _, v := range strings.Fields(value) {
+		if v == "span" {
+			l.span = true
+		} else if number, err := strconv.Atoi(v); err == nil {
+			l.number = min(max(number, -maxTracks), maxTracks)
+		} else if v != "auto" {
+			l.name = v
+		}
+	}
+	if l.number == 0 && l.name == "" {
+		l.auto = true
+		if l.span {
+			l.auto = false
+			l.number = 1
+		}
+	}
+	if l.span && l.number <= 0 {
+		l.number = 1
+	}
+	return l
+}
+
+// place resolves grid-area, grid-row, grid-column and their longhands to lines, an axis without a line is left to
+// + autoPlace with its span in area[i].end
+func (it *item) place(areas areas, rows, columns axis) {
+	style := it.node.Style
+	starts := [2]string{}
+	ends := [2]string{}
+
+	if value := style["grid-area"]; value != "" {
+		parts := splitTopLevel(value, '/')
+		for i := range parts {
+			parts[i] = strings.TrimSpace(parts[i])
+		}
+		// A missing side copies a name from the start on the same axis (the row start for the column start),
+		// + anything else becomes auto
+		get := func(i int, fallback string) string {
+			if i < len(parts) {
+				return parts[i]
+			}
+			if isIdent(fallback) {
+				return fallback
+			}
+			return "auto"
+		}
+		starts[0] = parts[0]
+		starts[1] = get(1, starts[0])
+		ends[0] = get(2, starts[0])
+		ends[1] = get(3, starts[1])
+	}
+	for i, name := range []string{"grid-row", "grid-column"} {
+		if value := style[name]; value != "" {
+			start, end, ok := strings.Cut(value, "/")
+			starts[i] = strings.TrimSpace(start)
+			ends[i] = strings.TrimSpace(end)
+			if !ok {
+				ends[i] = "auto"
+				if isIdent(starts[i]) {
+					ends[i] = starts[i]
+				}
+			}
+		}
+		if value := style[name+"-start"]; value != "" {
+			starts[i] = value
+		}
+		if value := style[name+"-end"]; value != "" {
+			ends[i] = value
+		}
+	}
+
+	for i, a := range []axis{rows, columns} {
+		start, end := parseLine(starts[i]), parseLine(ends[i])
+		startLine, startOk := a.resolve(start, "-start")
+		endLine, endOk := a.resolve(end, "-end")
+
+		switch {
+		case startOk && endOk:
+			if endLine < startLine {
+				startLine, endLine = endLine, startLine
+			}
+			if endLine == startLine {
+				endLine++
+			}
+			it.area[i] = span{startLine, endLine}
+		case startOk:
+			count := 1
+			if end.span {
+				count = end.number
+			}
+			it.area[i] = span{startLine, startLine + count}
+		case endOk:
+			count := 1
+			if start.span {
+				count = start.number
+			}
+			it.area[i] = span{max(1, endLine-count), max(1, endLine-count) + count}
+		default:
+			count := 1
+			if start.span {
+				count = start.number
+			} else if end.span {
+				count = end.number
+			}
+			it.area[i] = span{0, count}
+			continue
+		}
+		it.definite[i] = true
+	}
+}
+
+// resolve finds the line number of l, ok is false for auto and spans
+func (a axis) resolve(l line, suffix string) (int, bool) {
+	if l.auto || l.span {
+		return 0, false
+	}
+	if l.name == "" {
+		if l.number < 0 {
+			// !NOTE: Lines before the explicit grid aren't supported, they are clamped to the first line
+			return max(1, a.explicit+2+l.number), true
+		}
+		return l.number, true
+	}
+
+	// name-start/name-end (from an area) is used before a line that is just called name
+	lines, ok := a.names[l.name+suffix]
+	if !ok {
+		lines = a.names[l.name]
+	}
+	n := l.number
+	if n == 0 {
+		n = 1
+	}
+	if n < 0 {
+		if -n <= len(lines) {
+			return lines[len(lines)+n], true
+		}
+		return 1, true
+	}
+	if n <= len(lines) {
+		return lines[n-1], true
+	}
+	// Every implicit line is assumed to have the name
+	return a.explicit + 1 + n - len(lines), true
+}
+
+// autoPlace places the items that don't have a line on both axes following the auto-placement algorithm, byRow is
+// + grid-auto-flow: row. It returns how many rows and columns the grid needs
+func autoPlace(items []*item, rowCount, columnCount int, byRow, dense bool) (int, int) {
+	// major is the axis the cursor moves along last (rows for grid-auto-flow: row)
+	major, minor := 0, 1
+	if !byRow {
+		major, minor = 1, 0
+	}
+	counts := [2]int{rowCount, columnCount}
+	occupied := map[[2]int]bool{}
+
+	fits := func(area [2]span) bool {
+		for r := area[0].start; r < area[0].end; r++ {
+			for c := area[1].start; c < area[1].end; c++ {
+				if occupied[[2]int{r, c}] {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	mark := func(it *item) {
+		for r := it.area[0].start; r < it.area[0].end; r++ {
+			for c := it.area[1].start; c < it.area[1].end; c++ {
+				occupied[[2]int{r, c}] = true
+			}
+		}
+		counts[0] = max(counts[0], it.area[0].end-1)
+		counts[1] = max(counts[1], it.area[1].end-1)
+	}
+
+	for _, v := range items {
+		if v.definite[0] && v.definite[1] {
+			mark(v)
+		}
+	}
+
+	// Items locked to a row (or a column when flowing by column)
+	cursors := map[int]int{}
+	for _, v := range items {
+		if !v.definite[major] || v.definite[minor] {
+			continue
+		}
+		count := v.area[minor].end
+		start := 1
+		if !dense && cursors[v.area[major].start] > 0 {
+			start = cursors[v.area[major].start]
+		}
+		for {
+			v.area[minor] = span{start, start + count}
+			if fits(v.area) {
+				break
+			}
+			start++
+		}
+		cursors[v.area[major].start] = v.area[minor].end
+		mark(v)
+	}
+
+	// The minor axis is as big as the biggest item needs before the cursor starts
+	for _, v := range items {
+		if v.definite[minor] {
+			counts[minor] = max(counts[minor], v.area[minor].end-1)
+		} else if !v.definite[major] {
+			counts[minor] = max(counts[minor], v.area[minor].end)
+		}
+	}
+	counts[minor] = max(counts[minor], 1)
+
+	cursor := [2]int{1, 1}
+	for _, v := range items {
+		if v.definite[major] {
+			continue
+		}
+		majorCount := v.area[major].end
+		if dense {
+			cursor = [2]int{1, 1}
+		}
+		if v.definite[minor] {
+			if !dense && v.area[minor].start < cursor[minor] {
+				cursor[major]++
+			}
+			for {
+				v.area[major] = span{cursor[major], cursor[major] + majorCount}
+				if fits(v.area) {
+					break
+				}
+				cursor[major]++
+			}
+		} else {
+			minorCount := v.area[minor].end
+			for {
+				placed := false
+				for ; cursor[minor]+minorCount-1 <= counts[minor]; cursor[minor]++ {
+					v.area[major] = span{cursor[major], cursor[major] + majorCount}
+					v.area[minor] = span{cursor[minor], cursor[minor] + minorCount}
+					if fits(v.area) {
+						placed = true
+						break
+					}
+				}
+				if placed {
+					break
+				}
+				cursor[major]++
+				cursor[minor] = 1
+			}
+		}
+		cursor[minor] = v.area[minor].end
+		mark(v)
+	}
+	return counts[0], counts[1]
+}
+
+// size finds the size of every track. Fixed sizes come first, tracks sized by their items then take the size of the
+// + biggest one, the free space grows the tracks up to their maximum and what is left is shared by the fr tracks or
+// + the auto tracks when content (justify/align-content) stretches
+func (a axis) size(items []*item, index int, available float32, definite bool, gap float32, content string, state *map[string]element.State) []float32 {
+	count := len(a.tracks)
+	base := make([]float32, count)
+	limit := make([]float32, count)
+	for i, t := range a.tracks {
+		if t.min.kind == fixed {
+			base[i] = t.min.value
+		}
+		switch t.max.kind {
+		case fixed:
+			limit[i] = max(t.max.value, base[i])
+		case fr:
+			limit[i] = float32(math.Inf(1))
+		default:
+			limit[i] = base[i]
+		}
+	}
+
+	contribution := func(v *item) float32 {
+		if index == 1 {
+			return outerWidth(v.node, state)
+		}
+		return outerHeight(v.node, state)
+	}
+	// Text can't wrap again at the width of its track, only items with a width keep an auto column from shrinking
+	minimum := func(v *item) float32 {
+		if index == 1 && v.node.Style["width"] == "" && v.node.TagName != "img" {
+			return 0
+		}
+		return contribution(v)
+	}
+
+	// Items in a single track, then items that span more than one track
+	spanning := []*item{}
+	for _, v := range items {
+		area := v.area[index]
+		if area.end-area.start > 1 {
+			spanning = append(spanning, v)
+			continue
+		}
+		i := area.start - 1
+		if i < 0 || i >= count || a.collapsed[i] {
+			continue
+		}
+		c := contribution(v)
+		t := a.tracks[i]
+		if t.min.kind != fixed {
+			base[i] = max(base[i], minimum(v))
+		}
+		switch t.max.kind {
+		case auto:
+			limit[i] = max(limit[i], c)
+		case fitContent:
+			limit[i] = max(limit[i], min(c, t.max.value))
+		}
+	}
+	for _, v := range spanning {
+		area := v.area[index]
+		var total float32
+		sized := []int{}
+		flexible := false
+		for i := area.start - 1; i < area.end-1 && i < count; i++ {
+			total += base[i]
+			if a.tracks[i].max.kind == fr {
+				flexible = true
+			}
+			if a.tracks[i].min.kind != fixed {
+				sized = append(sized, i)
+			}
+		}
+		// Items spanning a fr track are handled when the fr tracks are sized
+		if flexible || len(sized) == 0 {
+			continue
+		}
+		total += gap * float32(area.end-area.start-1)
+		if extra := minimum(v) - total; extra > 0 {
+			for _, i := range sized {
+				base[i] += extra / float32(len(sized))
+			}
+		}
+		var limits float32
+		for i := area.start - 1; i < area.end-1 && i < count; i++ {
+			limits += max(limit[i], base[i])
+		}
+		if extra := contribution(v) - limits - gap*float32(area.end-area.start-1); extra > 0 {
+			for _, i := range sized {
+				limit[i] = max(limit[i], base[i]) + extra/float32(len(sized))
+			}
+		}
+	}
+	for i := range limit {
+		limit[i] = max(limit[i], base[i])
+	}
+
+	used := func() float32 {
+		var sum float32
+		for i, v := range base {
+			if !a.collapsed[i] {
+				sum += v
+			}
+		}
+		return sum + gap*float32(max(0, visible(a.collapsed)-1))
+	}
+
+	// Grow the tracks to their limit, without a size (inline-grid) there is no free space to share so the tracks
+	// + are as big as their items need (max-content)
+	if !definite {
+		for i, t := range a.tracks {
+			if t.max.kind != fr && !a.collapsed[i] {
+				base[i] = limit[i]
+			}
+		}
+	} else {
+		for free := available - used(); free > 0.5; free = available - used() {
+			growing := []int{}
+			for i := range base {
+				if a.tracks[i].max.kind != fr && base[i] < limit[i] && !a.collapsed[i] {
+					growing = append(growing, i)
+				}
+			}
+			if len(growing) == 0 {
+				break
+			}
+			share := free / float32(len(growing))
+			for _, i := range growing {
+				base[i] = min(limit[i], base[i]+share)
+			}
+		}
+	}
+
+	// fr tracks share the space left, a track whose base size is bigger than its share keeps it
+	flexible := []int{}
+	for i, t := range a.tracks {
+		if t.max.kind == fr && !a.collapsed[i] {
+			flexible = append(flexible, i)
+		}
+	}
+	if len(flexible) > 0 {
+		var frSize float32
+		if definite {
+			inflexible := map[int]bool{}
+			for {
+				var factors float32
+				free := available - gap*float32(max(0, visible(a.collapsed)-1))
+				for i := range base {
+					if a.collapsed[i] {
+						continue
+					}
+					if a.tracks[i].max.kind != fr || inflexible[i] {
+						free -= base[i]
+					} else {
+						factors += a.tracks[i].max.value
+					}
+				}
+				frSize = max(0, free) / max(1, factors)
+				changed := false
+				for _, i := range flexible {
+					if !inflexible[i] && a.tracks[i].max.value*frSize < base[i] {
+						inflexible[i] = true
+						changed = true
+					}
+				}
+				if !changed {
+					break
+				}
+			}
+		} else {
+			// Without a size the fr tracks are as big as they need to be, keeping the ratio between them
+			for _, i := range flexible {
+				if f := a.tracks[i].max.value; f > 0 {
+					frSize = max(frSize, base[i]/max(1, f))
+				}
+			}
+			for _, v := range items {
+				area := v.area[index]
+				var factors, total float32
+				for i := area.start - 1; i < area.end-1 && i < count; i++ {
+					if a.tracks[i].max.kind == fr {
+						factors += a.tracks[i].max.value
+					} else {
+						total += base[i]
+					}
+				}
+				if factors > 0 {
+					total += gap * float32(area.end-area.start-1)
+					frSize = max(frSize, (contribution(v)-total)/max(1, factors))
+				}
+			}
+		}
+		for _, i := range flexible {
+			base[i] = max(base[i], a.tracks[i].max.value*frSize)
+		}
+	}
+
+	// With justify/align-content normal or stretch the auto tracks take the space that is left
+	if definite && len(flexible) == 0 && (content == "" || content == "normal" || content == "stretch") {
+		stretched := []int{}
+		for i, t := range a.tracks {
+			if t.max.kind == auto && !a.collapsed[i] {
+				stretched = append(stretched, i)
+			}
+		}
+		if free := available - used(); free > 0 && len(stretched) > 0 {
+			for _, i := range stretched {
+				base[i] += free / float32(len(stretched))
+			}
+		}
+	}
+
+	for i := range base {
+		if a.collapsed[i] {
+			base[i] = 0
+		}
+	}
+	return base
+}
+
+// distribute returns where each track starts from the content box of the grid following justify-content or
+// + align-content, auto tracks take the space left when it is normal or stretch
+func distribute(sizes []float32, collapsed []bool, available, gap float32, content string, definite bool) []float32 {
+	offsets := make([]float32, len(sizes))
+	var used float32
+	for _, v := range sizes {
+		used += v
+	}
+	count := float32(visible(collapsed))
+	free := available - used - gap*max(0, count-1)
+	if !definite || free < 0 {
+		free = 0
+	}
+
+	start, between := float32(0), gap
+	switch content {
+	case "end", "flex-end", "right":
+		start = free
+	case "center":
+		start = free / 2
+	case "space-between":
+		if count > 1 {
+			between += free / (count - 1)
+		}
+	case "space-around":
+		if count > 0 {
+			start = free / count / 2
+			between += free / count
+		}
+	case "space-evenly":
+		start = free / (count + 1)
+		between += free / (count + 1)
+	}
+
+	position := start
+	first := true
+	for i, v := range sizes {
+		if !collapsed[i] {
+			if !first {
+				position += between
+			}
+			first = false
+		}
+		offsets[i] = position
+		position += v
+	}
+	return offsets
+}
+
+func visible(collapsed []bool) int {
+	count := 0
+	for _, v := range collapsed {
+		if !v {
+			count++
+		}
+	}
+	return count
+}
+
+// area returns the start and size of the tracks from start to end (lines)
+func area(s span, sizes, offsets []float32) (float32, float32) {
+	first, last := s.start-1, min(s.end-1, len(sizes))-1
+	if first < 0 || first >= len(sizes) || last < first {
+		return 0, 0
+	}
+	return offsets[first], offsets[last] + sizes[last] - offsets[first]
+}
+
+// justifyItem moves an item into its columns following justify-self or justify-items of the grid
+func justifyItem(v *item, n *element.Node, sizes, offsets []float32, self element.State, state *map[string]element.State) {
+	s := *state
+	vState := s[v.node.Properties.Id]
+	start, length := area(v.area[1], sizes, offsets)
+
+	align := v.node.Style["justify-self"]
+	if align == "" || align == "auto" {
+		align = n.Style["justify-items"]
+	}
+	outer := outerWidth(v.node, state)
+	margins := vState.Margin.Left + vState.Margin.Right
+	borders := vState.Border.Left.Width + vState.Border.Right.Width
+
+	var offset float32
+	switch alignment(align, v.node.Style["width"] == "" && v.node.TagName != "#text" && v.node.TagName != "img") {
+	case "stretch":
+		vState.Width = max(0, length-margins-borders)
+	case "start":
+		vState.Width = max(0, outer-margins-borders)
+	case "end":
+		vState.Width = max(0, outer-margins-borders)
+		offset = length - outer
+	case "center":
+		vState.Width = max(0, outer-margins-borders)
+		offset = (length - outer) / 2
+	}
+
+	x := self.X + self.Border.Left.Width + self.Padding.Left + start + offset + vState.Margin.Left
+	utils.MoveChildren(v.node, x-vState.X, 0, state)
+	vState.X = x
+	(*state)[v.node.Properties.Id] = vState
+	fitChildren(v.node, state)
+}
+
+// alignItem moves an item into its rows following align-self or align-items of the grid
+func alignItem(v *item, n *element.Node, sizes, offsets []float32, self element.State, state *map[string]element.State) {
+	s := *state
+	vState := s[v.node.Properties.Id]
+	start, length := area(v.area[0], sizes, offsets)
+
+	align := v.node.Style["align-self"]
+	if align == "" || align == "auto" {
+		align = n.Style["align-items"]
+	}
+	outer := outerHeight(v.node, state)
+	margins := vState.Margin.Top + vState.Margin.Bottom
+	borders := vState.Border.Top.Width + vState.Border.Bottom.Width
+
+	var offset float32
+	switch alignment(align, v.node.Style["height"] == "" && v.node.TagName != "#text" && v.node.TagName != "img") {
+	case "stretch":
+		vState.Height = max(vState.Height, length-margins-borders)
+	case "end":
+		offset = length - outer
+	case "center":
+		offset = (length - outer) / 2
+	}
+
+	y := self.Y + self.Border.Top.Width + self.Padding.Top + start + offset + vState.Margin.Top
+	utils.MoveChildren(v.node, 0, y-vState.Y, state)
+	vState.Y = y
+	(*state)[v.node.Properties.Id] = vState
+}
+
+// alignment reduces the values of justify/align-items/self to stretch, start, end or center. normal stretches
+// + items without a size
+func alignment(value string, stretch bool) string {
+	switch strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(value, "safe "), "unsafe ")) {
+	case "end", "self-end", "flex-end", "right":
+		return "end"
+	case "center":
+		return "center"
+	case "start", "self-start", "flex-start", "left", "baseline", "first baseline", "last baseline":
+		return "start"
+	}
+	if stretch {
+		return "stretch"
+	}
+	return "start"
+}
+
+// fitChildren gives the block children of a resized item the new width of its content box
+func fitChildren(n *element.Node, state *map[string]element.State) {
+	s := *state
+	self := s[n.Properties.Id]
+	width := self.Width - self.Padding.Left - self.Padding.Right
+	for _, v := range n.Children {
+		if v.TagName == "#text" || v.TagName == "img" || v.Style["width"] != "" || v.Style["position"] == "absolute" {
+			continue
+		}
+		display := v.Style["display"]
+		if display == "inline" || display == "inline-block" || display == "none" || display == "inline-grid" || display == "inline-flex" {
+			continue
+		}
+		vState := s[v.Properties.Id]
+		vState.Width = max(0, width-vState.Margin.Left-vState.Margin.Right-vState.Border.Left.Width-vState.Border.Right.Width)
+		(*state)[v.Properties.Id] = vState
+		fitChildren(v, state)
+	}
+}
+
+// outerWidth is the width an item needs for its content, with its margins and borders
+func outerWidth(n *element.Node, state *map[string]element.State) float32 {
+	s := *state
+	self := s[n.Properties.Id]
+	outside := self.Margin.Left + self.Margin.Right + self.Border.Left.Width + self.Border.Right.Width
+	if n.TagName == "#text" || n.TagName == "img" || n.Style["width"] != "" || len(n.Children) == 0 {
+		if n.TagName != "#text" && n.TagName != "img" && n.Style["width"] == "" {
+			return outside + self.Padding.Left + self.Padding.Right
+		}
+		return self.Width + outside
+	}
+
+	// Inline children are on one line, block children are under each other
+	var widest, line float32
+	for _, v := range n.Children {
+		if v.Style["display"] == "none" || v.Style["position"] == "absolute" {
+			continue
+		}
+		w := outerWidth(v, state)
+		if v.TagName == "#text" || strings.HasPrefix(v.Style["display"], "inline") {
+			line += w
+		} else {
+			widest = max(widest, line, w)
+			line = 0
+		}
+	}
+	widest = max(widest, line)
+	if minWidth := n.Style["min-width"]; minWidth != "" {
+		widest = max(widest, utils.ConvertToPixels(minWidth, self.EM, s[n.Parent.Properties.Id].Width))
+	}
+	return widest + self.Padding.Left + self.Padding.Right + outside
+}
+
+func outerHeight(n *element.Node, state *map[string]element.State) float32 {
+	self := (*state)[n.Properties.Id]
+	return self.Height + self.Margin.Top + self.Margin.Bottom + self.Border.Top.Width + self.Border.Bottom.Width
+}
+
+func gaps(style map[string]string, em, width, height float32) (float32, float32) {
+	rowGap, columnGap := style["grid-row-gap"], style["grid-column-gap"]
+	for _, name := range []string{"grid-gap", "gap"} {
+		if value := style[name]; value != "" {
+			parts := strings.Fields(value)
+			rowGap = parts[0]
+			columnGap = parts[len(parts)-1]
+		}
+	}
+	if value := style["row-gap"]; value != "" {
+		rowGap = value
+	}
+	if value := style["column-gap"]; value != "" {
+		columnGap = value
+	}
+	return utils.ConvertToPixels(rowGap, em, height), utils.ConvertToPixels(columnGap, em, width)
+}
+
+// splitFields splits a track list on spaces outside of () and keeps [line names] together
+func splitFields(value string) []string {
+	fields := []string{}
+	depth := 0
+	start := -1
+	for i, c := range value {
+		switch {
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+		case (c == ' ' || c == '\t' || c == '\n') && depth == 0:
+			if start != -1 {
+				fields = append(fields, value[start:i])
+				start = -1
+			}
+			continue
+		}
+		if start == -1 {
+			start = i
+		}
+	}
+	if start != -1 {
+		fields = append(fields, value[start:])
+	}
+	return fields
+}
+
+func splitTopLevel(value string, sep rune) []string {
+	parts := []string{}
+	depth := 0
+	start := 0
+	for i, c := range value {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case sep:
+			if depth == 0 {
+				parts = append(parts, value[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, value[start:])
+}
+
+// quoted returns the strings of grid-template-areas
+func quoted(value string) []string {
+	strs := []string{}
+	for {
+		start := strings.IndexAny(value, `"'`)
+		if start == -1 {
+			return strs
+		}
+		end := strings.IndexByte(value[start+1:], value[start])
+		if end == -1 {
+			return append(strs, value[start+1:])
+		}
+		strs = append(strs, value[start+1:start+1+end])
+		value = value[start+end+2:]
+	}
+}
+
+func isIdent(value string) bool {
+	if value == "" || value == "auto" || strings.HasPrefix(value, "span") {
+		return false
+	}
+	_, err := strconv.Atoi(strings.Fields(value)[0])
+	return err != nil
+}
@@ -0,0 +1,63 @@
+package grid_test
+
+import (
+	"gui"
+	"gui/adapters/headless"
+	"testing"
+)
+
+// TestGrid lays a 400px wide grid out in the headless runtime and checks the x, y, width and height of each item
+func TestGrid(t *testing.T) {
+	tests := []struct {
+		name  string
+		grid  string
+		items string
+		want  [][4]float32
+	}{
+		{"fr", "grid-template-columns: 1fr 2fr 1fr; grid-template-rows: 40px",
+			"<div></div><div></div><div></div>",
+			[][4]float32{{0, 0, 100, 40}, {100, 0, 200, 40}, {300, 0, 100, 40}}},
+		{"fixed and fr", "grid-template-columns: 100px 1fr; grid-template-rows: 40px 60px",
+			"<div></div><div></div><div></div><div></div>",
+			[][4]float32{{0, 0, 100, 40}, {100, 0, 300, 40}, {0, 40, 100, 60}, {100, 40, 300, 60}}},
+		{"minmax", "grid-template-columns: minmax(100px, 1fr) minmax(50px, 80px); grid-template-rows: 40px",
+			"<div></div><div></div>",
+			[][4]float32{{0, 0, 320, 40}, {320, 0, 80, 40}}},
+		{"gaps", "grid-template-columns: 1fr 1fr; grid-template-rows: 40px 40px; gap: 10px 20px",
+			"<div></div><div></div><div></div><div></div>",
+			[][4]float32{{0, 0, 190, 40}, {210, 0, 190, 40}, {0, 50, 190, 40}, {210, 50, 190, 40}}},
+		{"named areas", "grid-template-columns: 100px 1fr; grid-template-rows: 30px 50px; grid-template-areas: \"head head\" \"side main\"",
+			"<div style=\"grid-area: main\"></div><div style=\"grid-area: side\"></div><div style=\"grid-area: head\"></div>",
+			[][4]float32{{100, 30, 300, 50}, {0, 30, 100, 50}, {0, 0, 400, 30}}},
+		{"negative lines", "grid-template-columns: 100px 100px 100px; grid-template-rows: 40px 40px",
+			"<div style=\"grid-column: -2 / -1; grid-row: -2\"></div><div style=\"grid-column: 1 / -1\"></div>",
+			[][4]float32{{200, 40, 100, 40}, {0, 0, 300, 40}}},
+		{"implicit rows", "grid-template-columns: 100px 100px; grid-template-rows: 40px; grid-auto-rows: 25px",
+			"<div></div><div></div><div></div><div></div><div></div>",
+			[][4]float32{{0, 0, 100, 40}, {100, 0, 100, 40}, {0, 40, 100, 25}, {100, 40, 100, 25}, {0, 65, 100, 25}}},
+		{"implicit columns", "grid-template-columns: 100px 100px; grid-template-rows: 40px; grid-auto-columns: 50px",
+			"<div></div><div style=\"grid-column: 4\"></div>",
+			[][4]float32{{0, 0, 100, 40}, {250, 0, 50, 40}}},
+	}
+	for _, test := range tests {
+		page := "<html><head><style>body { margin: 0 } #g { display: grid; width: 400px; " + test.grid + " }</style></head><body><div id=\"g\">" + test.items + "</div></body></html>"
+		w, err := gui.OpenString(page, headless.Init().Adapter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := gui.NewRuntime(&w, 600, 400)
+		r.Step()
+
+		items := w.Document.QuerySelector("#g").Children
+		if len(items) != len(test.want) {
+			t.Fatalf("%s: %d items, want %d", test.name, len(items), len(test.want))
+		}
+		for i, v := range items {
+			s := v.Properties.State
+			if got := [4]float32{s.X, s.Y, s.Width, s.Height}; got != test.want[i] {
+				t.Errorf("%s: item %d is at %v, want %v", test.name, i, got, test.want[i])
+			}
+		}
+		r.Close()
+	}
+}
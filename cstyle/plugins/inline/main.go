@@ -3,6 +3,7 @@ package inline
 import (
 	"gui/cstyle"
 	"gui/element"
+	"gui/utils"
 	"math"
 )
 
@@ -31,83 +32,87 @@ func Init() cstyle.Plugin {
 				copyOfX = parent.X + parent.Padding.Left
 			}
 
-			// xCollect := float32(0)
-			for i, v := range n.Parent.Children {
-				// vState := s[v.Properties.Id]
-				if i > 0 {
-					if v.Style["position"] != "absolute" {
-						if v.Properties.Id == n.Properties.Id {
-							sib := n.Parent.Children[i-1]
-							if sib.Style["position"] == "absolute" {
-								if i-2 >= 0 {
-									sib = n.Parent.Children[i-2]
-								} else {
-									continue
-								}
-							}
-							sibling := s[sib.Properties.Id]
-							if sibling.X+sibling.Width+self.Width > (parent.Width+parent.X+parent.Border.Left.Width)-(parent.Padding.Right) {
-								// Break Node.Id
-								self.Y = sibling.Y + sibling.Height
-								self.X = copyOfX
-							} else {
-								// Node did not break
-								if sib.Style["display"] != "inline" {
-									self.Y = sibling.Y + sibling.Height + sibling.Border.Top.Width + sibling.Border.Bottom.Width + sibling.Margin.Top + sibling.Margin.Bottom
-								} else {
-									self.Y = sibling.Y
-									self.X = sibling.X + sibling.Width
-								}
-								if n.InnerText != "" {
-									baseY := sibling.Y
-									var max float32
-									for a := i; a >= 0; a-- {
-										b := n.Parent.Children[a]
-										bStyle := s[b.Properties.Id]
-										if bStyle.Y == baseY {
-											if bStyle.EM > max {
-												max = bStyle.EM
-											}
-										}
-									}
+			// Lines get shorter next to floats, a word that doesn't fit next to them goes under them
+			floats := utils.GetFloats(n)
+			right := (parent.Width + parent.X + parent.Border.Left.Width) - parent.Padding.Right
+			lineStart := func(left float32) {
+				for {
+					l, r, next := utils.FloatSpace(floats, state, self.Y, self.Height, left, right)
+					self.X = l
+					if self.Width <= r-l || next == 0 {
+						return
+					}
+					self.Y = next
+				}
+			}
 
-									for a := i; a >= 0; a-- {
-										b := n.Parent.Children[a]
-										bStyle := s[b.Properties.Id]
-										if bStyle.Y == baseY {
-											bStyle.Y += (float32(math.Ceil(float64((max - (max * 0.3))))) - float32(math.Ceil(float64(bStyle.EM-(bStyle.EM*0.3)))))
-											(*state)[b.Properties.Id] = bStyle
-										}
-									}
-									if self.Y == baseY {
-										self.Y += (float32(math.Ceil(float64((max - (max * 0.3))))) - float32(math.Ceil(float64(self.EM-(self.EM*0.3)))))
-									}
+			// Absolute and fixed elements keep the place they were given
+			i, sib := previousInFlow(n)
+			inFlow := n.Style["position"] != "absolute" && n.Style["position"] != "fixed"
+			if inFlow && sib == nil {
+				lineStart(self.X)
+			} else if inFlow {
+				sibling := s[sib.Properties.Id]
+				_, lineRight, _ := utils.FloatSpace(floats, state, sibling.Y, sibling.Height, copyOfX, right)
+				if sibling.X+sibling.Width+self.Width > lineRight {
+					// Break Node.Id
+					self.Y = sibling.Y + sibling.Height
+					lineStart(copyOfX)
+				} else {
+					// Node did not break
+					if sib.Style["display"] != "inline" {
+						self.Y = sibling.Y + sibling.Height + sibling.Border.Top.Width + sibling.Border.Bottom.Width + sibling.Margin.Top + sibling.Margin.Bottom
+						lineStart(self.X)
+					} else {
+						self.Y = sibling.Y
+						self.X = sibling.X + sibling.Width
+					}
+					if n.InnerText != "" {
+						baseY := sibling.Y
+						var max float32
+						for a := i; a >= 0; a-- {
+							b := n.Parent.Children[a]
+							bStyle := s[b.Properties.Id]
+							if bStyle.Y == baseY {
+								if bStyle.EM > max {
+									max = bStyle.EM
 								}
+							}
+						}
 
+						for a := i; a >= 0; a-- {
+							b := n.Parent.Children[a]
+							bStyle := s[b.Properties.Id]
+							if bStyle.Y == baseY {
+								bStyle.Y += (float32(math.Ceil(float64((max - (max * 0.3))))) - float32(math.Ceil(float64(bStyle.EM-(bStyle.EM*0.3)))))
+								(*state)[b.Properties.Id] = bStyle
 							}
-							break
+						}
+						if self.Y == baseY {
+							self.Y += (float32(math.Ceil(float64((max - (max * 0.3))))) - float32(math.Ceil(float64(self.EM-(self.EM*0.3)))))
 						}
 					}
 				}
-
 			}
-			propagateOffsets(n, copyOfX, copyOfY, self, state)
+			utils.MoveChildren(n, self.X-copyOfX, self.Y-copyOfY, state)
 			(*state)[n.Properties.Id] = self
 		},
 	}
 }
 
-func propagateOffsets(n *element.Node, copyOfX, copyOfY float32, self element.State, state *map[string]element.State) {
-	s := *state
-	for _, v := range n.Children {
-		vState := s[v.Properties.Id]
-		vState.X += self.X - copyOfX
-		vState.Y += self.Y - copyOfY
-		if len(v.Children) > 0 {
-			propagateOffsets(v, copyOfX, copyOfY, self, state)
+// previousInFlow returns the index of n and the sibling n is placed after, absolute, fixed and floated siblings are
+// + skipped
+func previousInFlow(n *element.Node) (int, *element.Node) {
+	var prev *element.Node
+	for i, v := range n.Parent.Children {
+		if v.Properties.Id == n.Properties.Id {
+			return i, prev
+		}
+		if v.Style["position"] != "absolute" && v.Style["position"] != "fixed" && !utils.IsFloat(v) {
+			prev = v
 		}
-		(*state)[v.Properties.Id] = vState
 	}
+	return 0, prev
 }
 
 // func colliderDetection(s1, s2 element.State) bool {
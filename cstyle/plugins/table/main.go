@@ -0,0 +1,881 @@
+package table
+
+import (
+	"gui/cstyle"
+	"gui/element"
+	"gui/utils"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// !TODO: vertical-align: baseline is laid out as top, and visibility: collapse and empty-cells aren't supported
+
+func Init() cstyle.Plugin {
+	return cstyle.Plugin{
+		Selector: func(n *element.Node) bool {
+			return n.Style["display"] == "table" || n.Style["display"] == "inline-table"
+		},
+		Level: 4,
+		Handler: func(n *element.Node, state *map[string]element.State) {
+			s := *state
+			self := s[n.Properties.Id]
+			parent := s[n.Parent.Properties.Id]
+
+			t := build(n)
+			columnCount, rowCount := t.columnCount, len(t.rows)
+			// An empty table has no lines to share, its borders are drawn as they are
+			collapse := n.Style["border-collapse"] == "collapse" && columnCount > 0 && rowCount > 0
+
+			// The space between the columns and rows, with border-collapse it is the width of the shared borders
+			var gapsX, gapsY []float32
+			var b bands
+			if collapse {
+				b = t.collapse(self.Border, state)
+				gapsX, gapsY = b.columns, b.rows
+				// A collapsed table has no padding
+				self.Width -= self.Padding.Left + self.Padding.Right
+				self.Height -= self.Padding.Top + self.Padding.Bottom
+				self.Padding = element.MarginPadding{}
+			} else {
+				h, v := spacing(n.Style["border-spacing"], self.EM, parent.Width)
+				gapsX, gapsY = repeat(h, columnCount+1), repeat(v, rowCount+1)
+				if columnCount == 0 {
+					gapsX = []float32{0}
+				}
+				if rowCount == 0 {
+					gapsY = []float32{0}
+				}
+			}
+
+			var available float32
+			if collapse {
+				available = self.Width + self.Border.Left.Width + self.Border.Right.Width - sum(gapsX)
+			} else {
+				available = self.Width - self.Padding.Left - self.Padding.Right - sum(gapsX)
+			}
+			definite := n.Style["width"] != "" && n.Style["width"] != "auto"
+
+			var widths []float32
+			if n.Style["table-layout"] == "fixed" && definite {
+				widths = t.fixedWidths(available, gapsX, collapse, state)
+			} else {
+				widths = t.autoWidths(available, definite, gapsX, collapse, state)
+			}
+			heights := t.heights(n, self, gapsY, collapse, state)
+
+			xs, totalX := offsets(widths, gapsX)
+			ys, totalY := offsets(heights, gapsY)
+
+			if collapse {
+				self.Border.Left = b.table(self.Border.Left, gapsX[0])
+				self.Border.Right = b.table(self.Border.Right, gapsX[columnCount])
+				self.Border.Top = b.table(self.Border.Top, gapsY[0])
+				self.Border.Bottom = b.table(self.Border.Bottom, gapsY[len(gapsY)-1])
+				self.Width = totalX - self.Border.Left.Width - self.Border.Right.Width
+				totalY -= self.Border.Top.Width + self.Border.Bottom.Width
+			} else {
+				self.Width = totalX + self.Padding.Left + self.Padding.Right
+				totalY += self.Padding.Top + self.Padding.Bottom
+			}
+			// A table with a height still grows to fit its rows
+			if n.Style["height"] == "" {
+				self.Height = totalY
+			} else {
+				self.Height = max(self.Height, totalY)
+			}
+			self.Height = utils.MinHeight(n, self.Height, state)
+			borderBox := self.Width + self.Border.Left.Width + self.Border.Right.Width
+
+			// Captions are outside of the borders of the table, the ones on top push the table down and the ones
+			// + at the bottom are added to its bottom margin so the next element is placed after them
+			var top []*element.Node
+			var bottom []*element.Node
+			for _, v := range t.captions {
+				if v.Style["caption-side"] == "bottom" {
+					bottom = append(bottom, v)
+				} else {
+					top = append(top, v)
+				}
+			}
+			self.Y += placeCaptions(top, self.X, self.Y, borderBox, state)
+
+			var x0, y0 float32
+			if collapse {
+				x0, y0 = self.X, self.Y
+			} else {
+				x0 = self.X + self.Border.Left.Width + self.Padding.Left
+				y0 = self.Y + self.Border.Top.Width + self.Padding.Top
+			}
+
+			for _, c := range t.cells {
+				old := s[c.node.Properties.Id]
+				cState := old
+				last := c.column + c.columnSpan - 1
+				bottomRow := c.row + c.rowSpan - 1
+				x := x0 + xs[c.column]
+				y := y0 + ys[c.row]
+				right := x0 + xs[last] + widths[last]
+				end := y0 + ys[bottomRow] + heights[bottomRow]
+				if collapse {
+					// The cell covers half of the shared borders around it, both cells draw the winning border
+					x -= gapsX[c.column]
+					y -= gapsY[c.row]
+					right += gapsX[last+1]
+					end += gapsY[bottomRow+1]
+					cState.Border.Left, cState.Padding.Left = b.cell(b.vertical[[2]int{c.row, c.column}], gapsX[c.column], old.Padding.Left)
+					cState.Border.Right, cState.Padding.Right = b.cell(b.vertical[[2]int{c.row, last + 1}], gapsX[last+1], old.Padding.Right)
+					cState.Border.Top, cState.Padding.Top = b.cell(b.horizontal[[2]int{c.row, c.column}], gapsY[c.row], old.Padding.Top)
+					cState.Border.Bottom, cState.Padding.Bottom = b.cell(b.horizontal[[2]int{bottomRow + 1, c.column}], gapsY[bottomRow+1], old.Padding.Bottom)
+				}
+				cState.X, cState.Y = x, y
+				cState.Width = max(0, right-x-cState.Border.Left.Width-cState.Border.Right.Width)
+				cState.Height = max(0, end-y-cState.Border.Top.Width-cState.Border.Bottom.Width)
+				(*state)[c.node.Properties.Id] = cState
+				place(c.node, old, verticalAlign(c.node.Style["vertical-align"]), state)
+			}
+
+			// Rows, groups and columns only keep their boxes for backgrounds, they have no borders or padding
+			if columnCount > 0 {
+				left := x0 + xs[0]
+				width := xs[columnCount-1] + widths[columnCount-1] - xs[0]
+				for r, row := range t.rows {
+					if row.node != nil {
+						setBox(row.node, left, y0+ys[r], width, heights[r], state)
+					}
+				}
+				for _, sec := range t.sections {
+					if sec.group == nil {
+						continue
+					}
+					if len(sec.rows) == 0 {
+						setBox(sec.group, left, y0+totalY, width, 0, state)
+						continue
+					}
+					first, last := sec.start, sec.start+len(sec.rows)-1
+					setBox(sec.group, left, y0+ys[first], width, ys[last]+heights[last]-ys[first], state)
+				}
+				if rowCount > 0 {
+					height := ys[rowCount-1] + heights[rowCount-1] - ys[0]
+					for _, v := range t.columnBoxes {
+						setBox(v.node, x0+xs[v.first], y0+ys[0], xs[v.last]+widths[v.last]-xs[v.first], height, state)
+					}
+				}
+			}
+
+			tableBottom := self.Y + self.Height + self.Border.Top.Width + self.Border.Bottom.Width
+			self.Margin.Bottom += placeCaptions(bottom, self.X, tableBottom, borderBox, state)
+
+			self.ScrollHeight = int(self.Height + self.Border.Top.Width + self.Border.Bottom.Width)
+			for _, c := range t.cells {
+				cState := s[c.node.Properties.Id]
+				self.ScrollHeight = max(self.ScrollHeight, int(cState.Y+cState.Height+cState.Border.Bottom.Width-self.Y))
+			}
+			(*state)[n.Properties.Id] = self
+		},
+	}
+}
+
+type cell struct {
+	node                *element.Node
+	row, column         int
+	rowSpan, columnSpan int
+}
+
+type row struct {
+	// node is nil for cells that are not inside of a row, they are put in a row of their own
+	node  *element.Node
+	cells []*cell
+}
+
+// section is a row group, group is nil for rows that are children of the table
+type section struct {
+	group    *element.Node
+	children []*element.Node
+	rows     []*row
+	// start is the index of the first row of the section in table.rows
+	start int
+}
+
+// columnBox is a <col> or <colgroup> and the columns it covers
+type columnBox struct {
+	node        *element.Node
+	first, last int
+}
+
+type table struct {
+	captions []*element.Node
+	// columns has the <col> (or <colgroup> without cols) of each column, the rest of the columns have none
+	columns     []*element.Node
+	columnBoxes []columnBox
+	sections    []*section
+	rows        []*row
+	cells       []*cell
+	// slots maps a row and a column to the cell covering it
+	slots       map[[2]int]*cell
+	columnCount int
+}
+
+// build splits the children of a table into captions, columns and rows. The first header group goes on top and
+// + the first footer group at the bottom, the others are treated like bodies
+func build(n *element.Node) *table {
+	t := &table{slots: map[[2]int]*cell{}}
+	var header, footer *section
+	bodies := []*section{}
+	var loose *section
+
+	for _, v := range n.Children {
+		if skip(v) {
+			continue
+		}
+		switch display := v.Style["display"]; display {
+		case "table-caption":
+			t.captions = append(t.captions, v)
+		case "table-column", "table-column-group":
+			t.addColumns(v)
+		case "table-header-group", "table-footer-group", "table-row-group":
+			loose = nil
+			sec := &section{group: v, children: v.Children}
+			if display == "table-header-group" && header == nil {
+				header = sec
+			} else if display == "table-footer-group" && footer == nil {
+				footer = sec
+			} else {
+				bodies = append(bodies, sec)
+			}
+		default:
+			if loose == nil {
+				loose = &section{}
+				bodies = append(bodies, loose)
+			}
+			loose.children = append(loose.children, v)
+		}
+	}
+
+	if header != nil {
+		t.sections = append(t.sections, header)
+	}
+	t.sections = append(t.sections, bodies...)
+	if footer != nil {
+		t.sections = append(t.sections, footer)
+	}
+
+	for _, sec := range t.sections {
+		sec.start = len(t.rows)
+		sec.rows = rows(sec.children)
+		t.rows = append(t.rows, sec.rows...)
+		t.place(sec)
+	}
+	t.columnCount = max(t.columnCount, len(t.columns))
+	return t
+}
+
+// rows groups the children of a row group into rows, cells outside of a row share one
+func rows(children []*element.Node) []*row {
+	list := []*row{}
+	var anonymous *row
+	for _, v := range children {
+		if skip(v) {
+			continue
+		}
+		if v.Style["display"] == "table-row" {
+			anonymous = nil
+			r := &row{node: v}
+			for _, c := range v.Children {
+				if !skip(c) {
+					r.cells = append(r.cells, &cell{node: c})
+				}
+			}
+			list = append(list, r)
+			continue
+		}
+		if anonymous == nil {
+			anonymous = &row{}
+			list = append(list, anonymous)
+		}
+		anonymous.cells = append(anonymous.cells, &cell{node: v})
+	}
+	return list
+}
+
+// place gives the cells of a section their slots, cells are put in the first free column and rowspans stop at
+// + the end of their section
+func (t *table) place(sec *section) {
+	end := sec.start + len(sec.rows)
+	for i, r := range sec.rows {
+		index := sec.start + i
+		column := 0
+		for _, c := range r.cells {
+			for t.slots[[2]int{index, column}] != nil {
+				column++
+			}
+			c.row, c.column = index, column
+			c.columnSpan = min(max(span(c.node, "colspan"), 1), 1000)
+			c.rowSpan = span(c.node, "rowspan")
+			if c.rowSpan == 0 || c.rowSpan > end-index {
+				c.rowSpan = end - index
+			}
+			for y := index; y < index+c.rowSpan; y++ {
+				for x := column; x < column+c.columnSpan; x++ {
+					t.slots[[2]int{y, x}] = c
+				}
+			}
+			column += c.columnSpan
+			t.columnCount = max(t.columnCount, column)
+			t.cells = append(t.cells, c)
+		}
+	}
+}
+
+// addColumns adds a <col> or a <colgroup>, a colgroup without cols is used for the columns it spans
+func (t *table) addColumns(n *element.Node) {
+	add := func(v *element.Node) {
+		count := min(max(span(v, "span"), 1), 1000)
+		first := len(t.columns)
+		for i := 0; i < count; i++ {
+			t.columns = append(t.columns, v)
+		}
+		t.columnBoxes = append(t.columnBoxes, columnBox{node: v, first: first, last: len(t.columns) - 1})
+	}
+
+	if n.Style["display"] == "table-column" {
+		add(n)
+		return
+	}
+	first := len(t.columns)
+	for _, v := range n.Children {
+		if !skip(v) && v.Style["display"] == "table-column" {
+			add(v)
+		}
+	}
+	if len(t.columns) == first {
+		add(n)
+		return
+	}
+	t.columnBoxes = append(t.columnBoxes, columnBox{node: n, first: first, last: len(t.columns) - 1})
+}
+
+// fixedWidths sizes the columns from the <col> elements and the cells of the first row, the columns without a
+// + width share what is left
+func (t *table) fixedWidths(available float32, gaps []float32, collapse bool, state *map[string]element.State) []float32 {
+	s := *state
+	widths := make([]float32, t.columnCount)
+	set := make([]bool, t.columnCount)
+
+	for i, v := range t.columns {
+		if w, ok := width(v, s[v.Properties.Id].EM, available); ok {
+			widths[i], set[i] = w, true
+		}
+	}
+	if len(t.rows) > 0 {
+		for _, c := range t.rows[0].cells {
+			cState := s[c.node.Properties.Id]
+			w, ok := width(c.node, cState.EM, available)
+			if !ok {
+				continue
+			}
+			w += outside(cState, collapse) - sum(gaps[c.column+1:c.column+c.columnSpan])
+			for i := c.column; i < c.column+c.columnSpan; i++ {
+				if !set[i] {
+					widths[i], set[i] = w/float32(c.columnSpan), true
+				}
+			}
+		}
+	}
+
+	left := available - sum(widths)
+	free := 0
+	for _, v := range set {
+		if !v {
+			free++
+		}
+	}
+	if left > 0 {
+		if free > 0 {
+			for i := range widths {
+				if !set[i] {
+					widths[i] = left / float32(free)
+				}
+			}
+		} else {
+			grow(widths, available, slices.Clone(widths))
+		}
+	}
+	return widths
+}
+
+// autoWidths sizes the columns from their content, a table without a width is as wide as its content up to the
+// + width it has
+func (t *table) autoWidths(available float32, definite bool, gaps []float32, collapse bool, state *map[string]element.State) []float32 {
+	s := *state
+	minimum := make([]float32, t.columnCount)
+	maximum := make([]float32, t.columnCount)
+	// fixed columns have a width from a <col> or a cell, they only get more space when all columns are fixed
+	fixed := make([]bool, t.columnCount)
+
+	for i, v := range t.columns {
+		if w, ok := width(v, s[v.Properties.Id].EM, available); ok {
+			minimum[i] = max(minimum[i], w)
+			maximum[i] = max(maximum[i], w)
+			fixed[i] = true
+		}
+	}
+
+	// Cells in a single column first, then the cells that span more than one
+	cells := slices.Clone(t.cells)
+	slices.SortStableFunc(cells, func(a, b *cell) int {
+		return a.columnSpan - b.columnSpan
+	})
+	for _, c := range cells {
+		cState := s[c.node.Properties.Id]
+		extra := outside(cState, collapse)
+		low := minContent(c.node, state) + extra
+		high := maxContent(c.node, state) + extra
+		w, ok := width(c.node, cState.EM, available)
+		if ok {
+			low = max(low, w+extra)
+			high = low
+		}
+		high = max(high, low)
+		if ok && c.columnSpan == 1 {
+			fixed[c.column] = true
+		}
+
+		first, last := c.column, c.column+c.columnSpan
+		between := sum(gaps[first+1 : last])
+		weights := slices.Clone(maximum[first:last])
+		grow(minimum[first:last], low-between, weights)
+		grow(maximum[first:last], high-between, weights)
+		for i := first; i < last; i++ {
+			maximum[i] = max(maximum[i], minimum[i])
+		}
+	}
+
+	low, high := sum(minimum), sum(maximum)
+	target := max(min(available, high), low)
+	if definite {
+		target = max(available, low)
+	}
+
+	if target >= high {
+		weights := slices.Clone(maximum)
+		if slices.Contains(fixed, false) {
+			// The columns without a width share the space by their size or equally when they are empty
+			for i := range weights {
+				if fixed[i] {
+					weights[i] = 0
+				}
+			}
+			if sum(weights) == 0 {
+				for i := range weights {
+					if !fixed[i] {
+						weights[i] = 1
+					}
+				}
+			}
+		}
+		grow(maximum, target, weights)
+		return maximum
+	}
+	widths := make([]float32, t.columnCount)
+	ratio := (target - low) / (high - low)
+	for i := range widths {
+		widths[i] = minimum[i] + (maximum[i]-minimum[i])*ratio
+	}
+	return widths
+}
+
+// heights sizes the rows to fit their cells, a table with a height gives what is left to all of its rows
+func (t *table) heights(n *element.Node, self element.State, gaps []float32, collapse bool, state *map[string]element.State) []float32 {
+	s := *state
+	heights := make([]float32, len(t.rows))
+	for i, r := range t.rows {
+		if r.node != nil && r.node.Style["height"] != "" {
+			heights[i] = utils.ConvertToPixels(r.node.Style["height"], s[r.node.Properties.Id].EM, self.Height)
+		}
+	}
+
+	cells := slices.Clone(t.cells)
+	slices.SortStableFunc(cells, func(a, b *cell) int {
+		return a.rowSpan - b.rowSpan
+	})
+	for _, c := range cells {
+		cState := s[c.node.Properties.Id]
+		height := cState.Height
+		if !collapse {
+			height += cState.Border.Top.Width + cState.Border.Bottom.Width
+		}
+		first, last := c.row, c.row+c.rowSpan
+		grow(heights[first:last], height-sum(gaps[first+1:last]), nil)
+	}
+
+	if n.Style["height"] != "" && len(heights) > 0 {
+		var available float32
+		if collapse {
+			available = self.Height + self.Border.Top.Width + self.Border.Bottom.Width - sum(gaps)
+		} else {
+			available = self.Height - self.Padding.Top - self.Padding.Bottom - sum(gaps)
+		}
+		grow(heights, available, nil)
+	}
+	return heights
+}
+
+// bands are the shared borders of a table with border-collapse: collapse, columns and rows have the width of each
+// + line between the columns and rows (starting with the border of the table). vertical and horizontal have the
+// + border that won each segment of a line, keyed by row and line or by line and column
+type bands struct {
+	columns    []float32
+	rows       []float32
+	vertical   map[[2]int]element.BorderSide
+	horizontal map[[2]int]element.BorderSide
+}
+
+func (t *table) collapse(border element.Border, state *map[string]element.State) bands {
+	s := *state
+	b := bands{
+		columns:    make([]float32, t.columnCount+1),
+		rows:       make([]float32, len(t.rows)+1),
+		vertical:   map[[2]int]element.BorderSide{},
+		horizontal: map[[2]int]element.BorderSide{},
+	}
+	side := func(c *cell, get func(element.Border) element.BorderSide) element.BorderSide {
+		if c == nil {
+			return element.BorderSide{}
+		}
+		return get(s[c.node.Properties.Id].Border)
+	}
+
+	for r := range t.rows {
+		for k := 0; k <= t.columnCount; k++ {
+			left, right := t.slots[[2]int{r, k - 1}], t.slots[[2]int{r, k}]
+			if left != nil && left == right {
+				continue
+			}
+			won := winner(side(left, func(b element.Border) element.BorderSide { return b.Right }), side(right, func(b element.Border) element.BorderSide { return b.Left }))
+			if k == 0 {
+				won = winner(won, border.Left)
+			}
+			if k == t.columnCount {
+				won = winner(won, border.Right)
+			}
+			b.vertical[[2]int{r, k}] = won
+			b.columns[k] = max(b.columns[k], visibleWidth(won))
+		}
+	}
+	for k := 0; k <= len(t.rows); k++ {
+		for c := 0; c < t.columnCount; c++ {
+			above, below := t.slots[[2]int{k - 1, c}], t.slots[[2]int{k, c}]
+			if above != nil && above == below {
+				continue
+			}
+			won := winner(side(above, func(b element.Border) element.BorderSide { return b.Bottom }), side(below, func(b element.Border) element.BorderSide { return b.Top }))
+			if k == 0 {
+				won = winner(won, border.Top)
+			}
+			if k == len(t.rows) {
+				won = winner(won, border.Bottom)
+			}
+			b.horizontal[[2]int{k, c}] = won
+			b.rows[k] = max(b.rows[k], visibleWidth(won))
+		}
+	}
+	return b
+}
+
+// cell returns the side a cell draws on a line of the given width. When nothing is drawn on the segment the
+// + line is added to the padding so the cell still covers it
+func (b bands) cell(won element.BorderSide, width, padding float32) (element.BorderSide, float32) {
+	if visibleWidth(won) == 0 {
+		return element.BorderSide{}, padding + width
+	}
+	won.Width = width
+	return won, padding
+}
+
+// table returns the side the table draws on its outer lines
+func (b bands) table(side element.BorderSide, width float32) element.BorderSide {
+	if visibleWidth(side) == 0 {
+		return element.BorderSide{}
+	}
+	side.Width = width
+	return side
+}
+
+// winner picks the border that is drawn when two borders collapse: hidden hides both, then the wider one and then
+// + the style. a wins ties so it should be the cell that is more to the left or the top
+func winner(a, b element.BorderSide) element.BorderSide {
+	if a.Style == "hidden" {
+		return a
+	}
+	if b.Style == "hidden" {
+		return b
+	}
+	wa, wb := visibleWidth(a), visibleWidth(b)
+	if wb > wa || (wb == wa && styleRank(b.Style) > styleRank(a.Style)) {
+		return b
+	}
+	return a
+}
+
+func visibleWidth(side element.BorderSide) float32 {
+	if side.Style == "none" || side.Style == "hidden" {
+		return 0
+	}
+	return side.Width
+}
+
+func styleRank(style string) int {
+	return slices.Index([]string{"inset", "groove", "outset", "ridge", "dotted", "dashed", "solid", "double"}, style)
+}
+
+// placeCaptions puts captions under each other from y with the width of the table and returns their height
+func placeCaptions(captions []*element.Node, x, y, width float32, state *map[string]element.State) float32 {
+	s := *state
+	var height float32
+	for _, v := range captions {
+		old := s[v.Properties.Id]
+		vState := old
+		vState.X = x + vState.Margin.Left
+		vState.Y = y + height + vState.Margin.Top
+		vState.Width = max(0, width-vState.Margin.Left-vState.Margin.Right-vState.Border.Left.Width-vState.Border.Right.Width)
+		(*state)[v.Properties.Id] = vState
+		place(v, old, 0, state)
+		height += vState.Height + vState.Margin.Top + vState.Margin.Bottom + vState.Border.Top.Width + vState.Border.Bottom.Width
+	}
+	return height
+}
+
+// place moves the children of n after its box changed from old to what is in the state. Block children get the
+// + new width, inline content keeps its text-align and is moved by align (0 top, 0.5 middle, 1 bottom) of the
+// + height that was added
+func place(n *element.Node, old element.State, align float32, state *map[string]element.State) {
+	s := *state
+	self := s[n.Properties.Id]
+
+	width := self.Width - self.Padding.Left - self.Padding.Right
+	dx := (self.X + self.Border.Left.Width + self.Padding.Left) - (old.X + old.Border.Left.Width + old.Padding.Left)
+	dy := (self.Y + self.Border.Top.Width + self.Padding.Top) - (old.Y + old.Border.Top.Width + old.Padding.Top)
+	if align > 0 {
+		dy += align * (self.Height - self.Padding.Top - self.Padding.Bottom - contentHeight(n, old, state))
+	}
+	shift := textAlign(n.Style["text-align"]) * (width - (old.Width - old.Padding.Left - old.Padding.Right))
+
+	for _, v := range n.Children {
+		if v.Style["display"] == "none" {
+			continue
+		}
+		if !isBlock(v) {
+			// Tables are blocks with their own width, text-align does not move them
+			if v.Style["display"] == "table" {
+				utils.Move(v, dx, dy, state)
+			} else {
+				utils.Move(v, dx+shift, dy, state)
+			}
+			continue
+		}
+		utils.Move(v, dx, dy, state)
+		before := s[v.Properties.Id]
+		vState := before
+		vState.Width = max(0, width-vState.Margin.Left-vState.Margin.Right-vState.Border.Left.Width-vState.Border.Right.Width)
+		(*state)[v.Properties.Id] = vState
+		place(v, before, 0, state)
+	}
+}
+
+// contentHeight is how far the children of n go down from the top of its content box
+func contentHeight(n *element.Node, self element.State, state *map[string]element.State) float32 {
+	s := *state
+	top := self.Y + self.Border.Top.Width + self.Padding.Top
+	var bottom float32
+	for _, v := range n.Children {
+		if v.Style["display"] == "none" || v.Style["position"] == "absolute" {
+			continue
+		}
+		vState := s[v.Properties.Id]
+		bottom = max(bottom, vState.Y+vState.Height+vState.Border.Top.Width+vState.Border.Bottom.Width+vState.Margin.Bottom-top)
+	}
+	return bottom
+}
+
+// setBox gives a row, group or column its box
+func setBox(n *element.Node, x, y, width, height float32, state *map[string]element.State) {
+	self := (*state)[n.Properties.Id]
+	self.X, self.Y, self.Width, self.Height = x, y, width, height
+	self.Border = element.Border{}
+	self.Padding = element.MarginPadding{}
+	(*state)[n.Properties.Id] = self
+}
+
+// isBlock reports if n takes the width of its parent
+func isBlock(n *element.Node) bool {
+	if n.TagName == "#text" || n.TagName == "img" || n.Style["width"] != "" || n.Style["position"] == "absolute" {
+		return false
+	}
+	display := n.Style["display"]
+	return !strings.HasPrefix(display, "inline") && display != "table"
+}
+
+// maxContent is the width the content of n needs without wrapping, inline children are on one line and block
+// + children are under each other
+func maxContent(n *element.Node, state *map[string]element.State) float32 {
+	s := *state
+	var widest, line float32
+	for _, v := range n.Children {
+		if v.Style["display"] == "none" || v.Style["position"] == "absolute" {
+			continue
+		}
+		vState := s[v.Properties.Id]
+		w := vState.Width
+		if v.TagName != "#text" {
+			w += vState.Margin.Left + vState.Margin.Right + vState.Border.Left.Width + vState.Border.Right.Width
+			if !fixedWidth(v) {
+				w += maxContent(v, state) - (vState.Width - vState.Padding.Left - vState.Padding.Right)
+			}
+		}
+		if v.TagName == "#text" || strings.HasPrefix(v.Style["display"], "inline") {
+			line += w
+		} else {
+			widest = max(widest, line, w)
+			line = 0
+		}
+	}
+	return max(widest, line)
+}
+
+// minContent is the width of the widest child that can't get smaller (images, tables and elements with a width).
+// + Text can't wrap again at the width of its column so it does not keep the column from shrinking
+func minContent(n *element.Node, state *map[string]element.State) float32 {
+	s := *state
+	var widest float32
+	for _, v := range n.Children {
+		if v.TagName == "#text" || v.Style["display"] == "none" || v.Style["position"] == "absolute" {
+			continue
+		}
+		vState := s[v.Properties.Id]
+		outer := vState.Margin.Left + vState.Margin.Right + vState.Border.Left.Width + vState.Border.Right.Width
+		if fixedWidth(v) {
+			widest = max(widest, vState.Width+outer)
+		} else {
+			widest = max(widest, minContent(v, state)+vState.Padding.Left+vState.Padding.Right+outer)
+		}
+	}
+	return widest
+}
+
+// fixedWidth reports if the width of n does not come from its content: images, tables (already as wide as their
+// + content) and elements with a width
+func fixedWidth(n *element.Node) bool {
+	return n.TagName == "img" || n.Style["width"] != "" || strings.HasSuffix(n.Style["display"], "table")
+}
+
+// outside is the part of a cell around its content that is in its column, with border-collapse the borders are
+// + part of the lines between the columns
+func outside(self element.State, collapse bool) float32 {
+	extra := self.Padding.Left + self.Padding.Right
+	if !collapse {
+		extra += self.Border.Left.Width + self.Border.Right.Width
+	}
+	return extra
+}
+
+// width is the width set on a cell or a column, the width attribute is used when there is none in the style
+func width(n *element.Node, em, available float32) (float32, bool) {
+	value := n.Style["width"]
+	if value == "" || value == "auto" {
+		if attribute := strings.TrimSpace(n.Attribute["width"]); attribute != "" {
+			value = attribute
+			if !strings.HasSuffix(value, "%") {
+				value += "px"
+			}
+		} else {
+			return 0, false
+		}
+	}
+	return utils.ConvertToPixels(value, em, available), true
+}
+
+// grow makes the sizes add up to at least total, the space is shared by weights or equally when they are all 0
+func grow(sizes []float32, total float32, weights []float32) {
+	extra := total - sum(sizes)
+	if extra <= 0 || len(sizes) == 0 {
+		return
+	}
+	all := sum(weights)
+	for i := range sizes {
+		if all > 0 {
+			sizes[i] += extra * weights[i] / all
+		} else {
+			sizes[i] += extra / float32(len(sizes))
+		}
+	}
+}
+
+// offsets returns where each size starts after the gap before it and the total length with the last gap
+func offsets(sizes, gaps []float32) ([]float32, float32) {
+	starts := make([]float32, len(sizes))
+	pos := gaps[0]
+	for i, v := range sizes {
+		starts[i] = pos
+		pos += v + gaps[i+1]
+	}
+	return starts, pos
+}
+
+func spacing(value string, em, width float32) (float32, float32) {
+	parts := strings.Fields(value)
+	if len(parts) == 0 {
+		return 0, 0
+	}
+	h := utils.ConvertToPixels(parts[0], em, width)
+	return h, utils.ConvertToPixels(parts[len(parts)-1], em, width)
+}
+
+func span(n *element.Node, name string) int {
+	value, err := strconv.Atoi(strings.TrimSpace(n.Attribute[name]))
+	if err != nil || value < 0 {
+		return 1
+	}
+	return value
+}
+
+func verticalAlign(value string) float32 {
+	switch value {
+	case "middle":
+		return 0.5
+	case "bottom":
+		return 1
+	}
+	return 0
+}
+
+func textAlign(value string) float32 {
+	switch value {
+	case "center":
+		return 0.5
+	case "right":
+		return 1
+	}
+	return 0
+}
+
+func skip(n *element.Node) bool {
+	// Text outside of a cell would need a cell of its own, it is left where it is
+	return n.TagName == "#text" || n.Style["display"] == "none" || n.Style["position"] == "absolute" || n.Style["position"] == "fixed"
+}
+
+func repeat(value float32, count int) []float32 {
+	list := make([]float32, count)
+	for i := range list {
+		list[i] = value
+	}
+	return list
+}
+
+func sum(list []float32) float32 {
+	var total float32
+	for _, v := range list {
+		total += v
+	}
+	return total
+}
@@ -0,0 +1,114 @@
+package table_test
+
+import (
+	"fmt"
+	"gui"
+	"gui/adapters/headless"
+	"gui/element"
+	"gui/font"
+	"testing"
+)
+
+// box is an inline block with a set width so the max-content of a cell doesn't depend on the fonts of the system
+func box(width int) string {
+	return fmt.Sprintf("<span style=\"display: inline-block; width: %dpx; height: 20px\"></span>", width)
+}
+
+// layout opens a page with a body without margins in the headless runtime and returns the boxes of the ids
+func layout(t *testing.T, style, body string, ids ...string) [][4]float32 {
+	page := "<html><head><style>body { margin: 0 } " + style + "</style></head><body>" + body + "</body></html>"
+	w, err := gui.OpenString(page, headless.Init().Adapter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gui.NewRuntime(&w, 600, 400)
+	defer r.Close()
+	r.Step()
+
+	boxes := [][4]float32{}
+	for _, id := range ids {
+		s := w.Document.QuerySelector("#" + id).Properties.State
+		boxes = append(boxes, [4]float32{s.X, s.Y, s.Width, s.Height})
+	}
+	return boxes
+}
+
+func near(a, b [4]float32) bool {
+	for i := range a {
+		if a[i]-b[i] > 0.01 || b[i]-a[i] > 0.01 {
+			return false
+		}
+	}
+	return true
+}
+
+// TestTable lays tables out in the headless runtime and checks the x, y, width and height of their cells
+func TestTable(t *testing.T) {
+	row := "<table><tr><td id=\"a\">" + box(45) + "</td><td id=\"b\">" + box(292) + "</td></tr></table>"
+	tests := []struct {
+		name  string
+		style string
+		body  string
+		want  [][4]float32
+	}{
+		// The cells have 1px of padding and there are 2px between them and the edge of the table
+		{"auto widths", "", row,
+			[][4]float32{{2, 2, 47, 22}, {51, 2, 294, 22}}},
+		// The 33px left after the 2px gaps are shared by the max-content of the columns
+		{"table width", "table { width: 380px }", row,
+			[][4]float32{{2, 2, 51.548386, 22}, {55.548386, 2, 322.4516, 22}}},
+		{"fixed layout", "table { width: 380px; table-layout: fixed }",
+			"<table><tr><td id=\"a\" style=\"width: 100px\">" + box(45) + "</td><td id=\"b\">" + box(45) + "</td></tr></table>",
+			[][4]float32{{2, 2, 102, 22}, {106, 2, 272, 22}}},
+		{"row heights", "",
+			"<table><tr style=\"height: 40px\"><td id=\"a\">" + box(45) + "</td></tr><tr><td id=\"b\">" + box(45) + "</td></tr></table>",
+			[][4]float32{{2, 2, 47, 40}, {2, 44, 47, 22}}},
+		{"border-spacing", "table { border-spacing: 10px 4px }",
+			"<table><tr><td id=\"a\">" + box(45) + "</td><td id=\"b\">" + box(45) + "</td></tr><tr><td id=\"c\">" + box(45) + "</td><td id=\"d\">" + box(45) + "</td></tr></table>",
+			[][4]float32{{10, 4, 47, 22}, {67, 4, 47, 22}, {10, 30, 47, 22}, {67, 30, 47, 22}}},
+		{"display table", ".t { display: table } .r { display: table-row } .c { display: table-cell; padding: 1px }",
+			"<div class=\"t\"><div class=\"r\"><div class=\"c\" id=\"a\">" + box(45) + "</div><div class=\"c\" id=\"b\">" + box(292) + "</div></div></div>",
+			[][4]float32{{0, 0, 47, 22}, {47, 0, 294, 22}}},
+	}
+	for _, test := range tests {
+		ids := []string{"a", "b", "c", "d"}[:len(test.want)]
+		for i, got := range layout(t, test.style, test.body, ids...) {
+			if !near(got, test.want[i]) {
+				t.Errorf("%s: #%s is at %v, want %v", test.name, ids[i], got, test.want[i])
+			}
+		}
+	}
+}
+
+// TestTableText sizes the columns from the text in the cells, the widths are measured with the same font as the
+// + page uses
+func TestTableText(t *testing.T) {
+	f, err := font.LoadFont("serif", 16, 400, false)
+	if err != nil {
+		t.Skip("no serif font:", err)
+	}
+	short, long := "Id", "A longer description of the row"
+	text := element.Text{Font: &f}
+	text.WordSpacing = font.MeasureSpace(&text)
+	narrow := float32(font.MeasureText(&text, short)) + 2
+	wide := float32(font.MeasureText(&text, long)) + 2
+	row := "<table><tr><td id=\"a\">" + short + "</td><td id=\"b\">" + long + "</td></tr></table>"
+
+	got := layout(t, "", row, "a", "b")
+	if got[0][2] != narrow || got[1][2] != wide {
+		t.Errorf("columns are %v and %v wide, want %v and %v", got[0][2], got[1][2], narrow, wide)
+	}
+
+	// The space left after the three 2px gaps is shared by the widths of the text
+	extra := 380 - 6 - narrow - wide
+	got = layout(t, "table { width: 380px }", row, "a", "b")
+	want := [][4]float32{
+		{2, 2, narrow + extra*narrow/(narrow+wide), got[0][3]},
+		{4 + narrow + extra*narrow/(narrow+wide), 2, wide + extra*wide/(narrow+wide), got[1][3]},
+	}
+	for i := range want {
+		if !near(got[i], want[i]) {
+			t.Errorf("in a 380px table column %d is at %v, want %v", i, got[i], want[i])
+		}
+	}
+}
@@ -31,7 +31,9 @@ func Init() cstyle.Plugin {
 			for _, v := range n.Children {
 				// This prevents using absolutely positionioned elements in the alignment of text
 				// + Will need to add the other styles
-				if v.Style["position"] != "absolute" {
+				// + Tables are blocks with their own width, they stay at the start of the line
+				// + Floats are placed by the float plugin
+				if v.Style["position"] != "absolute" && v.Style["display"] != "table" && v.Style["float"] != "left" && v.Style["float"] != "right" {
 					nChildren = append(nChildren, v)
 				}
 			}
@@ -0,0 +1,19 @@
+package alt
+
+import (
+	"gui/cstyle"
+	"gui/element"
+)
+
+// Init shows the alt text of a <img> that could not be loaded
+func Init() cstyle.Transformer {
+	return cstyle.Transformer{
+		Selector: func(n *element.Node) bool {
+			return n.TagName == "img" && n.Image == nil && n.GetAttribute("alt") != ""
+		},
+		Handler: func(n *element.Node, c *cstyle.CSS) *element.Node {
+			n.InnerText = n.GetAttribute("alt")
+			return n
+		},
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"gui/font"
 	"gui/utils"
 	"strconv"
+	"strings"
 
 	imgFont "golang.org/x/image/font"
 )
@@ -20,7 +21,12 @@ func Init() cstyle.Transformer {
 			tN := n.CreateElement(n.TagName)
 			var maxOS int
 			var widths []int
-			for i, v := range n.Children {
+			for _, v := range n.Children {
+				// Whitespace between the list items
+				if v.TagName == "#text" && strings.TrimSpace(v.InnerText) == "" {
+					continue
+				}
+				i := len(tN.Children)
 				li := n.CreateElement("li")
 
 				li.Style = v.Style
@@ -4,57 +4,95 @@ import (
 	"gui/cstyle"
 	"gui/element"
 	"gui/utils"
-	"html"
 	"strings"
 )
 
 func Init() cstyle.Transformer {
 	return cstyle.Transformer{
 		Selector: func(n *element.Node) bool {
-			if !utils.ChildrenHaveText(n) && len(strings.TrimSpace(n.InnerText)) > 0 {
-				return true
-			} else {
+			if n.TagName == "#text" {
 				return false
 			}
+			if hasTextNodes(n) {
+				return true
+			}
+			// Nodes made by other transformers only have InnerText
+			return len(n.Children) == 0 && len(strings.TrimSpace(n.InnerText)) > 0
 		},
 		Handler: func(n *element.Node, c *cstyle.CSS) *element.Node {
 			if utils.IsParent(*n, "head") {
 				return n
 			}
-			words := strings.Split(strings.TrimSpace(n.InnerText), " ")
-			n.InnerText = ""
-			if n.Style["display"] == "inline" {
-				n.InnerText = DecodeHTMLEscapes(words[0])
-				for i := 0; i < len(words)-1; i++ {
-					// Add the words backwards because you are inserting adjacent to the parent
-					a := (len(words) - 1) - i
-					if len(strings.TrimSpace(words[a])) > 0 {
-						el := n.CreateElement("notaspan")
-						el.InnerText = DecodeHTMLEscapes(words[a])
-						el.Parent = n
+			if !hasTextNodes(n) {
+				t := n.CreateTextNode(n.InnerText)
+				n.Children = []*element.Node{}
+				n.AppendChild(&t)
+			}
 
-						el.Style = c.QuickStyles(&el)
-						el.Style["display"] = "inline"
-						// el.Style["margin-top"] = "10px"
+			whiteSpace := n.Style["white-space"]
+			collapsible := whiteSpace == "" || whiteSpace == "normal" || whiteSpace == "nowrap" || whiteSpace == "pre-line"
+			children := n.Children
+			n.Children = []*element.Node{}
+
+			// lastSpace stops a space from following another space across text nodes
+			lastSpace := true
+			for i, v := range children {
+				if v.TagName != "#text" {
+					n.Children = append(n.Children, v)
+					lastSpace = !isInline(v)
+					continue
+				}
 
-						n.Parent.InsertAfter(&el, n)
+				text := collapse(v.InnerText, whiteSpace)
+				if collapsible {
+					// Spaces at the start or end of a line are removed
+					if lastSpace || blockEdge(n, children, i-1) {
+						text = strings.TrimLeft(text, " ")
 					}
+					if blockEdge(n, children, i+1) {
+						text = strings.TrimRight(text, " ")
+					}
+					if n.Style["display"] == "flex" && strings.TrimSpace(text) == "" {
+						text = ""
+					}
+				}
+				if text == "" {
+					continue
 				}
+				lastSpace = text[len(text)-1] == ' '
 
-			} else {
-				for i := 0; i < len(words); i++ {
-					if len(strings.TrimSpace(words[i])) > 0 {
-						el := n.CreateElement("notaspan")
-						el.InnerText = DecodeHTMLEscapes(words[i])
+				for _, w := range split(text, whiteSpace) {
+					var el element.Node
+					if w == "\n" {
+						el = n.CreateElement("br")
+						el.Parent = n
+						el.Style = c.QuickStyles(&el)
+						el.Style["display"] = "block"
+						el.Style["font-size"] = "0"
+						el.Style["height"] = "0px"
+					} else {
+						el = n.CreateTextNode(w)
 						el.Parent = n
-
 						el.Style = c.QuickStyles(&el)
 						el.Style["display"] = "inline"
 						el.Style["font-size"] = "1em"
-						// el.Style["margin-top"] = "10px"
-
-						n.AppendChild(&el)
 					}
+					n.AppendChild(&el)
+				}
+			}
+
+			// Inline elements that only hold text give their words to the parent so they can wrap with the text around them
+			if n.Style["display"] == "inline" && n.Parent != nil && len(n.Children) > 0 && !hasElements(n) {
+				words := n.Children
+				n.Children = []*element.Node{}
+				n.InnerText = words[0].InnerText
+				for i := len(words) - 1; i > 0; i-- {
+					// Add the words backwards because you are inserting adjacent to the parent
+					el := n.CreateTextNode(words[i].InnerText)
+					el.Parent = n
+					el.Style = c.QuickStyles(&el)
+					el.Style["display"] = "inline"
+					n.Parent.InsertAfter(&el, n)
 				}
 			}
 
@@ -63,6 +101,98 @@ func Init() cstyle.Transformer {
 	}
 }
 
-func DecodeHTMLEscapes(input string) string {
-	return html.UnescapeString(input)
+func hasTextNodes(n *element.Node) bool {
+	for _, v := range n.Children {
+		if v.TagName == "#text" {
+			return true
+		}
+	}
+	return false
+}
+
+func hasElements(n *element.Node) bool {
+	for _, v := range n.Children {
+		if v.TagName != "#text" {
+			return true
+		}
+	}
+	return false
+}
+
+func isInline(n *element.Node) bool {
+	d := n.Style["display"]
+	return n.TagName != "br" && (d == "inline" || d == "inline-block" || d == "inline-flex")
+}
+
+// blockEdge is true when the child at i starts a new line, or when i is outside of a parent that isn't inline
+func blockEdge(n *element.Node, children []*element.Node, i int) bool {
+	if i < 0 || i >= len(children) {
+		return n.Style["display"] != "inline"
+	}
+	return children[i].TagName != "#text" && !isInline(children[i])
+}
+
+// collapse applies the white-space rules to text, newlines that are kept are left as "\n"
+func collapse(text, whiteSpace string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	switch whiteSpace {
+	case "pre", "pre-wrap", "break-spaces":
+		return strings.ReplaceAll(text, "\t", "        ")
+	case "pre-line":
+		lines := strings.Split(text, "\n")
+		for i, v := range lines {
+			lines[i] = strings.Join(strings.Fields(v), " ")
+		}
+		return strings.Join(lines, "\n")
+	default:
+		var b strings.Builder
+		space := false
+		for _, r := range text {
+			if r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f' {
+				space = true
+				continue
+			}
+			if space {
+				b.WriteByte(' ')
+				space = false
+			}
+			b.WriteRune(r)
+		}
+		if space {
+			b.WriteByte(' ')
+		}
+		return b.String()
+	}
+}
+
+// split breaks text into the pieces a line can wrap between, each word keeps the spaces after it
+// + and forced line breaks are returned as "\n"
+func split(text, whiteSpace string) []string {
+	lines := strings.Split(text, "\n")
+	pieces := []string{}
+	for i, line := range lines {
+		if i > 0 {
+			pieces = append(pieces, "\n")
+		}
+		if line == "" {
+			if i > 0 && i < len(lines)-1 {
+				// Keep the height of empty lines
+				pieces = append(pieces, " ")
+			}
+			continue
+		}
+		if whiteSpace == "pre" || whiteSpace == "nowrap" {
+			pieces = append(pieces, line)
+			continue
+		}
+		start := 0
+		for j := 1; j < len(line); j++ {
+			if line[j-1] == ' ' && line[j] != ' ' {
+				pieces = append(pieces, line[start:j])
+				start = j
+			}
+		}
+		pieces = append(pieces, line[start:])
+	}
+	return pieces
 }
@@ -3,6 +3,7 @@ package ul
 import (
 	"gui/cstyle"
 	"gui/element"
+	"strings"
 )
 
 func Init() cstyle.Transformer {
@@ -17,6 +18,10 @@ func Init() cstyle.Transformer {
 			// !ISSUE: make stylable
 			tN := n.CreateElement(n.TagName)
 			for _, v := range n.Children {
+				// Whitespace between the list items
+				if v.TagName == "#text" && strings.TrimSpace(v.InnerText) == "" {
+					continue
+				}
 				li := n.CreateElement("li")
 				li.Style = v.Style
 				dot := li.CreateElement("div")
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"gui/canvas"
 	"gui/selector"
+	"image"
 	ic "image/color"
 	"math"
 	"slices"
@@ -37,6 +38,7 @@ type Node struct {
 	// + if you  want the smae scrollHeight like js the add the height of the element to it
 	ScrollHeight   int
 	Canvas         *canvas.Canvas
+	Image          *image.RGBA `json:"-"`
 	PseudoElements map[string]map[string]string
 
 	Value         string
@@ -53,13 +55,15 @@ type Node struct {
 }
 
 type State struct {
-	X               float32
-	Y               float32
-	Z               float32
-	Width           float32
-	Height          float32
-	Border          Border
-	Textures        []string
+	X        float32
+	Y        float32
+	Z        float32
+	Width    float32
+	Height   float32
+	Border   Border
+	Textures []string
+	// ImageTexture is the one of the Textures that holds the picture of an <img>
+	ImageTexture    string
 	EM              float32
 	Background      ic.RGBA
 	Margin          MarginPadding
@@ -80,6 +84,22 @@ type Crop struct {
 	Height int
 }
 
+// DOMRect is the border box of a node relative to the window and the sizes around it, see GetBoundingClientRect
+type DOMRect struct {
+	X      float32
+	Y      float32
+	Width  float32
+	Height float32
+	Top    float32
+	Right  float32
+	Bottom float32
+	Left   float32
+	// Margin, Padding and Border are in px, Border has the style and color of each side too
+	Margin  MarginPadding
+	Padding MarginPadding
+	Border  Border
+}
+
 // !FLAG: I would like to remove element.Node.Properties if possible but I don't think it is
 
 type Properties struct {
@@ -89,11 +109,49 @@ type Properties struct {
 	Hover          bool
 	// !TODO: After focus
 	Selected []float32
+	// Dirty is set when the node has to be restyled, DirtyLayout when it or one of its children has to be laid out again
+	Dirty       bool
+	DirtyLayout bool
+	// Computed holds the styles from the last time the node was restyled
+	Computed       map[string]string            `json:"-"`
+	ComputedPseudo map[string]map[string]string `json:"-"`
+	// ImageSrc is the src Image was last loaded from
+	ImageSrc string
+	// State is the layout of the node, the window copies it after every layout
+	State State `json:"-"`
+	// Floats are the floats that have been placed in the block formatting context the node starts, in the order
+	// + they are in the document
+	Floats []*Node `json:"-"`
+	// Layout is the copy of the node that was laid out last, it is laid out again from its Cache while the node and
+	// + its children are clean
+	Layout *Node `json:"-"`
+	// Cache is set on the copy by ComputeNodeStyle
+	Cache *Cache `json:"-"`
+}
+
+// Cache is the state of a node at each step of ComputeNodeStyle. A clean node that starts out the same as last time
+// + (it can have moved) is restored from it without being laid out again
+type Cache struct {
+	// Parent is the state of the parent while the node was laid out
+	Parent State
+	// Start is the box of the node before its text and children, Mid is its state while the children are laid out and
+	// + Done is its state once the plugins have run
+	Start State
+	Mid   State
+	Done  State
+	// States are the states of everything in the node in document order once the plugins of the node have moved
+	// + them, nil when no plugin ran on it. The children are restored from their own cache then
+	States []State
+	// Floats is set when there were floats in the block formatting context of the node before or after it
+	Floats bool
+	// Reach is how many levels above the node the absolute and fixed elements in it are placed against
+	Reach int
 }
 
 type ClassList struct {
 	Classes []string
 	Value   string
+	node    *Node
 }
 
 type MarginPadding struct {
@@ -107,6 +165,9 @@ func (c *ClassList) Add(class string) {
 	if !slices.Contains(c.Classes, class) {
 		c.Classes = append(c.Classes, class)
 		c.Value = strings.Join(c.Classes, " ")
+		if c.node != nil {
+			c.node.MarkDirty()
+		}
 	}
 }
 
@@ -114,11 +175,13 @@ func (c *ClassList) Remove(class string) {
 	for i, v := range c.Classes {
 		if v == class {
 			c.Classes = append(c.Classes[:i], c.Classes[i+1:]...)
+			c.Value = strings.Join(c.Classes, " ")
+			if c.node != nil {
+				c.node.MarkDirty()
+			}
 			break
 		}
 	}
-
-	c.Value = strings.Join(c.Classes, " ")
 }
 
 type Border struct {
@@ -173,12 +236,82 @@ type Shadow struct {
 	Color ic.RGBA
 }
 
+// GetBoundingClientRect returns the box of n from the last layout, it is empty until the node has been laid out
+func (n *Node) GetBoundingClientRect() DOMRect {
+	s := n.Properties.State
+	rect := DOMRect{
+		X:       s.X,
+		Y:       s.Y,
+		Width:   s.Width + s.Border.Left.Width + s.Border.Right.Width,
+		Height:  s.Height + s.Border.Top.Width + s.Border.Bottom.Width,
+		Margin:  s.Margin,
+		Padding: s.Padding,
+		Border:  s.Border,
+	}
+	rect.Top, rect.Left = rect.Y, rect.X
+	rect.Bottom, rect.Right = rect.Y+rect.Height, rect.X+rect.Width
+	return rect
+}
+
 func (n *Node) GetAttribute(name string) string {
 	return n.Attribute[name]
 }
 
 func (n *Node) SetAttribute(key, value string) {
 	n.Attribute[key] = value
+	n.MarkDirty()
+}
+
+// SetStyle sets a inline style, an empty value removes it. Writing to n.Style directly will not be picked up
+// + until something else marks the node dirty
+func (n *Node) SetStyle(key, value string) {
+	if value == "" {
+		delete(n.Style, key)
+	} else {
+		n.Style[key] = value
+	}
+	n.MarkDirty()
+}
+
+// SetSrc changes the src of a <img>, it is loaded before the next layout
+func (n *Node) SetSrc(src string) {
+	n.Src = src
+	n.MarkDirty()
+}
+
+// SetInnerText replaces the children of n with a single text node
+func (n *Node) SetInnerText(text string) {
+	n.InnerText = text
+	if n.TagName != "#text" {
+		n.Children = []*Node{}
+		if text != "" {
+			t := n.CreateTextNode(text)
+			n.AppendChild(&t)
+		}
+	}
+	n.MarkDirty()
+}
+
+// MarkDirty flags the node to be restyled and laid out on the next frame, its ancestors are flagged to be laid out.
+// + Only the node and its children go through the cascade again, the nodes around it are restored from their Cache
+func (n *Node) MarkDirty() {
+	n.Properties.Dirty = true
+	n.MarkLayoutDirty()
+}
+
+// MarkLayoutDirty flags the node and its ancestors to be laid out again without restyling them
+func (n *Node) MarkLayoutDirty() {
+	n.Properties.DirtyLayout = true
+	for p := n.Parent; p != nil && !p.Properties.DirtyLayout; p = p.Parent {
+		p.Properties.DirtyLayout = true
+	}
+}
+
+// CreateTextNode makes a #text node, it can't be selected and only inherits its styles from the parent
+func (n *Node) CreateTextNode(text string) Node {
+	t := n.CreateElement("#text")
+	t.InnerText = text
+	return t
 }
 
 func (n *Node) CreateElement(name string) Node {
@@ -225,70 +358,368 @@ func (n *Node) CreateElement(name string) Node {
 			EventListeners: make(map[string][]func(Event)),
 			Hover:          false,
 			Selected:       []float32{},
+			Dirty:          true,
+			DirtyLayout:    true,
 		},
 	}
 }
 
 func (n *Node) QuerySelectorAll(selectString string) *[]*Node {
 	results := []*Node{}
-	if TestSelector(selectString, n) {
-		results = append(results, n)
+	list, err := selector.Parse(selectString)
+	if err != nil {
+		return &results
 	}
+	n.querySelectorAll(list, &results)
+	return &results
+}
 
-	for i := range n.Children {
-		el := n.Children[i]
-		cr := el.QuerySelectorAll(selectString)
-		if len(*cr) > 0 {
-			results = append(results, *cr...)
-		}
+func (n *Node) querySelectorAll(list selector.List, results *[]*Node) {
+	if n.Matches(list) {
+		*results = append(*results, n)
+	}
+	for _, v := range n.Children {
+		v.querySelectorAll(list, results)
 	}
-	return &results
 }
 
 func (n *Node) QuerySelector(selectString string) *Node {
-	if TestSelector(selectString, n) {
-		return n
+	list, err := selector.Parse(selectString)
+	if err != nil {
+		return &Node{}
 	}
+	if found := n.querySelector(list); found != nil {
+		return found
+	}
+	return &Node{}
+}
 
-	for i := range n.Children {
-		el := n.Children[i]
-		cr := el.QuerySelector(selectString)
-		if cr.Properties.Id != "" {
-			return cr
+func (n *Node) querySelector(list selector.List) *Node {
+	if n.Matches(list) {
+		return n
+	}
+	for _, v := range n.Children {
+		if found := v.querySelector(list); found != nil {
+			return found
 		}
 	}
-
-	return &Node{}
+	return nil
 }
 
+// TestSelector reports if n matches selectString, a selector that can't be parsed matches nothing
 func TestSelector(selectString string, n *Node) bool {
-	parts := strings.Split(selectString, ">")
+	list, err := selector.Parse(selectString)
+	if err != nil {
+		return false
+	}
+	return n.Matches(list)
+}
+
+// Matches reports if any selector in the list matches n, pseudo-elements are ignored
+func (n *Node) Matches(list selector.List) bool {
+	return matchList(list, n, nil)
+}
 
-	selectors := []string{}
+func (n *Node) MatchesSelector(s selector.Selector) bool {
+	return matchComplex(s, len(s.Compounds)-1, n, nil)
+}
 
-	selectors = append(selectors, n.TagName)
+// matchList matches the selectors of a list, scope is the node :has is being tested on (nil outside of :has)
+func matchList(list selector.List, n, scope *Node) bool {
+	for _, v := range list {
+		if matchComplex(v, len(v.Compounds)-1, n, scope) {
+			return true
+		}
+	}
+	return false
+}
 
-	if n.Id != "" {
-		selectors = append(selectors, "#"+n.Id)
+// matchComplex matches the compound at i against n and walks the combinators to the left of it
+func matchComplex(s selector.Selector, i int, n, scope *Node) bool {
+	if !matchCompound(s.Compounds[i], n, scope) {
+		return false
+	}
+	if i == 0 {
+		return true
 	}
 
-	for _, class := range n.ClassList.Classes {
-		if class[0] == ':' {
-			selectors = append(selectors, class)
+	switch s.Combinators[i-1] {
+	case selector.Child:
+		p := n.Parent
+		return isElement(p) && matchComplex(s, i-1, p, scope)
+	case selector.Descendant:
+		for p := n.Parent; isElement(p); p = p.Parent {
+			if matchComplex(s, i-1, p, scope) {
+				return true
+			}
+		}
+	case selector.NextSibling:
+		prev := n.PreviousElementSibling()
+		return prev != nil && matchComplex(s, i-1, prev, scope)
+	case selector.SubsequentSibling:
+		for prev := n.PreviousElementSibling(); prev != nil; prev = prev.PreviousElementSibling() {
+			if matchComplex(s, i-1, prev, scope) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchCompound(c selector.Compound, n, scope *Node) bool {
+	if !isElement(n) {
+		return false
+	}
+	if c.Tag != "" && c.Tag != "*" && !strings.EqualFold(c.Tag, n.TagName) {
+		return false
+	}
+	if c.Id != "" && c.Id != n.Id {
+		return false
+	}
+	for _, v := range c.Classes {
+		if !slices.Contains(n.ClassList.Classes, v) {
+			return false
+		}
+	}
+	for _, v := range c.Attributes {
+		if !v.Match(n.attributeValue(v.Name)) {
+			return false
+		}
+	}
+	for _, v := range c.Pseudo {
+		if !matchPseudo(v, n, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchPseudo tests a pseudo-class against the tree, the ones it doesn't know are states like :hover and :active
+// + that the event monitor adds to the ClassList
+func matchPseudo(p selector.Pseudo, n, scope *Node) bool {
+	switch p.Name {
+	case "not":
+		return !matchList(p.Selectors, n, scope)
+	case "is", "where", "matches":
+		return matchList(p.Selectors, n, scope)
+	case "has":
+		return matchHas(p.Selectors, n)
+	case "scope":
+		if scope == nil {
+			return isRoot(n)
+		}
+		return sameNode(n, scope)
+	case "root":
+		return isRoot(n)
+	case "empty":
+		for _, v := range n.Children {
+			if v.TagName != "#text" || v.InnerText != "" {
+				return false
+			}
+		}
+		return true
+	case "first-child", "nth-child":
+		return p.Nth(siblingIndex(n, false, func(v *Node) bool {
+			return len(p.Selectors) == 0 || matchList(p.Selectors, v, scope)
+		}))
+	case "last-child", "nth-last-child":
+		return p.Nth(siblingIndex(n, true, func(v *Node) bool {
+			return len(p.Selectors) == 0 || matchList(p.Selectors, v, scope)
+		}))
+	case "only-child":
+		return n.PreviousElementSibling() == nil && n.NextElementSibling() == nil
+	case "first-of-type", "nth-of-type":
+		return p.Nth(siblingIndex(n, false, func(v *Node) bool {
+			return strings.EqualFold(v.TagName, n.TagName)
+		}))
+	case "last-of-type", "nth-last-of-type":
+		return p.Nth(siblingIndex(n, true, func(v *Node) bool {
+			return strings.EqualFold(v.TagName, n.TagName)
+		}))
+	case "only-of-type":
+		sameType := func(v *Node) bool {
+			return strings.EqualFold(v.TagName, n.TagName)
+		}
+		return siblingIndex(n, false, sameType) == 1 && siblingIndex(n, true, sameType) == 1
+	case "checked":
+		switch strings.ToLower(n.TagName) {
+		case "input":
+			_, checked := n.Attribute["checked"]
+			t := strings.ToLower(n.Attribute["type"])
+			return checked && (t == "checkbox" || t == "radio")
+		case "option":
+			_, selected := n.Attribute["selected"]
+			return selected
+		}
+		return false
+	case "disabled":
+		return isDisabled(n)
+	case "enabled":
+		return isFormControl(n) && !isDisabled(n)
+	case "focus-within":
+		return hasFocus(n)
+	}
+	return slices.Contains(n.ClassList.Classes, ":"+p.Name)
+}
+
+// matchHas looks for a node matching one of the relative selectors of :has, they start from n so only the nodes
+// + after or inside of it are searched
+func matchHas(list selector.List, n *Node) bool {
+	for _, v := range list {
+		var found bool
+		last := len(v.Compounds) - 1
+		test := func(c *Node) bool {
+			found = matchComplex(v, last, c, n)
+			return found
+		}
+		if v.Combinators[0] == selector.Descendant || v.Combinators[0] == selector.Child {
+			walk(n.Children, test)
 		} else {
-			selectors = append(selectors, "."+class)
+			for next := n.NextElementSibling(); next != nil && !found; next = next.NextElementSibling() {
+				if !test(next) {
+					walk(next.Children, test)
+				}
+			}
+		}
+		if found {
+			return true
 		}
 	}
+	return false
+}
 
-	part := selector.SplitSelector(strings.TrimSpace(parts[len(parts)-1]))
-	// fmt.Println(part)
+// walk calls f on the nodes and their descendants until it returns true
+func walk(nodes []*Node, f func(*Node) bool) bool {
+	for _, v := range nodes {
+		if f(v) || walk(v.Children, f) {
+			return true
+		}
+	}
+	return false
+}
 
-	has := selector.Contains(part, selectors)
+// siblingIndex is the 1 based position of n among the element siblings that pass filter, counted from the end
+// + when reverse is set. It is 0 when n doesn't pass the filter itself
+func siblingIndex(n *Node, reverse bool, filter func(*Node) bool) int {
+	if !filter(n) {
+		return 0
+	}
+	step := (*Node).PreviousElementSibling
+	if reverse {
+		step = (*Node).NextElementSibling
+	}
+	index := 1
+	for v := step(n); v != nil; v = step(v) {
+		if filter(v) {
+			index++
+		}
+	}
+	return index
+}
 
-	if len(parts) == 1 || !has {
-		return has
+// sameNode compares nodes by their id as well, the styled tree is made of copies of the document nodes
+func sameNode(a, b *Node) bool {
+	return a == b || a.Properties.Id != "" && a.Properties.Id == b.Properties.Id
+}
+
+func isRoot(n *Node) bool {
+	return isElement(n) && !isElement(n.Parent)
+}
+
+func isFormControl(n *Node) bool {
+	switch strings.ToLower(n.TagName) {
+	case "button", "input", "select", "textarea", "optgroup", "option", "fieldset":
+		return true
+	}
+	return false
+}
+
+// isDisabled is true for form controls with the disabled attribute or inside a disabled fieldset
+func isDisabled(n *Node) bool {
+	if !isFormControl(n) {
+		return false
+	}
+	for p := n; isElement(p); p = p.Parent {
+		if _, disabled := p.Attribute["disabled"]; disabled && (p == n || strings.EqualFold(p.TagName, "fieldset")) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasFocus(n *Node) bool {
+	if slices.Contains(n.ClassList.Classes, ":focus") {
+		return true
+	}
+	return walk(n.Children, func(v *Node) bool {
+		return slices.Contains(v.ClassList.Classes, ":focus")
+	})
+}
+
+// attributeValue looks up a attribute for selectors, the ones CreateNode moves to their own field are read from there
+func (n *Node) attributeValue(name string) (string, bool) {
+	switch name {
+	case "id":
+		return n.Id, n.Id != ""
+	case "class":
+		classes := []string{}
+		for _, v := range n.ClassList.Classes {
+			if v != "" && v[0] != ':' {
+				classes = append(classes, v)
+			}
+		}
+		return strings.Join(classes, " "), len(classes) > 0
+	case "href":
+		return n.Href, n.Href != ""
+	case "src":
+		return n.Src, n.Src != ""
+	case "title":
+		return n.Title, n.Title != ""
+	case "contenteditable":
+		if n.ContentEditable {
+			return "true", true
+		}
 	}
-	return TestSelector(strings.Join(parts[:len(parts)-1], ">"), n.Parent)
+	value, has := n.Attribute[name]
+	return value, has
+}
+
+// isElement is false for text nodes and the ROOT node holding the document
+func isElement(n *Node) bool {
+	return n != nil && n.TagName != "#text" && n.TagName != "ROOT" && n.TagName != ""
+}
+
+// PreviousElementSibling is the element before n in its parent, text nodes are skipped
+func (n *Node) PreviousElementSibling() *Node {
+	if n.Parent == nil {
+		return nil
+	}
+	var prev *Node
+	for _, v := range n.Parent.Children {
+		if v == n {
+			return prev
+		}
+		if isElement(v) {
+			prev = v
+		}
+	}
+	return nil
+}
+
+// NextElementSibling is the element after n in its parent, text nodes are skipped
+func (n *Node) NextElementSibling() *Node {
+	if n.Parent == nil {
+		return nil
+	}
+	found := false
+	for _, v := range n.Parent.Children {
+		if v == n {
+			found = true
+		} else if found && isElement(v) {
+			return v
+		}
+	}
+	return nil
 }
 
 var (
@@ -308,13 +739,17 @@ func generateUniqueId(tagName string) string {
 
 func (n *Node) AppendChild(c *Node) {
 	c.Parent = n
+	c.ClassList.node = c
 	c.Properties.Id = generateUniqueId(c.TagName)
 	n.Children = append(n.Children, c)
+	c.MarkDirty()
 }
 
 func (n *Node) InsertAfter(c, tgt *Node) {
 	c.Parent = n
+	c.ClassList.node = c
 	c.Properties.Id = generateUniqueId(c.TagName)
+	c.MarkDirty()
 
 	nodeIndex := -1
 	for i, v := range n.Children {
@@ -332,9 +767,11 @@ func (n *Node) InsertAfter(c, tgt *Node) {
 
 func (n *Node) InsertBefore(c, tgt *Node) {
 	c.Parent = n
+	c.ClassList.node = c
 	// Set Id
 
 	c.Properties.Id = generateUniqueId(c.TagName)
+	c.MarkDirty()
 
 	nodeIndex := -1
 	for i, v := range n.Children {
@@ -361,6 +798,7 @@ func (n *Node) Remove() {
 	}
 	if nodeIndex > 0 {
 		n.Parent.Children = append(n.Parent.Children[:nodeIndex], n.Parent.Children[nodeIndex+1:]...)
+		n.Parent.MarkLayoutDirty()
 	}
 }
 
@@ -380,17 +818,22 @@ func (n *Node) Blur() {
 	n.ClassList.Remove(":focus")
 }
 
+// GetContext gives the node a canvas to draw on, call MarkDirty after drawing to show the changes
 func (n *Node) GetContext(width, height int) *canvas.Canvas {
 	n.Style["width"] = strconv.Itoa(width) + "px"
 	n.Style["height"] = strconv.Itoa(height) + "px"
 	ctx := canvas.NewCanvas(width, height)
 	n.Canvas = ctx
+	n.MarkDirty()
 	return ctx
 }
 
 func (n *Node) ScrollTo(x, y int) {
-	n.ScrollTop = y
-	n.ScrollLeft = x
+	if n.ScrollTop != y || n.ScrollLeft != x {
+		n.ScrollTop = y
+		n.ScrollLeft = x
+		n.MarkLayoutDirty()
+	}
 }
 
 type Event struct {
@@ -427,6 +870,8 @@ type EventList struct {
 	List  []string
 }
 
+// AddEventListener registers callback for the event name. Listeners are always called on the goroutine running the
+// + main loop (gui.View or gui.Runtime.Step) between frames, so they can change the document directly
 func (node *Node) AddEventListener(name string, callback func(Event)) {
 	if node.Properties.EventListeners == nil {
 		node.Properties.EventListeners = make(map[string][]func(Event))
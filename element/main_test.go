@@ -0,0 +1,93 @@
+package element
+
+import (
+	"strings"
+	"testing"
+)
+
+// build makes a node from "tag#id.class.class" with attributes and appends the children to it
+func build(root *Node, spec string, attributes map[string]string, children ...*Node) *Node {
+	name, classes, _ := strings.Cut(spec, ".")
+	tag, id, _ := strings.Cut(name, "#")
+	n := root.CreateElement(tag)
+	n.Id = id
+	if classes != "" {
+		n.ClassList.Classes = strings.Split(classes, ".")
+	}
+	for k, v := range attributes {
+		n.Attribute[k] = v
+	}
+	for _, v := range children {
+		n.AppendChild(v)
+	}
+	return &n
+}
+
+func TestMatches(t *testing.T) {
+	root := &Node{TagName: "ROOT"}
+	text := root.CreateTextNode("text")
+	doc := build(root, "html#doc", nil,
+		build(root, "body", nil,
+			build(root, "div#main.card", map[string]string{"data-x": "1", "lang": "en-US"},
+				build(root, "h1#title", nil),
+				build(root, "p#first.lead", nil, &text),
+				build(root, "p#second", nil),
+				build(root, "span#tail", nil),
+			),
+			build(root, "ul", nil,
+				build(root, "li#one.a", nil),
+				build(root, "li#two", nil),
+				build(root, "li#three.a", nil),
+			),
+			build(root, "input#box", map[string]string{"type": "checkbox", "checked": ""}),
+			build(root, "div#empty", nil),
+		),
+	)
+	root.AppendChild(doc)
+
+	tests := []struct {
+		selector string
+		want     string
+	}{
+		// Descendant and sibling combinators
+		{"div p", "first second"},
+		{"body > p", ""},
+		{"html > body > div > p", "first second"},
+		{"h1 + p", "first"},
+		{"h1 ~ p", "first second"},
+		{"h1 ~ span", "tail"},
+		{".card span", "tail"},
+		{"ul li + li", "two three"},
+		{"div, li.a", "main one three empty"},
+		// Attributes
+		{"[data-x]", "main"},
+		{"[data-x='1']", "main"},
+		{"[lang|=en]", "main"},
+		{"[type=checkbox][checked]", "box"},
+		// Pseudo-classes
+		{"p:first-of-type", "first"},
+		{"li:nth-child(odd)", "one three"},
+		{"li:nth-child(2n of .a)", "three"},
+		{"li:last-child", "three"},
+		{"p:not(.lead)", "second"},
+		{":is(ul, div) > .a", "one three"},
+		{"div:has(> p.lead)", "main"},
+		{"h1:has(+ p)", "title"},
+		{"body > :empty", "box empty"},
+		{"input:checked", "box"},
+		{":root", "doc"},
+	}
+	for _, test := range tests {
+		matched := []string{}
+		ids := map[string]bool{}
+		for _, v := range *doc.QuerySelectorAll(test.selector) {
+			if v.Id != "" && !ids[v.Id] {
+				ids[v.Id] = true
+				matched = append(matched, v.Id)
+			}
+		}
+		if got := strings.Join(matched, " "); got != test.want {
+			t.Errorf("QuerySelectorAll(%q) = %q, want %q", test.selector, got, test.want)
+		}
+	}
+}
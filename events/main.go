@@ -138,6 +138,7 @@ func (m *Monitor) RunEvents(n *element.Node) bool {
 			s := *m.State
 			self := s[n.Properties.Id]
 			containerHeight := self.Height
+			prevScrollTop := n.ScrollTop
 			n.ScrollTop -= evt.Scroll
 
 			// This is the scroll scaling equation if it is less than the scroll height then let it add the next scroll amount
@@ -149,6 +150,10 @@ func (m *Monitor) RunEvents(n *element.Node) bool {
 				n.ScrollTop = 0
 			}
 
+			if n.ScrollTop != prevScrollTop {
+				n.MarkLayoutDirty()
+			}
+
 			if n.OnScroll != nil {
 				n.OnScroll(evt)
 			}
@@ -358,7 +358,7 @@ func Render(t *element.Text) (*image.RGBA, int) {
 		t.LineHeight = t.EM + 3
 	}
 
-	width := MeasureText(t, t.Text+" ")
+	width := MeasureText(t, t.Text)
 
 	// Use fully transparent color for the background
 	img := image.NewRGBA(image.Rect(0, 0, width, t.LineHeight))
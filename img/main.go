@@ -0,0 +1,115 @@
+package img
+
+import (
+	"bytes"
+	"gui/utils"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io/fs"
+	"strconv"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// Load decodes a PNG, JPEG or GIF from fsys (or the OS when fsys is nil), only the first frame of a GIF is used
+func Load(fsys fs.FS, path string) (*image.RGBA, error) {
+	data, err := utils.ReadFile(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if rgba, ok := decoded.(*image.RGBA); ok && rgba.Bounds().Min == (image.Point{}) {
+		return rgba, nil
+	}
+	b := decoded.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), decoded, b.Min, draw.Src)
+	return rgba, nil
+}
+
+// Fit scales src into a width x height box following object-fit and object-position, the parts of the box
+// + the image doesn't cover are left transparent
+func Fit(src *image.RGBA, width, height int, fit, position string) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	iw, ih := float64(src.Bounds().Dx()), float64(src.Bounds().Dy())
+	if iw == 0 || ih == 0 || width <= 0 || height <= 0 {
+		return dst
+	}
+	w, h := float64(width), float64(height)
+
+	sw, sh := w, h
+	switch fit {
+	case "contain", "cover", "none", "scale-down":
+		scale := 1.0
+		if fit == "contain" || fit == "scale-down" {
+			scale = min(w/iw, h/ih)
+		} else if fit == "cover" {
+			scale = max(w/iw, h/ih)
+		}
+		if fit == "scale-down" && scale > 1 {
+			scale = 1
+		}
+		sw, sh = iw*scale, ih*scale
+	}
+
+	px, py := Position(position, w-sw, h-sh)
+	rect := image.Rect(int(px), int(py), int(px+sw), int(py+sh))
+	if rect.Dx() == int(iw) && rect.Dy() == int(ih) {
+		draw.Draw(dst, rect, src, src.Bounds().Min, draw.Src)
+	} else {
+		xdraw.CatmullRom.Scale(dst, rect, src, src.Bounds(), draw.Src, nil)
+	}
+	return dst
+}
+
+// Position resolves a object-position value to an offset given the free space on each axis, it defaults to centered
+func Position(position string, freeX, freeY float64) (float64, float64) {
+	x, y := freeX/2, freeY/2
+	parts := strings.Fields(position)
+	if len(parts) == 1 {
+		// A single vertical keyword still centers horizontally
+		if parts[0] == "top" || parts[0] == "bottom" {
+			parts = []string{"center", parts[0]}
+		} else {
+			parts = append(parts, "center")
+		}
+	}
+	if len(parts) >= 2 {
+		// Keywords can be given in either order
+		if parts[0] == "top" || parts[0] == "bottom" || parts[1] == "left" || parts[1] == "right" {
+			parts[0], parts[1] = parts[1], parts[0]
+		}
+		x = offset(parts[0], freeX, "left", "right")
+		y = offset(parts[1], freeY, "top", "bottom")
+	}
+	return x, y
+}
+
+func offset(value string, free float64, start, end string) float64 {
+	switch value {
+	case start:
+		return 0
+	case end:
+		return free
+	case "center":
+		return free / 2
+	}
+	if strings.HasSuffix(value, "%") {
+		p, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err == nil {
+			return free * p / 100
+		}
+	}
+	v, err := strconv.ParseFloat(strings.TrimSuffix(value, "px"), 64)
+	if err == nil {
+		return v
+	}
+	return free / 2
+}
@@ -0,0 +1,120 @@
+package img
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+	"testing/fstest"
+)
+
+// picture is a 4x2 image, red on the left half and blue on the right
+func picture() *image.RGBA {
+	p := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x++ {
+			if x < 2 {
+				p.Set(x, y, color.RGBA{255, 0, 0, 255})
+			} else {
+				p.Set(x, y, color.RGBA{0, 0, 255, 255})
+			}
+		}
+	}
+	return p
+}
+
+func TestLoad(t *testing.T) {
+	var pngData, jpegData, gifData bytes.Buffer
+	if err := png.Encode(&pngData, picture()); err != nil {
+		t.Fatal(err)
+	}
+	if err := jpeg.Encode(&jpegData, picture(), &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if err := gif.Encode(&gifData, picture(), nil); err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{
+		"a.png":   {Data: pngData.Bytes()},
+		"a.jpg":   {Data: jpegData.Bytes()},
+		"a.gif":   {Data: gifData.Bytes()},
+		"bad.png": {Data: []byte("not an image")},
+	}
+
+	for _, name := range []string{"a.png", "a.jpg", "a.gif"} {
+		got, err := Load(fsys, name)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if got.Bounds() != image.Rect(0, 0, 4, 2) {
+			t.Errorf("%s: bounds %v, want 4x2", name, got.Bounds())
+			continue
+		}
+		// JPEG is lossy so the colors only have to be close
+		if left := got.RGBAAt(0, 0); left.R < 200 || left.B > 60 {
+			t.Errorf("%s: left is %v, want red", name, left)
+		}
+		if right := got.RGBAAt(3, 1); right.B < 200 || right.R > 60 {
+			t.Errorf("%s: right is %v, want blue", name, right)
+		}
+	}
+
+	if _, err := Load(fsys, "bad.png"); err == nil {
+		t.Error("bad.png decoded without an error")
+	}
+	if _, err := Load(fsys, "missing.png"); err == nil {
+		t.Error("missing.png loaded without an error")
+	}
+}
+
+// TestFit scales the 4x2 picture into an 8x8 box and checks the part of the box it covers
+func TestFit(t *testing.T) {
+	tests := []struct {
+		fit      string
+		position string
+		want     image.Rectangle
+	}{
+		{"fill", "", image.Rect(0, 0, 8, 8)},
+		{"", "", image.Rect(0, 0, 8, 8)},
+		{"contain", "", image.Rect(0, 2, 8, 6)},
+		{"contain", "top", image.Rect(0, 0, 8, 4)},
+		{"contain", "left bottom", image.Rect(0, 4, 8, 8)},
+		{"cover", "", image.Rect(0, 0, 8, 8)},
+		{"none", "", image.Rect(2, 3, 6, 5)},
+		{"none", "0 0", image.Rect(0, 0, 4, 2)},
+		{"none", "100% 100%", image.Rect(4, 6, 8, 8)},
+		{"scale-down", "", image.Rect(2, 3, 6, 5)},
+	}
+	for _, test := range tests {
+		got := Fit(picture(), 8, 8, test.fit, test.position)
+		if covered := opaque(got); covered != test.want {
+			t.Errorf("object-fit: %q; object-position: %q covers %v, want %v", test.fit, test.position, covered, test.want)
+		}
+	}
+
+	// cover crops the sides, the middle of the picture is where red meets blue
+	got := Fit(picture(), 8, 8, "cover", "")
+	if left, right := got.RGBAAt(0, 4), got.RGBAAt(7, 4); left.R < 200 || right.B < 200 {
+		t.Errorf("cover: the sides are %v and %v, want red and blue", left, right)
+	}
+	if got := Fit(picture(), 8, 8, "scale-down", ""); got.RGBAAt(2, 3).R != 255 {
+		t.Errorf("scale-down: %v at 2, 3, want the picture at its own size", got.RGBAAt(2, 3))
+	}
+}
+
+// opaque returns the bounds of the pixels of img that aren't transparent
+func opaque(img *image.RGBA) image.Rectangle {
+	r := image.Rectangle{}
+	for y := 0; y < img.Bounds().Dy(); y++ {
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			if img.RGBAAt(x, y).A > 0 {
+				r = r.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return r
+}
@@ -1,19 +1,22 @@
 package gui
 
 import (
-	"bufio"
 	"bytes"
-	"crypto/sha256"
 	_ "embed"
-	"encoding/json"
-	"fmt"
+	"errors"
 	adapter "gui/adapters"
+	"gui/border"
 	"gui/canvas"
+	"gui/color"
 	"gui/cstyle"
 	"gui/cstyle/plugins/crop"
 	"gui/cstyle/plugins/flex"
+	"gui/cstyle/plugins/float"
+	"gui/cstyle/plugins/grid"
 	"gui/cstyle/plugins/inline"
+	"gui/cstyle/plugins/table"
 	"gui/cstyle/plugins/textAlign"
+	"gui/cstyle/transformers/alt"
 	"gui/cstyle/transformers/background"
 	flexprep "gui/cstyle/transformers/flex"
 	marginblock "gui/cstyle/transformers/margin-block"
@@ -21,21 +24,29 @@ import (
 	"gui/cstyle/transformers/scrollbar"
 	"gui/cstyle/transformers/text"
 	"gui/cstyle/transformers/ul"
-	"gui/font"
 	"gui/library"
 	"gui/scripts"
 	"gui/scripts/a"
+	"gui/timers"
+	"gui/watch"
 	"image"
+	ic "image/color"
+	"io"
+	"io/fs"
+	"maps"
 
 	"gui/element"
 	"gui/events"
+	"gui/img"
 	"gui/utils"
-	"net/url"
 	"os"
+	"path"
 	"path/filepath"
-	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	imgFont "golang.org/x/image/font"
 
@@ -50,37 +61,404 @@ type Window struct {
 	Document element.Node
 	Adapter  *adapter.Adapter
 	Scripts  scripts.Scripts
+	// FS is where linked files (stylesheets, images) are read from, nil reads from the os file system
+	FS fs.FS
+	// Path is the location of the document in FS, empty if it was opened from a string or reader
+	Path      string
+	Options   Options
+	Timers    *timers.Timers
+	mutations *mutations
+	// styles are kept to parse them again when a file changes in dev mode
+	styles []styleSource
 }
 
-func Open(path string, adapterFunction *adapter.Adapter) Window {
-	window := New(adapterFunction)
+// styleSource is a <link rel="stylesheet"> (href) or a <style> tag (css), they are kept in the order of the document
+// + because a later sheet wins over an earlier one
+type styleSource struct {
+	href string
+	css  string
+}
+
+// mutations holds the work posted from other goroutines until the main loop runs it between frames
+type mutations struct {
+	mu    sync.Mutex
+	queue []func(doc *element.Node)
+	// running is set while a runtime steps the window, stop is closed when it stops so Do doesn't wait on it
+	running bool
+	stop    chan struct{}
+}
+
+// ErrNotRunning is returned by Do when no runtime is running the main loop of the window
+var ErrNotRunning = errors.New("gui: the window is not running")
+
+// mutationsInit guards the queue of windows that weren't made with New
+var mutationsInit sync.Mutex
+
+func Open(path string, adapterFunction *adapter.Adapter, options ...Options) (Window, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return New(adapterFunction, options...), err
+	}
+	defer file.Close()
+
+	return open(file, nil, path, adapterFunction, options)
+}
+
+// OpenString opens a document from a string, linked files are resolved relative to the working directory
+func OpenString(document string, adapterFunction *adapter.Adapter, options ...Options) (Window, error) {
+	return OpenReader(strings.NewReader(document), adapterFunction, options...)
+}
+
+// OpenReader opens a document from r, linked files are resolved relative to the working directory
+func OpenReader(r io.Reader, adapterFunction *adapter.Adapter, options ...Options) (Window, error) {
+	return open(r, nil, "", adapterFunction, options)
+}
+
+// OpenFS opens the document at path inside fsys (ex: embed.FS), linked stylesheets and images are read from fsys
+func OpenFS(fsys fs.FS, path string, adapterFunction *adapter.Adapter, options ...Options) (Window, error) {
+	file, err := fsys.Open(path)
+	if err != nil {
+		return New(adapterFunction, options...), err
+	}
+	defer file.Close()
 
-	styleSheets, styleTags, htmlNodes := parseHTMLFromFile(path)
+	return open(file, fsys, path, adapterFunction, options)
+}
 
-	for _, v := range styleSheets {
-		window.CSS.StyleSheet(v)
+func open(r io.Reader, fsys fs.FS, path string, adapterFunction *adapter.Adapter, options []Options) (Window, error) {
+	window := New(adapterFunction, options...)
+	window.FS = fsys
+	window.Path = path
+	window.CSS.FS = fsys
+	window.CSS.Dir = window.Dir()
+
+	styles, htmlNodes, err := parseHTML(r, fsys, window.Dir())
+	if err != nil {
+		return window, err
 	}
 
-	for _, v := range styleTags {
-		window.CSS.StyleTag(v)
+	window.styles = styles
+	if err := window.loadStyles(); err != nil {
+		return window, err
 	}
 
 	CreateNode(htmlNodes, &window.Document)
 
-	return window
+	return window, nil
+}
+
+// loadStyles parses master.css, the linked stylesheets and the style tags and restyles the document. Nothing is
+// + replaced if one of the stylesheets can't be read
+func (w *Window) loadStyles() error {
+	css := w.CSS
+	css.StyleSheets = nil
+	css.StyleMap = nil
+	css.Structural = false
+	css.Errors = nil
+	css.Media = nil
+	css.Files = nil
+
+	css.UserAgentStyleTag(mastercss)
+	for _, v := range w.styles {
+		if v.href == "" {
+			css.StyleTag(v.css)
+		} else if err := css.StyleSheet(v.href); err != nil {
+			return err
+		}
+	}
+
+	w.CSS.StyleSheets = css.StyleSheets
+	w.CSS.StyleMap = css.StyleMap
+	w.CSS.Structural = css.Structural
+	w.CSS.Errors = css.Errors
+	w.CSS.Media = css.Media
+	w.CSS.Files = css.Files
+	if w.Options.Dev {
+		for _, v := range css.Errors {
+			w.reportError(v)
+		}
+	}
+	if len(w.Document.Children) > 0 {
+		w.Document.Children[0].MarkDirty()
+	}
+	return nil
+}
+
+// reload parses the document at Path again and replaces the DOM, listeners added outside of Scripts are lost
+func (w *Window) reload() error {
+	var file io.ReadCloser
+	var err error
+	if w.FS != nil {
+		file, err = w.FS.Open(w.Path)
+	} else {
+		file, err = os.Open(w.Path)
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	styles, htmlNodes, err := parseHTML(file, w.FS, w.Dir())
+	if err != nil {
+		return err
+	}
+
+	w.styles = styles
+	if err := w.loadStyles(); err != nil {
+		return err
+	}
+
+	w.Document.Children = []*element.Node{}
+	CreateNode(htmlNodes, &w.Document)
+	return nil
+}
+
+// reportError hands err to Options.OnError
+func (w *Window) reportError(err error) {
+	if w.Options.OnError != nil {
+		w.Options.OnError(err)
+	}
+}
+
+// watch polls the document and its stylesheets in dev mode, only a change to the document rebuilds the DOM
+func (w *Window) watch() {
+	if w.Path == "" {
+		return
+	}
+	files := &watch.Files{FS: w.FS}
+	files.Set(append([]string{w.Path}, w.CSS.Files...))
+
+	w.Timers.SetInterval(func() {
+		changed := files.Changed()
+		if len(changed) == 0 {
+			return
+		}
+
+		var err error
+		if slices.Contains(changed, w.Path) {
+			err = w.reload()
+		} else {
+			err = w.loadStyles()
+		}
+		if err != nil {
+			// Keep showing the last version until the file is fixed
+			w.reportError(err)
+		}
+		files.Set(append([]string{w.Path}, w.CSS.Files...))
+	}, devPollInterval)
+}
+
+// Dir is the directory relative paths in the document are resolved against
+func (w *Window) Dir() string {
+	if w.Path == "" {
+		return "."
+	}
+	if w.FS != nil {
+		return path.Dir(w.Path)
+	}
+	return filepath.Dir(w.Path)
+}
+
+// loadImages decodes the src of every <img> that changed since the last layout and fires its load or error listeners
+func (w *Window) loadImages(n *element.Node) {
+	if n.TagName == "img" && n.Src != n.Properties.ImageSrc {
+		n.Properties.ImageSrc = n.Src
+		n.Image = nil
+		n.MarkDirty()
+		if n.Src != "" {
+			var err error
+			n.Image, err = img.Load(w.FS, utils.ResolvePath(w.FS, w.Dir(), n.Src))
+			event := element.Event{Name: "load", Target: n}
+			if err != nil {
+				event = element.Event{Name: "error", Target: n, Data: err}
+			}
+			for _, handler := range n.Properties.EventListeners[event.Name] {
+				handler(event)
+			}
+		}
+	}
+	for _, v := range n.Children {
+		w.loadImages(v)
+	}
+}
+
+// GetComputedStyle returns the styles of n from the last layout with lengths in px and colors as rgb()/rgba().
+// + width, height, margin, padding and border widths are the sizes the layout used, the rest are converted from
+// + the computed value. Values that aren't a single length or color are returned as they are
+func (w *Window) GetComputedStyle(n *element.Node) map[string]string {
+	styles := maps.Clone(n.Properties.Computed)
+	if styles == nil {
+		return map[string]string{}
+	}
+	self := n.Properties.State
+	parent := element.State{Width: w.CSS.Width, EM: w.Options.FontSize}
+	if n.Parent != nil {
+		parent = n.Parent.Properties.State
+	}
+
+	for k, v := range styles {
+		if k == "color" || (strings.HasSuffix(k, "-color") && k != "scrollbar-color") {
+			styles[k] = computedColor(v, styles["color"])
+		} else if isLength(v) {
+			styles[k] = px(utils.ConvertToPixels(v, self.EM, parent.Width))
+		}
+	}
+	styles["font-size"] = px(self.EM)
+	if styles["display"] == "none" {
+		return styles
+	}
+
+	// width and height are of the box box-sizing sets them on, the state has the content and padding
+	if styles["box-sizing"] == "border-box" {
+		styles["width"] = px(self.Width + self.Border.Left.Width + self.Border.Right.Width)
+		styles["height"] = px(self.Height + self.Border.Top.Width + self.Border.Bottom.Width)
+	} else {
+		styles["width"] = px(self.Width - self.Padding.Left - self.Padding.Right)
+		styles["height"] = px(self.Height - self.Padding.Top - self.Padding.Bottom)
+	}
+	for _, v := range []struct {
+		name  string
+		sides element.MarginPadding
+	}{
+		{"margin", self.Margin},
+		{"padding", self.Padding},
+		{"border", element.MarginPadding{Top: self.Border.Top.Width, Right: self.Border.Right.Width, Bottom: self.Border.Bottom.Width, Left: self.Border.Left.Width}},
+	} {
+		suffix := ""
+		if v.name == "border" {
+			suffix = "-width"
+		}
+		styles[v.name+"-top"+suffix] = px(v.sides.Top)
+		styles[v.name+"-right"+suffix] = px(v.sides.Right)
+		styles[v.name+"-bottom"+suffix] = px(v.sides.Bottom)
+		styles[v.name+"-left"+suffix] = px(v.sides.Left)
+		if v.name != "border" {
+			styles[v.name] = strings.Join([]string{px(v.sides.Top), px(v.sides.Right), px(v.sides.Bottom), px(v.sides.Left)}, " ")
+		}
+	}
+	return styles
+}
+
+// computedColor converts a color to rgb()/rgba(), currentcolor is the color property
+func computedColor(value, current string) string {
+	switch strings.ToLower(value) {
+	case "currentcolor":
+		value = current
+	case "transparent":
+		return "rgba(0, 0, 0, 0)"
+	}
+	c := color.ParseRGBA(value)
+	if c == (ic.RGBA{}) {
+		return value
+	}
+	return color.Format(c)
+}
+
+// isLength is true for a single length ConvertToPixels can read (10px, 2em, 50%, calc(...))
+func isLength(value string) bool {
+	if strings.HasPrefix(value, "calc(") && strings.HasSuffix(value, ")") {
+		return true
+	}
+	for _, unit := range []string{"px", "em", "pt", "pc", "%", "vw", "vh", "cm", "in"} {
+		if number, ok := strings.CutSuffix(value, unit); ok {
+			_, err := strconv.ParseFloat(number, 64)
+			return err == nil
+		}
+	}
+	return false
+}
+
+func px(v float32) string {
+	return strconv.FormatFloat(float64(v), 'f', -1, 32) + "px"
+}
+
+// Options configure the window, zero values fall back to DefaultOptions
+type Options struct {
+	// Title defaults to the <title> of the document
+	Title string
+	// FPS is the frame rate cap
+	FPS int
+	// FixedSize stops the window from being resized, windows are resizable by default
+	FixedSize bool
+	MinWidth  int
+	MinHeight int
+	MaxWidth  int
+	MaxHeight int
+	// FontFamily and FontSize are the font inherited by the html element, master.css doesn't set one on html. The
+	// + default serif is loaded as Georgia like the html rule of master.css used to do
+	FontFamily string
+	FontSize   float32
+	// Background is the clear color drawn behind the document, nil is white and &ic.RGBA{} is transparent
+	Background *ic.RGBA
+	// Dev reloads the stylesheets and the document when they change on disk, only for documents opened from a path
+	Dev bool
+	// OnError is called with the errors dev mode runs into, a reload that fails and the errors in the stylesheets
+	// + (CSS.Errors). The ones found while the document is opened are reported before Open returns on the goroutine
+	// + that called it, the rest on the main loop. They are dropped when it is nil
+	OnError func(err error)
+	// ColorScheme is "light" or "dark" for the prefers-color-scheme media feature
+	ColorScheme string
+	// PixelRatio is the number of device pixels per CSS pixel for the resolution media feature
+	PixelRatio float32
+}
+
+// devPollInterval is how often the files are checked for changes in dev mode
+const devPollInterval = 500 * time.Millisecond
+
+func DefaultOptions() Options {
+	return Options{
+		FPS:         120,
+		FontFamily:  "serif",
+		FontSize:    16,
+		Background:  &ic.RGBA{255, 255, 255, 255},
+		ColorScheme: "light",
+		PixelRatio:  1,
+	}
+}
+
+func mergeOptions(options []Options) Options {
+	defaults := DefaultOptions()
+	if len(options) == 0 {
+		return defaults
+	}
+	o := options[0]
+	if o.FPS == 0 {
+		o.FPS = defaults.FPS
+	}
+	if o.FontFamily == "" {
+		o.FontFamily = defaults.FontFamily
+	}
+	if o.FontSize == 0 {
+		o.FontSize = defaults.FontSize
+	}
+	if o.ColorScheme == "" {
+		o.ColorScheme = defaults.ColorScheme
+	}
+	if o.PixelRatio == 0 {
+		o.PixelRatio = defaults.PixelRatio
+	}
+	if o.Background == nil {
+		o.Background = defaults.Background
+	}
+	return o
 }
 
-func New(adapterFunction *adapter.Adapter) Window {
+func New(adapterFunction *adapter.Adapter, options ...Options) Window {
+	o := mergeOptions(options)
+
 	css := cstyle.CSS{
 		Width:  800,
 		Height: 450,
 	}
 
-	css.StyleTag(mastercss)
+	css.UserAgentStyleTag(mastercss)
 	// This is still apart of computestyle
+	css.AddPlugin(float.Init())
 	css.AddPlugin(inline.Init())
 	css.AddPlugin(textAlign.Init())
 	css.AddPlugin(flex.Init())
+	css.AddPlugin(grid.Init())
+	css.AddPlugin(table.Init())
 	css.AddPlugin(crop.Init())
 
 	css.AddTransformer(scrollbar.Init())
@@ -88,6 +466,7 @@ func New(adapterFunction *adapter.Adapter) Window {
 	css.AddTransformer(marginblock.Init())
 	css.AddTransformer(ul.Init())
 	css.AddTransformer(ol.Init())
+	css.AddTransformer(alt.Init())
 	css.AddTransformer(text.Init())
 	css.AddTransformer(background.Init())
 
@@ -95,16 +474,124 @@ func New(adapterFunction *adapter.Adapter) Window {
 	document := el.CreateElement("ROOT")
 	document.Style["width"] = "800px"
 	document.Style["height"] = "450px"
+	document.Style["font-family"] = o.FontFamily
+	document.Style["font-size"] = strconv.FormatFloat(float64(o.FontSize), 'f', -1, 32) + "px"
 	document.Properties.Id = "ROOT"
 
 	s := scripts.Scripts{}
 	s.Add(a.Init())
 
 	return Window{
-		CSS:      css,
-		Document: document,
-		Scripts:  s,
-		Adapter:  adapterFunction,
+		CSS:       css,
+		Document:  document,
+		Scripts:   s,
+		Adapter:   adapterFunction,
+		Options:   o,
+		Timers:    &timers.Timers{},
+		mutations: &mutations{},
+	}
+}
+
+// Post queues fn to run on the main loop goroutine before the next frame and returns right away. The document
+// + is not safe to touch from other goroutines, so data coming from websockets, file watchers, etc should go through
+// + Post or Do. Event listeners already run on the main loop goroutine and can mutate the document directly
+func (w *Window) Post(fn func(doc *element.Node)) {
+	m := w.queue()
+	m.mu.Lock()
+	m.queue = append(m.queue, fn)
+	m.mu.Unlock()
+}
+
+// Do is like Post but waits until fn has run. It must not be called from the main loop goroutine (event listeners,
+// + scripts, timers) as it would wait on itself. It returns ErrNotRunning without running fn when no runtime is
+// + running the window (before NewRuntime or after Close) or when the runtime stops before fn ran
+func (w *Window) Do(fn func(doc *element.Node)) error {
+	m := w.queue()
+	m.mu.Lock()
+	if !m.running {
+		m.mu.Unlock()
+		return ErrNotRunning
+	}
+	done := make(chan struct{})
+	stop := m.stop
+	m.queue = append(m.queue, func(doc *element.Node) {
+		defer close(done)
+		fn(doc)
+	})
+	m.mu.Unlock()
+
+	select {
+	case <-done:
+		return nil
+	case <-stop:
+		// fn can have run right before the runtime stopped
+		select {
+		case <-done:
+			return nil
+		default:
+			return ErrNotRunning
+		}
+	}
+}
+
+// queue returns the mutations of w, windows that weren't made with New get theirs on the first use
+func (w *Window) queue() *mutations {
+	mutationsInit.Lock()
+	defer mutationsInit.Unlock()
+	if w.mutations == nil {
+		w.mutations = &mutations{}
+	}
+	return w.mutations
+}
+
+// start is called when a runtime starts running the window
+func (m *mutations) start() {
+	m.mu.Lock()
+	m.running = true
+	m.stop = make(chan struct{})
+	m.mu.Unlock()
+}
+
+// end is called when the runtime stops, the work that is still queued is dropped and Do stops waiting
+func (m *mutations) end() {
+	m.mu.Lock()
+	if m.running {
+		m.running = false
+		m.queue = nil
+		close(m.stop)
+	}
+	m.mu.Unlock()
+}
+
+// SetTimeout calls callback once on the main loop after delay, before the document is styled
+func (w *Window) SetTimeout(callback func(), delay time.Duration) int {
+	return w.Timers.SetTimeout(callback, delay)
+}
+
+// SetInterval calls callback on the main loop every interval until it is cleared with ClearTimer
+func (w *Window) SetInterval(callback func(), interval time.Duration) int {
+	return w.Timers.SetInterval(callback, interval)
+}
+
+// ClearTimer cancels a timeout, interval or animation frame
+func (w *Window) ClearTimer(id int) {
+	w.Timers.Clear(id)
+}
+
+// RequestAnimationFrame calls callback once before the next frame is styled with the time since the timers started
+func (w *Window) RequestAnimationFrame(callback func(t time.Duration)) int {
+	return w.Timers.RequestAnimationFrame(callback)
+}
+
+func (w *Window) runMutations() {
+	m := w.queue()
+	m.mu.Lock()
+	queue := m.queue
+	m.queue = nil
+	m.mu.Unlock()
+
+	for _, fn := range queue {
+		fn(&w.Document)
 	}
 }
 
@@ -118,7 +605,17 @@ func (w *Window) Render(doc *element.Node, state *map[string]element.State, shel
 	keys := []string{}
 
 	for _, v := range flatDoc {
-		store = append(store, s[v.Properties.Id])
+		self := s[v.Properties.Id]
+		// !NOTE: Borders are drawn here instead of in ComputeNodeStyle as plugins can still resize a node after it
+		// + has been computed. The store is a copy so the key is not kept in the state for the next layout, the
+		// + border stays the first texture of the node like it was when it was drawn in ComputeNodeStyle. The radii are
+		// + fitted to the final size for the same reason
+		textures := self.Textures
+		self.Textures = nil
+		border.Fit(&self)
+		border.Draw(&self, shelf)
+		self.Textures = append(self.Textures, textures...)
+		store = append(store, self)
 		keys = append(keys, v.Properties.Id)
 	}
 
@@ -199,209 +696,332 @@ func flatten(n *element.Node) []*element.Node {
 	return nodes
 }
 
-func View(data *Window, width, height int) {
-	shelf := library.Shelf{
-		Textures:   map[string]*image.RGBA{},
-		References: map[string]bool{},
+// Runtime drives a Window one frame at a time, View is a loop around it. Use it directly to embed grim
+// + in another main loop or to render an exact number of frames
+type Runtime struct {
+	Window   *Window
+	Shelf    *library.Shelf
+	Monitor  *events.Monitor
+	Width    int
+	Height   int
+	state    map[string]element.State
+	rendered []element.State
+	resized  bool
+	stopped  bool
+	closed   bool
+	event    events.EventData
+}
+
+func NewRuntime(data *Window, width, height int) *Runtime {
+	r := &Runtime{
+		Window: data,
+		Shelf: &library.Shelf{
+			Textures:   map[string]*image.RGBA{},
+			References: map[string]bool{},
+		},
+		Width:   width,
+		Height:  height,
+		state:   map[string]element.State{},
+		resized: true,
 	}
 
-	debug := false
 	data.Document.Style["width"] = strconv.Itoa(int(width)) + "px"
 	data.Document.Style["height"] = strconv.Itoa(int(height)) + "px"
 
-	data.Adapter.Library = &shelf
+	// Options set on the window after New can have zero values again
+	o := mergeOptions([]Options{data.Options})
+	title := o.Title
+	if title == "" {
+		if t := data.Document.QuerySelector("title"); t.TagName == "title" {
+			title = strings.TrimSpace(t.InnerText)
+		}
+	}
+
+	r.Monitor = &events.Monitor{
+		EventMap: make(map[string]element.Event),
+		Adapter:  data.Adapter,
+		State:    &r.state,
+		CSS:      &data.CSS,
+		Focus: events.Focus{
+			Nodes:               []string{},
+			Selected:            -1,
+			SoftFocused:         "",
+			LastClickWasFocused: false,
+		},
+	}
+
+	r.addEventListeners()
+	data.queue().start()
+
+	data.Adapter.Library = r.Shelf
+	data.Adapter.Settings = adapter.Settings{
+		Title:      title,
+		FPS:        o.FPS,
+		Resizable:  !o.FixedSize,
+		MinWidth:   o.MinWidth,
+		MinHeight:  o.MinHeight,
+		MaxWidth:   o.MaxWidth,
+		MaxHeight:  o.MaxHeight,
+		Background: *o.Background,
+	}
 	data.Adapter.Init(width, height)
-	// wm.FPSCounterOn = true
 
-	state := map[string]element.State{}
-	state["ROOT"] = element.State{
+	r.state["ROOT"] = element.State{
 		Width:  float32(width),
 		Height: float32(height),
+		EM:     o.FontSize,
 	}
 
-	shouldStop := false
-
-	var hash []byte
-
-	// data.Document.Children[0] = AddStyles(data.CSS, data.Document.Children[0], &data.Document)
-
-	var rd []element.State
-
 	data.CSS.Options = data.Adapter.Options
+	data.CSS.ColorScheme = o.ColorScheme
+	data.CSS.PixelRatio = o.PixelRatio
 
-	// Load init font
 	if data.CSS.Fonts == nil {
 		data.CSS.Fonts = map[string]imgFont.Face{}
 	}
-	fid := "Georgia 16px false false"
-	if data.CSS.Fonts[fid] == nil {
-		f, _ := font.LoadFont("Georgia", 16, 400, false)
-		data.CSS.Fonts[fid] = f
+
+	if o.Dev {
+		data.watch()
 	}
 
-	newWidth, newHeight := width, height
+	return r
+}
 
-	monitor := events.Monitor{
-		EventMap: make(map[string]element.Event),
-		Adapter:  data.Adapter,
-		State:    &state,
-		CSS:      &data.CSS,
-		Focus: events.Focus{
-			Nodes:               []string{},
-			Selected:            -1,
-			SoftFocused:         "",
-			LastClickWasFocused: false,
-		},
-	}
+func (r *Runtime) addEventListeners() {
+	a := r.Window.Adapter
+	monitor := r.Monitor
+	currentEvent := &r.event
 
-	data.Adapter.AddEventListener("windowresize", func(e element.Event) {
+	a.AddEventListener("windowresize", func(e element.Event) {
 		wh := e.Data.(map[string]int)
-		newWidth = wh["width"]
-		newHeight = wh["height"]
+		if wh["width"] != r.Width || wh["height"] != r.Height {
+			r.Width = wh["width"]
+			r.Height = wh["height"]
+			r.resized = true
+		}
 	})
 
-	data.Adapter.AddEventListener("close", func(e element.Event) {
-		shouldStop = true
+	a.AddEventListener("close", func(e element.Event) {
+		r.stop()
 	})
 
-	currentEvent := events.EventData{}
-
-	data.Adapter.AddEventListener("keydown", func(e element.Event) {
+	a.AddEventListener("keydown", func(e element.Event) {
 		currentEvent.Key = e.Data.(int)
 		currentEvent.KeyState = true
-		monitor.GetEvents(&currentEvent)
+		monitor.GetEvents(currentEvent)
 	})
-	data.Adapter.AddEventListener("keyup", func(e element.Event) {
+	a.AddEventListener("keyup", func(e element.Event) {
 		currentEvent.Key = 0
 		currentEvent.KeyState = false
-		monitor.GetEvents(&currentEvent)
+		monitor.GetEvents(currentEvent)
 	})
 
-	data.Adapter.AddEventListener("mousemove", func(e element.Event) {
+	a.AddEventListener("mousemove", func(e element.Event) {
 		pos := e.Data.([]int)
 		currentEvent.Position = pos
-		monitor.GetEvents(&currentEvent)
+		monitor.GetEvents(currentEvent)
 	})
 
-	data.Adapter.AddEventListener("scroll", func(e element.Event) {
+	a.AddEventListener("scroll", func(e element.Event) {
 		currentEvent.Scroll = e.Data.(int)
-		monitor.GetEvents(&currentEvent)
+		monitor.GetEvents(currentEvent)
 		currentEvent.Scroll = 0
 	})
 
-	data.Adapter.AddEventListener("mousedown", func(e element.Event) {
+	a.AddEventListener("mousedown", func(e element.Event) {
 		currentEvent.Click = true
-		monitor.GetEvents(&currentEvent)
+		monitor.GetEvents(currentEvent)
 	})
 
-	data.Adapter.AddEventListener("mouseup", func(e element.Event) {
+	a.AddEventListener("mouseup", func(e element.Event) {
 		currentEvent.Click = false
-		monitor.GetEvents(&currentEvent)
+		monitor.GetEvents(currentEvent)
 	})
 
-	data.Adapter.AddEventListener("contextmenudown", func(e element.Event) {
+	a.AddEventListener("contextmenudown", func(e element.Event) {
 		currentEvent.Context = true
-		monitor.GetEvents(&currentEvent)
+		monitor.GetEvents(currentEvent)
 	})
 
-	data.Adapter.AddEventListener("contextmenuup", func(e element.Event) {
+	a.AddEventListener("contextmenuup", func(e element.Event) {
 		currentEvent.Context = true
-		monitor.GetEvents(&currentEvent)
+		monitor.GetEvents(currentEvent)
 	})
+}
 
-	// Main game loop
-	for !shouldStop {
-		// lastChange := time.Now()
+// Step runs a single iteration of the main loop, it returns false once the window has been closed
+func (r *Runtime) Step() bool {
+	if r.stopped {
+		return false
+	}
 
-		if !shouldStop && debug {
-			shouldStop = true
-		}
-		// Check if the window size has changed
-		resize := false
+	r.Window.runMutations()
+	r.Window.Timers.Run()
+
+	// Only lay the document out again if something changed, mutations through the element.Node methods mark
+	// + the tree dirty
+	if r.resized || r.Window.Document.Children[0].Properties.DirtyLayout {
+		r.Layout()
+	}
+
+	r.Frame()
+
+	return !r.stopped
+}
 
-		if newWidth != width || newHeight != height {
-			resize = true
-			// Window has been resized, handle the event
-			width = newWidth
-			height = newHeight
+// Layout restyles the document, computes the state of every element and loads the textures into the adapter.
+// + Only the dirty nodes and their ancestors are restyled, transformed and laid out again. The nodes next to them
+// + are moved from the last layout when they start out with the same box
+func (r *Runtime) Layout() {
+	data := r.Window
 
-			data.CSS.Width = float32(width)
-			data.CSS.Height = float32(height)
+	if r.resized {
+		r.resized = false
+		data.CSS.Width = float32(r.Width)
+		data.CSS.Height = float32(r.Height)
 
-			data.Document.Style["width"] = strconv.Itoa(int(width)) + "px"
-			data.Document.Style["height"] = strconv.Itoa(int(height)) + "px"
+		data.Document.Style["width"] = strconv.Itoa(int(r.Width)) + "px"
+		data.Document.Style["height"] = strconv.Itoa(int(r.Height)) + "px"
+
+		// Only restyle when a @media rule turned on or off
+		if data.CSS.UpdateMedia() {
+			data.Document.Children[0].MarkDirty()
 		}
+	}
 
-		newHash, _ := hashStruct(&data.Document.Children[0])
+	data.loadImages(&data.Document)
 
-		if !bytes.Equal(hash, newHash) || resize {
-			// Updating the document here allow new element to be included into the event loop
-			hash = newHash
-			// fmt.Println("########################")
-			// lastChange := time.Now()
-			// lastChange1 := time.Now()
+	newDoc := AddStyles(data.CSS, data.Document.Children[0], &data.Document)
 
-			newDoc := AddStyles(data.CSS, data.Document.Children[0], &data.Document)
+	// This is where the document needs to be updated at
+	newDoc = data.CSS.Transform(newDoc)
 
-			// fmt.Println("Copy Node: ", time.Since(lastChange1))
-			// lastChange1 = time.Now()
+	r.state["ROOT"] = element.State{
+		Width:  float32(r.Width),
+		Height: float32(r.Height),
+		EM:     data.Options.FontSize,
+	}
 
-			// This is where the document needs to be updated at
-			newDoc = data.CSS.Transform(newDoc)
-			// monitor.Document = newDoc
-			// fmt.Println("Transform: ", time.Since(lastChange1))
-			// lastChange1 = time.Now()
+	data.CSS.ComputeNodeStyle(newDoc, &r.state, r.Shelf)
 
-			state["ROOT"] = element.State{
-				Width:  float32(width),
-				Height: float32(height),
-			}
+	r.rendered = data.Render(newDoc, &r.state, r.Shelf)
 
-			data.CSS.ComputeNodeStyle(newDoc, &state, &shelf) // speed up
-			// fmt.Println("Compute Node Style: ", time.Since(lastChange1))
-			// lastChange1 = time.Now()
+	data.Adapter.Load(r.rendered)
 
-			rd = data.Render(newDoc, &state, &shelf)
-			// fmt.Println("Render: ", time.Since(lastChange1))
-			// lastChange1 = time.Now()
+	AddHTMLAndAttrs(&data.Document, &r.state)
 
-			data.Adapter.Load(rd) // speed up
-			// fmt.Println("Load: ", time.Since(lastChange1))
-			// lastChange1 = time.Now()
+	data.Scripts.Run(&data.Document)
+	r.Shelf.Clean()
+}
 
-			AddHTMLAndAttrs(&data.Document, &state)
-			// fmt.Println("Add HTML: ", time.Since(lastChange1))
+// Frame runs the queued events against the document and draws the last computed state
+func (r *Runtime) Frame() {
+	r.Monitor.RunEvents(r.Window.Document.Children[0])
+	r.Window.Adapter.Render(r.rendered)
+}
 
-			data.Scripts.Run(&data.Document)
-			// fmt.Println("#", time.Since(lastChange))
-			shelf.Clean()
-		}
+// stop ends the main loop, Step returns false from now on
+func (r *Runtime) stop() {
+	r.stopped = true
+	r.Window.queue().end()
+}
 
-		monitor.RunEvents(data.Document.Children[0])
-		// if monitor.Focus != nil {
-		// 	fmt.Println("FOCUS")
-		// 	monitor.Focus.Focus()
-		// }
-		data.Adapter.Render(rd)
-		// fmt.Println("#", time.Since(lastChange))
+// Close stops the runtime and lets the adapter release the window
+func (r *Runtime) Close() {
+	r.stop()
+	if r.closed {
+		return
+	}
+	r.closed = true
+	if r.Window.Adapter.Close != nil {
+		r.Window.Adapter.Close()
+	}
+}
+
+// States returns the computed state of every element in document order from the last layout
+func (r *Runtime) States() []element.State {
+	return r.rendered
+}
 
+// View opens the window and runs the main loop until it is closed, options replace the ones given to Open/New
+func View(data *Window, width, height int, options ...Options) {
+	if len(options) > 0 {
+		data.Options = mergeOptions(options)
+		data.Document.Style["font-family"] = data.Options.FontFamily
+		data.Document.Style["font-size"] = strconv.FormatFloat(float64(data.Options.FontSize), 'f', -1, 32) + "px"
+	}
+	r := NewRuntime(data, width, height)
+	defer r.Close()
+
+	// Main game loop
+	for r.Step() {
 	}
 }
 
 func AddStyles(c cstyle.CSS, node *element.Node, parent *element.Node) *element.Node {
 	n := *node
 	n.Parent = parent
+	n.Properties.Layout = nil
+	addStyles(c, node, &n, false, c.Structural)
+	return &n
+}
+
+// addStyles fills the copy n of node with the computed styles of every node. Only nodes that are marked dirty (and
+// + their children, they inherit from them) go through the cascade again, the rest reuse the styles of the last layout.
+// + With structural selectors the children of a node that had something change below it are checked again too.
+// + A child that is clean keeps the copy it was laid out with last time, see element.Cache
+func addStyles(c cstyle.CSS, node, n *element.Node, force, recheck bool) {
+	restyle := force || node.Properties.Dirty || node.Properties.Computed == nil
+	changed := restyle
+	if restyle || recheck {
+		styles, pseudo := c.GetStyles(n)
+		if !restyle {
+			changed = !maps.Equal(styles, node.Properties.Computed) || !pseudoEqual(pseudo, node.Properties.ComputedPseudo)
+		}
+		node.Properties.Computed, node.Properties.ComputedPseudo = styles, pseudo
+	}
+	// Transformers write to the style map of the copy so the cached one has to stay untouched
+	n.Style = maps.Clone(node.Properties.Computed)
+	n.PseudoElements = node.Properties.ComputedPseudo
 
-	n.Style, n.PseudoElements = c.GetStyles(&n)
+	recheckChildren := c.Structural && node.Properties.DirtyLayout
 
 	if len(node.Children) > 0 {
-		n.Children = make([]*element.Node, 0, len(node.Children))
-		for _, v := range node.Children {
-			n.Children = append(n.Children, AddStyles(c, v, &n))
+		// All the children are copied before styling them so selectors can see the siblings of a node
+		n.Children = make([]*element.Node, len(node.Children))
+		reuse := make([]bool, len(node.Children))
+		for i, v := range node.Children {
+			if reuse[i] = !changed && !recheckChildren && clean(v); reuse[i] {
+				n.Children[i] = v.Properties.Layout
+			} else {
+				child := *v
+				child.Properties.Layout = nil
+				v.Properties.Layout = &child
+				n.Children[i] = &child
+			}
+			n.Children[i].Parent = n
+		}
+		for i, v := range node.Children {
+			if !reuse[i] {
+				addStyles(c, v, n.Children[i], changed, recheckChildren)
+			}
 		}
 	}
+}
 
-	return &n
+// clean reports if the copy of n from the last layout can be laid out again as it is
+func clean(n *element.Node) bool {
+	if n.Properties.Dirty || n.Properties.DirtyLayout || n.Properties.Layout == nil || n.Properties.Layout.Properties.Cache == nil {
+		return false
+	}
+	// The words of an inline element are moved into its parent when it is transformed
+	return n.Properties.Computed["display"] != "inline"
+}
+
+func pseudoEqual(a, b map[string]map[string]string) bool {
+	return maps.EqualFunc(a, b, func(x, y map[string]string) bool {
+		return maps.Equal(x, y)
+	})
 }
 
 func CreateNode(node *html.Node, parent *element.Node) {
@@ -434,6 +1054,10 @@ func CreateNode(node *html.Node, parent *element.Node) {
 		for child := node.FirstChild; child != nil; child = child.NextSibling {
 			if child.Type == html.ElementNode {
 				CreateNode(child, &newNode)
+			} else if child.Type == html.TextNode {
+				// Whitespace is kept as is, it is collapsed during layout
+				t := newNode.CreateTextNode(child.Data)
+				newNode.AppendChild(&t)
 			}
 		}
 		parent.AppendChild(&newNode)
@@ -447,44 +1071,47 @@ func CreateNode(node *html.Node, parent *element.Node) {
 	}
 }
 
+// AddHTMLAndAttrs copies the state of the layout back to the document, the HTML is only built again for the nodes that
+// + changed. The dirty flags are cleared here
 func AddHTMLAndAttrs(n *element.Node, state *map[string]element.State) {
 	// Head is not renderable
 	s := (*state)
-	n.InnerHTML = utils.InnerHTML(n)
-	tag, closing := utils.NodeToHTML(n)
-	n.OuterHTML = tag + n.InnerHTML + closing
+	if n.Properties.DirtyLayout {
+		n.InnerHTML = utils.InnerHTML(n)
+		tag, closing := utils.NodeToHTML(n)
+		n.OuterHTML = tag + n.InnerHTML + closing
+	}
+	n.Properties.Dirty = false
+	n.Properties.DirtyLayout = false
 	// !NOTE: This is the only spot you can pierce the vale
-	n.ScrollHeight = s[n.Properties.Id].ScrollHeight
+	n.Properties.State = s[n.Properties.Id]
+	if n.ScrollHeight != s[n.Properties.Id].ScrollHeight {
+		n.ScrollHeight = s[n.Properties.Id].ScrollHeight
+		// The scrollbar is only added once the scroll height is known
+		n.MarkLayoutDirty()
+	}
 	for i := range n.Children {
 		AddHTMLAndAttrs(n.Children[i], state)
 	}
 }
 
-func parseHTMLFromFile(path string) ([]string, []string, *html.Node) {
-	file, _ := os.Open(path)
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	var htmlContent string
-
-	for scanner.Scan() {
-		htmlContent += scanner.Text() + "\n"
+func parseHTML(r io.Reader, fsys fs.FS, dir string) ([]styleSource, *html.Node, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	htmlContent = removeHTMLComments(htmlContent)
-	htmlContent = string(ConvertSelfClosingTags([]byte(htmlContent)))
-
-	doc, _ := html.Parse(strings.NewReader(encapsulateText(removeWhitespaceBetweenTags(htmlContent))))
-
-	// Extract stylesheet link tags and style tags
-	stylesheets := extractStylesheets(doc, filepath.Dir(path))
-	styleTags := extractStyleTags(doc)
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
 
-	return stylesheets, styleTags, doc
+	return extractStyles(doc, fsys, dir), doc, nil
 }
 
-func extractStylesheets(n *html.Node, baseDir string) []string {
-	var stylesheets []string
+// extractStyles finds the stylesheet link tags and the style tags in the order they are in the document
+func extractStyles(n *html.Node, fsys fs.FS, baseDir string) []styleSource {
+	var styles []styleSource
 
 	var dfs func(*html.Node)
 	dfs = func(node *html.Node) {
@@ -501,33 +1128,16 @@ func extractStylesheets(n *html.Node, baseDir string) []string {
 			}
 
 			if isStylesheet {
-				resolvedHref := localizePath(baseDir, href)
-				stylesheets = append(stylesheets, resolvedHref)
+				styles = append(styles, styleSource{href: utils.ResolvePath(fsys, baseDir, href)})
 			}
-		}
-
-		for c := node.FirstChild; c != nil; c = c.NextSibling {
-			dfs(c)
-		}
-	}
-
-	dfs(n)
-	return stylesheets
-}
-
-func extractStyleTags(n *html.Node) []string {
-	var styleTags []string
-
-	var dfs func(*html.Node)
-	dfs = func(node *html.Node) {
-		if node.Type == html.ElementNode && node.Data == "style" {
+		} else if node.Type == html.ElementNode && node.Data == "style" {
 			var styleContent strings.Builder
 			for c := node.FirstChild; c != nil; c = c.NextSibling {
 				if c.Type == html.TextNode {
 					styleContent.WriteString(c.Data)
 				}
 			}
-			styleTags = append(styleTags, styleContent.String())
+			styles = append(styles, styleSource{css: styleContent.String()})
 		}
 
 		for c := node.FirstChild; c != nil; c = c.NextSibling {
@@ -536,129 +1146,5 @@ func extractStyleTags(n *html.Node) []string {
 	}
 
 	dfs(n)
-	return styleTags
-}
-
-func localizePath(rootPath, filePath string) string {
-	// Check if the file path has a scheme, indicating it's a URL
-	u, err := url.Parse(filePath)
-	if err == nil && u.Scheme != "" {
-		return filePath
-	}
-
-	// Join the root path and the file path to create an absolute path
-	absPath := filepath.Join(rootPath, filePath)
-
-	// If the absolute path is the same as the original path, return it
-	if absPath == filePath {
-		return filePath
-	}
-
-	return "./" + absPath
-}
-
-func encapsulateText(htmlString string) string {
-	openOpen := regexp.MustCompile(`(<\w+[^>]*>)([^<]+)(<\w+[^>]*>)`)
-	closeOpen := regexp.MustCompile(`(</\w+[^>]*>)([^<]+)(<\w+[^>]*>)`)
-	closeClose := regexp.MustCompile(`(<\/\w+[^>]*>)([^<]+)(<\/\w+[^>]*>)`)
-	a := matchFactory(openOpen)
-	t := openOpen.ReplaceAllStringFunc(htmlString, a)
-	// fmt.Println(t)
-	b := matchFactory(closeOpen)
-	u := closeOpen.ReplaceAllStringFunc(t, b)
-	// fmt.Println(u)
-	c := matchFactory(closeClose)
-	v := closeClose.ReplaceAllStringFunc(u, c)
-	// fmt.Println(v)
-	return v
-}
-
-func matchFactory(re *regexp.Regexp) func(string) string {
-	return func(match string) string {
-		submatches := re.FindStringSubmatch(match)
-		if len(submatches) != 4 {
-			return match
-		}
-
-		// Process submatches
-		if len(removeWhitespace(submatches[2])) > 0 {
-			return submatches[1] + "<notaspan>" + submatches[2] + "</notaspan>" + submatches[3]
-		} else {
-			return match
-		}
-	}
-}
-func removeWhitespace(htmlString string) string {
-	// Remove extra white space
-	reSpaces := regexp.MustCompile(`\s+`)
-	htmlString = reSpaces.ReplaceAllString(htmlString, " ")
-
-	// Trim leading and trailing white space
-	htmlString = strings.TrimSpace(htmlString)
-
-	return htmlString
-}
-
-func removeHTMLComments(htmlString string) string {
-	re := regexp.MustCompile(`<!--[\s\S]*?-->`)
-	return re.ReplaceAllString(htmlString, "")
-}
-
-// important to allow the notspans to be injected, the spaces after removing the comments cause the regexp to fail
-func removeWhitespaceBetweenTags(html string) string {
-	// Create a regular expression to match spaces between angle brackets
-	re := regexp.MustCompile(`>\s+<`)
-	// Replace all matches of spaces between angle brackets with "><"
-	return re.ReplaceAllString(html, "><")
-}
-
-// Function to hash a struct using SHA-256
-func hashStruct(s interface{}) ([]byte, error) {
-	// Convert struct to JSON
-	jsonData, err := json.Marshal(s)
-	if err != nil {
-		return nil, err
-	}
-
-	// Hash the JSON data using SHA-256
-	hasher := sha256.New()
-	hasher.Write(jsonData)
-	hash := hasher.Sum(nil)
-
-	return hash, nil
-}
-
-// ConvertSelfClosingTags converts self-closing tags in the HTML to non-self-closing tags
-func ConvertSelfClosingTags(html []byte) []byte {
-	// Find the <body> section
-	bodyStart := []byte("<body>")
-	bodyEnd := []byte("</body>")
-
-	startIndex := bytes.Index(html, bodyStart)
-	endIndex := bytes.Index(html, bodyEnd)
-
-	if startIndex == -1 || endIndex == -1 {
-		// If <body> or </body> is not found, return the original HTML
-		return html
-	}
-
-	// Extract the <body> content
-	bodyContent := html[startIndex+len(bodyStart) : endIndex]
-
-	// Regular expression to match self-closing tags (e.g., <br />, <img />, <hr />, etc.)
-	re := regexp.MustCompile(`<(\w+)([^>]*?)/>`)
-	// Replace the self-closing tag with the non-self-closing form
-	convertedBody := re.ReplaceAllFunc(bodyContent, func(match []byte) []byte {
-		// Extract the tag name and the attributes
-		tagName := strings.Split(string(match), " ")[0][1:]
-		attributes := string(match[len(tagName)+2 : len(match)-2])
-		// Rebuild the tag as non-self-closing
-		if attributes == "" {
-			return []byte(fmt.Sprintf("<%s></%s>", tagName, tagName))
-		}
-		return []byte(fmt.Sprintf("<%s %s></%s>", tagName, attributes, tagName))
-	})
-
-	// Reassemble the HTML with the modified body
-	return append(append(html[:startIndex+len(bodyStart)], convertedBody...), html[endIndex:]...)
+	return styles
 }
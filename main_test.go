@@ -0,0 +1,491 @@
+package gui
+
+import (
+	"bytes"
+	"errors"
+	"gui/adapters/headless"
+	"gui/element"
+	"gui/font"
+	"image"
+	ic "image/color"
+	"image/png"
+	"io/fs"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDo(t *testing.T) {
+	w, err := OpenString("<html><body><p id=\"p\">before</p></body></html>", headless.Init().Adapter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := func(doc *element.Node) {
+		doc.QuerySelector("#p").InnerText = "after"
+	}
+
+	if err := w.Do(set); !errors.Is(err, ErrNotRunning) {
+		t.Fatalf("Do before NewRuntime = %v, want ErrNotRunning", err)
+	}
+
+	r := NewRuntime(&w, 200, 100)
+	done := make(chan error)
+	go func() {
+		done <- w.Do(set)
+	}()
+	for waiting := true; waiting; {
+		select {
+		case err = <-done:
+			waiting = false
+		default:
+			r.Step()
+		}
+	}
+	if err != nil {
+		t.Fatalf("Do while running = %v", err)
+	}
+	if text := w.Document.QuerySelector("#p").InnerText; text != "after" {
+		t.Fatalf("InnerText = %q, want %q", text, "after")
+	}
+
+	r.Close()
+	if err := w.Do(set); !errors.Is(err, ErrNotRunning) {
+		t.Fatalf("Do after Close = %v, want ErrNotRunning", err)
+	}
+}
+
+func TestPostWithoutNew(t *testing.T) {
+	var w Window
+	ran := false
+	w.Post(func(doc *element.Node) {
+		ran = true
+	})
+	w.runMutations()
+	if !ran {
+		t.Fatal("the posted function didn't run")
+	}
+}
+
+func TestMergeOptions(t *testing.T) {
+	o := mergeOptions([]Options{{FPS: 60}})
+	if o.FPS != 60 || o.FixedSize || o.FontSize != DefaultOptions().FontSize || *o.Background != *DefaultOptions().Background {
+		t.Fatalf("mergeOptions({FPS: 60}) = %+v", o)
+	}
+	if o := mergeOptions([]Options{{Background: &ic.RGBA{}}}); *o.Background != (ic.RGBA{}) {
+		t.Fatalf("a transparent background became %v", *o.Background)
+	}
+}
+
+// TestBackground checks the color a frame is cleared with where the document doesn't draw
+func TestBackground(t *testing.T) {
+	for _, test := range []struct {
+		background *ic.RGBA
+		want       ic.RGBA
+	}{
+		{nil, ic.RGBA{255, 255, 255, 255}},
+		{&ic.RGBA{}, ic.RGBA{}},
+		{&ic.RGBA{0, 0, 255, 255}, ic.RGBA{0, 0, 255, 255}},
+	} {
+		h := headless.Init()
+		w, err := OpenString("<html><head><style>html { background-color: transparent }</style></head><body></body></html>", h.Adapter, Options{Background: test.background})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := NewRuntime(&w, 20, 20)
+		r.Step()
+		if got := h.Frame().RGBAAt(10, 10); got != test.want {
+			t.Errorf("Background %v: the frame is %v, want %v", test.background, got, test.want)
+		}
+		r.Close()
+	}
+}
+
+// TestDefaultFont checks the font of html, it comes from Options instead of a rule in master.css. serif is Georgia
+// + like the html rule of master.css and the font the runtime loaded at start used to be
+func TestDefaultFont(t *testing.T) {
+	if serif, georgia := font.GetFontPath("serif", 400, false), font.GetFontPath("Georgia", 400, false); serif != georgia {
+		t.Errorf("serif loads %q, want Georgia (%q)", serif, georgia)
+	}
+
+	tests := []struct {
+		name    string
+		style   string
+		options []Options
+		family  string
+		size    string
+	}{
+		{"default", "", nil, "serif", "16px"},
+		{"options", "", []Options{{FontFamily: "sans-serif", FontSize: 20}}, "sans-serif", "20px"},
+		{"author rule", "html { font-family: monospace; font-size: 12px }", []Options{{FontSize: 20}}, "monospace", "12px"},
+		{"revert", "html { font-size: 12px } html { font-size: revert }", []Options{{FontSize: 20}}, "serif", "20px"},
+	}
+	for _, test := range tests {
+		w, err := OpenString("<html><head><style>"+test.style+"</style></head><body><p id=\"p\">text</p></body></html>", headless.Init().Adapter, test.options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := NewRuntime(&w, 200, 100)
+		r.Step()
+		for _, selector := range []string{"html", "#p"} {
+			computed := w.Document.QuerySelector(selector).Properties.Computed
+			if computed["font-family"] != test.family || computed["font-size"] != test.size {
+				t.Errorf("%s: %s has font %q %q, want %q %q", test.name, selector, computed["font-family"], computed["font-size"], test.family, test.size)
+			}
+		}
+		r.Close()
+	}
+}
+
+func TestDevErrors(t *testing.T) {
+	var reported []error
+	_, err := OpenString("<html><head><style>p { color red }</style></head><body><p>text</p></body></html>", headless.Init().Adapter, Options{
+		Dev: true,
+		OnError: func(err error) {
+			reported = append(reported, err)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reported) == 0 {
+		t.Fatal("the stylesheet error wasn't reported before OpenString returned")
+	}
+}
+
+const incrementalPage = `<html><head><style>
+.row { display: flex; gap: 4px }
+.card { flex: 1; padding: 4px; border: 1px solid #000 }
+.side { float: left; width: 40px; height: 40px; background: #f00 }
+.abs { position: absolute; top: 5px; left: 5px; width: 10px; height: 10px }
+.rel { position: relative; top: 3px }
+</style></head><body>
+<div class="row"><div class="card" id="a"><span>first</span> card</div><div class="card" id="b">second card</div></div>
+<section id="flow"><p id="p">A paragraph of text that wraps in the window</p><div class="rel" id="rel">moved</div></section>
+<div id="floats"><div class="side" id="side"></div><p>text next to the float</p></div>
+<h1>A heading with a break<br>after it</h1>
+<ul id="list"><li>one</li><li>two</li></ul>
+<div id="pos" style="position: relative"><div class="abs"></div></div>
+</body></html>`
+
+// relayout lays the whole document out again without reusing anything from the last layout
+func relayout(r *Runtime) []element.State {
+	var clear func(n *element.Node)
+	clear = func(n *element.Node) {
+		n.Properties.Layout = nil
+		for _, v := range n.Children {
+			clear(v)
+		}
+	}
+	clear(&r.Window.Document)
+	r.Window.Document.Children[0].MarkLayoutDirty()
+	r.Layout()
+	return r.States()
+}
+
+// TestIncrementalLayout changes the document and checks that a layout of only the dirty nodes is the same as a layout
+// + of everything
+func TestIncrementalLayout(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(doc *element.Node)
+	}{
+		{"text in a flex item", func(doc *element.Node) { doc.QuerySelector("#a").SetInnerText("a longer text for the first card") }},
+		{"padding", func(doc *element.Node) { doc.QuerySelector("#p").SetStyle("padding", "6px") }},
+		{"class", func(doc *element.Node) { doc.QuerySelector("#b").ClassList.Add("side") }},
+		{"append", func(doc *element.Node) {
+			div := doc.CreateElement("div")
+			div.SetInnerText("new")
+			doc.QuerySelector("#flow").AppendChild(&div)
+		}},
+		{"remove", func(doc *element.Node) { doc.QuerySelector("#rel").Remove() }},
+		{"float", func(doc *element.Node) { doc.QuerySelector("#side").SetStyle("width", "80px") }},
+		{"inline", func(doc *element.Node) { doc.QuerySelector("#flow").SetStyle("margin-top", "2px") }},
+		{"list", func(doc *element.Node) { doc.QuerySelector("#list").Children[0].SetInnerText("first") }},
+		{"absolute", func(doc *element.Node) { doc.QuerySelector("#pos").SetStyle("padding-top", "20px") }},
+	}
+	for _, test := range tests {
+		w, err := OpenString(incrementalPage, headless.Init().Adapter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := NewRuntime(&w, 300, 400)
+		r.Step()
+		r.Step()
+		list := w.Document.QuerySelector("#list").Properties.Layout
+
+		test.change(w.Document.Children[0])
+		r.Step()
+		got := r.States()
+		if test.name != "list" && w.Document.QuerySelector("#list").Properties.Layout != list {
+			t.Errorf("%s: the list was copied again", test.name)
+		}
+
+		want := relayout(r)
+		if len(got) != len(want) {
+			t.Errorf("%s: %d states, want %d", test.name, len(got), len(want))
+			r.Close()
+			continue
+		}
+		for i := range got {
+			if !sameState(got[i], want[i]) {
+				t.Errorf("%s: state %d is %+v, want %+v", test.name, i, got[i], want[i])
+				break
+			}
+		}
+		r.Close()
+	}
+}
+
+// sameState compares two states, the positions can be off by rounding
+func sameState(a, b element.State) bool {
+	near := func(x, y float32) bool {
+		return x-y < 0.01 && y-x < 0.01
+	}
+	if !near(a.X, b.X) || !near(a.Y, b.Y) || !near(a.Width, b.Width) || !near(a.Height, b.Height) {
+		return false
+	}
+	a.X, a.Y, a.Width, a.Height = b.X, b.Y, b.Width, b.Height
+	return reflect.DeepEqual(a, b)
+}
+
+// TestPosition checks the x, y, width and height of positioned elements, the scroll container is scrolled to each
+// + scrollTop first. A scrollTop is in pixels of the scrollbar so 10 moves the 400px of content in #s 40px
+func TestPosition(t *testing.T) {
+	relative := `<div id="a" style="height: 10px"></div>
+<div id="b" style="position: relative; top: 10px; left: 20px; height: 10px"></div>
+<div id="c" style="height: 10px"></div>
+<div id="d" style="position: relative; bottom: 5px; right: 5px; width: 50%; height: 10px"></div>
+<div id="e" style="height: 10px"></div>`
+	scroll := `<div id="s" style="width: 200px; height: 100px; overflow: auto">
+<div id="section" style="height: 150px"><div style="height: 30px"></div><div id="h" style="position: sticky; top: 0; height: 20px"></div></div>
+<div id="next" style="height: 250px"></div>
+<div id="fixed" style="position: fixed; top: 10px; left: 10px; width: 30px; height: 30px"></div>
+</div>
+<div id="corner" style="position: fixed; right: 0; bottom: 0; width: 30px; height: 30px"></div>`
+
+	tests := []struct {
+		name      string
+		body      string
+		scrollTop int
+		want      map[string][4]float32
+	}{
+		{"relative offsets don't move the siblings", relative, 0, map[string][4]float32{
+			"a": {0, 0, 600, 10}, "b": {20, 20, 600, 10}, "c": {0, 20, 600, 10}, "d": {-5, 25, 300, 10}, "e": {0, 40, 600, 10},
+		}},
+		{"fixed against the viewport", scroll, 0, map[string][4]float32{"fixed": {10, 10, 30, 30}, "corner": {570, 370, 30, 30}}},
+		{"fixed doesn't scroll", scroll, 35, map[string][4]float32{"fixed": {10, 10, 30, 30}, "next": {0, 10, 186, 250}}},
+		{"sticky before its line", scroll, 5, map[string][4]float32{"h": {0, 10, 186, 20}}},
+		{"sticky at the top", scroll, 10, map[string][4]float32{"section": {0, -40, 186, 150}, "h": {0, 0, 186, 20}}},
+		{"sticky at the end of its parent", scroll, 35, map[string][4]float32{"section": {0, -140, 186, 150}, "h": {0, -10, 186, 20}}},
+		{"sticky with its parent out of view", scroll, 60, map[string][4]float32{"h": {0, -110, 186, 20}}},
+	}
+	for _, test := range tests {
+		w, err := OpenString("<html><head><style>body { margin: 0 }</style></head><body>"+test.body+"</body></html>", headless.Init().Adapter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := NewRuntime(&w, 600, 400)
+		r.Step()
+		if test.scrollTop != 0 {
+			w.Document.QuerySelector("#s").ScrollTo(0, test.scrollTop)
+			r.Step()
+		}
+		for id, want := range test.want {
+			s := w.Document.QuerySelector("#" + id).Properties.State
+			if got := [4]float32{s.X, s.Y, s.Width, s.Height}; got != want {
+				t.Errorf("%s: #%s is at %v, want %v", test.name, id, got, want)
+			}
+		}
+		r.Close()
+	}
+}
+
+// TestOpenFS reads a document and the sheets it links and imports from an fs.FS
+func TestOpenFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"site/index.html":          {Data: []byte(`<html><head><link rel="stylesheet" href="css/main.css"><style>p { margin-left: 3px }</style></head><body><p id="p">text</p></body></html>`)},
+		"site/css/main.css":        {Data: []byte(`@import "base.css"; @import url("theme/theme.css"); p { width: 20px }`)},
+		"site/css/base.css":        {Data: []byte(`p { color: red; width: 10px; margin-left: 1px }`)},
+		"site/css/theme/theme.css": {Data: []byte(`p { color: green; height: 5px }`)},
+		"cycle.html":               {Data: []byte(`<html><head><link rel="stylesheet" href="a.css"></head><body><p id="p">text</p></body></html>`)},
+		"a.css":                    {Data: []byte(`@import "b.css"; p { color: red }`)},
+		"b.css":                    {Data: []byte(`@import "a.css"; @import "missing.css"; p { width: 10px }`)},
+		"missing.html":             {Data: []byte(`<html><head><link rel="stylesheet" href="missing.css"></head><body></body></html>`)},
+	}
+
+	w, err := OpenFS(fsys, "site/index.html", headless.Init().Adapter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"site/css/main.css", "site/css/base.css", "site/css/theme/theme.css"}; !reflect.DeepEqual(w.CSS.Files, want) {
+		t.Errorf("Files = %v, want %v", w.CSS.Files, want)
+	}
+	r := NewRuntime(&w, 200, 100)
+	r.Step()
+	// The imported sheets come before the sheet that imports them and the style tag after the link
+	computed := w.Document.QuerySelector("#p").Properties.Computed
+	for property, want := range map[string]string{"color": "green", "width": "20px", "height": "5px", "margin-left": "3px"} {
+		if computed[property] != want {
+			t.Errorf("%s = %q, want %q", property, computed[property], want)
+		}
+	}
+	r.Close()
+
+	w, err = OpenFS(fsys, "cycle.html", headless.Init().Adapter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages []string
+	for _, v := range w.CSS.Errors {
+		messages = append(messages, v.Error())
+	}
+	if len(messages) != 2 || !strings.Contains(messages[0], "import cycle a.css -> b.css -> a.css") || !strings.Contains(messages[1], "stylesheet missing.css") {
+		t.Errorf("Errors = %q, want an import cycle and a missing sheet", messages)
+	}
+	if len(w.CSS.StyleSheets) == 0 {
+		t.Error("the sheets in the cycle weren't added")
+	}
+
+	if _, err := OpenFS(fsys, "missing.html", headless.Init().Adapter); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("OpenFS with a missing linked sheet = %v, want fs.ErrNotExist", err)
+	}
+}
+
+// TestGetComputedStyle checks that percentages and ems are px in the computed style after a layout
+func TestGetComputedStyle(t *testing.T) {
+	w, err := OpenString(`<html><head><style>body { margin: 0 } #parent { width: 400px }
+#box { font-size: 1.25em; width: 50%; height: 2em; padding: 1em 5%; margin-left: 10%; border: 0.5em solid red; color: blue; text-indent: 2em }
+</style></head><body><div id="parent"><div id="box"></div></div></body></html>`, headless.Init().Adapter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRuntime(&w, 600, 400)
+	defer r.Close()
+	r.Step()
+
+	styles := w.GetComputedStyle(w.Document.QuerySelector("#box"))
+	for property, want := range map[string]string{
+		"font-size":         "20px",
+		"width":             "200px",
+		"height":            "40px",
+		"padding-top":       "20px",
+		"padding-left":      "20px",
+		"margin-left":       "40px",
+		"border-left-width": "10px",
+		"text-indent":       "40px",
+		"color":             "rgb(0, 0, 255)",
+	} {
+		if styles[property] != want {
+			t.Errorf("%s = %q, want %q", property, styles[property], want)
+		}
+	}
+
+	w.Document.QuerySelector("#parent").SetStyle("width", "300px")
+	r.Step()
+	if got := w.GetComputedStyle(w.Document.QuerySelector("#box"))["width"]; got != "150px" {
+		t.Errorf("width after the parent changed = %q, want 150px", got)
+	}
+}
+
+// TestTextNodes checks that text is kept in text nodes in source order and that its whitespace is collapsed when it
+// + is laid out, the words depend on the fonts of the system so only where the elements after them end up is checked
+func TestTextNodes(t *testing.T) {
+	w, err := OpenString(`<html><head><style>body { margin: 0 } p { margin: 0 }</style></head><body>
+<p id="mixed">first <b id="bold">bold</b> last <i id="italic">it</i></p>
+<p>one two<b id="single">x</b></p>
+<p>one     two<b id="spaces">x</b></p>
+<p>one
+	  two<b id="lines">x</b></p>
+<p>
+   <b id="leading">x</b></p>
+<p><b id="before">x</b> <b id="after">x</b></p>
+</body></html>`, headless.Init().Adapter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRuntime(&w, 600, 400)
+	defer r.Close()
+	r.Step()
+
+	var tags, text []string
+	for _, v := range w.Document.QuerySelector("#mixed").Children {
+		tags = append(tags, v.TagName)
+		text = append(text, v.InnerText)
+	}
+	if want := []string{"#text", "b", "#text", "i"}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("the children of #mixed are %v, want %v", tags, want)
+	}
+	if want := []string{"first ", "bold", " last ", "it"}; !reflect.DeepEqual(text, want) {
+		t.Errorf("the text of #mixed is %q, want %q", text, want)
+	}
+
+	box := func(id string) element.State {
+		return w.Document.QuerySelector("#" + id).Properties.State
+	}
+	bold, italic := box("bold"), box("italic")
+	if bold.X <= 0 || italic.X <= bold.X+bold.Width || italic.Y != bold.Y {
+		t.Errorf("#bold at %v, %v and #italic at %v, %v aren't after the text before them on one line", bold.X, bold.Y, italic.X, italic.Y)
+	}
+	for _, id := range []string{"spaces", "lines"} {
+		if box(id).X != box("single").X {
+			t.Errorf("#%s is at %v, want %v as after one space", id, box(id).X, box("single").X)
+		}
+	}
+	if box("leading").X != 0 {
+		t.Errorf("#leading is at %v, want 0 without the whitespace before it", box("leading").X)
+	}
+	if before, after := box("before"), box("after"); after.X <= before.X+before.Width {
+		t.Errorf("#after is at %v, want the space between it and #before kept", after.X)
+	}
+
+	var walk func(n *element.Node)
+	walk = func(n *element.Node) {
+		if n.TagName == "notaspan" {
+			t.Errorf("%s has a notaspan wrapper", n.Parent.TagName)
+		}
+		for _, v := range n.Children {
+			walk(v)
+		}
+	}
+	walk(&w.Document)
+}
+
+// TestImageTexture checks that a <img> keeps one texture for its picture and swaps it when the image is resized
+func TestImageTexture(t *testing.T) {
+	var data bytes.Buffer
+	if err := png.Encode(&data, image.NewRGBA(image.Rect(0, 0, 40, 20))); err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{
+		"index.html": {Data: []byte(`<html><head><style>body { margin: 0 }</style></head><body><img id="i" src="a.png" style="border: 1px solid red"></body></html>`)},
+		"a.png":      {Data: data.Bytes()},
+	}
+	w, err := OpenFS(fsys, "index.html", headless.Init().Adapter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRuntime(&w, 200, 100)
+	defer r.Close()
+	r.Step()
+
+	i := w.Document.QuerySelector("#i")
+	first := i.Properties.State
+	if first.Width != 40 || first.Height != 20 {
+		t.Errorf("the image is %vx%v, want 40x20", first.Width, first.Height)
+	}
+	if first.ImageTexture == "" || !slices.Contains(first.Textures, first.ImageTexture) {
+		t.Fatalf("the image texture %q isn't in %q", first.ImageTexture, first.Textures)
+	}
+
+	i.SetStyle("width", "80px")
+	r.Step()
+	second := i.Properties.State
+	if second.ImageTexture == first.ImageTexture || slices.Contains(second.Textures, first.ImageTexture) {
+		t.Errorf("the texture of the old size is still used, %q", second.Textures)
+	}
+	if !slices.Contains(second.Textures, second.ImageTexture) || len(second.Textures) != len(first.Textures) {
+		t.Errorf("textures after the resize are %q, want %d with %q", second.Textures, len(first.Textures), second.ImageTexture)
+	}
+}
@@ -0,0 +1,482 @@
+package media
+
+import (
+	"fmt"
+	"gui/tokenizer"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Environment is what media queries are tested against
+type Environment struct {
+	Width  float32
+	Height float32
+	// PixelRatio is the number of device pixels per CSS pixel, it is the resolution in dppx
+	PixelRatio float32
+	// ColorScheme is "light" or "dark", empty is light
+	ColorScheme string
+}
+
+// List is a comma separated media query list, it matches if any of the queries match. An empty list matches
+// + everything (ex: @media {})
+type List []Query
+
+type Query struct {
+	Not bool
+	// Type is all, screen, print... It is empty when the query is only a condition
+	Type string
+	// Condition is nil when the query is only a type
+	Condition *Condition
+	// Invalid queries never match, like "not all"
+	Invalid bool
+}
+
+// Condition is a tree of features joined by and, or and not
+type Condition struct {
+	// Op is "and", "or" or "not" for the Children, it is empty for a single Feature
+	Op       string
+	Children []*Condition
+	Feature  Feature
+}
+
+type Feature struct {
+	Name string
+	// Comparisons test the feature against values, min-width: 600px is {">=", "600px"} and 400px < width is
+	// + {">", "400px"}. There are none for a boolean feature like (color)
+	Comparisons []Comparison
+}
+
+type Comparison struct {
+	Op    string
+	Value string
+}
+
+// Parse parses a media query list, a query that can't be parsed is kept as an invalid query that never matches
+// + and the first error is returned
+func Parse(s string) (List, error) {
+	tokens := []tokenizer.Token{}
+	for _, v := range tokenizer.Tokenize(s) {
+		if v.Type != tokenizer.Whitespace && v.Type != tokenizer.EOF {
+			tokens = append(tokens, v)
+		}
+	}
+
+	list := List{}
+	if len(tokens) == 0 {
+		return list, nil
+	}
+	var firstErr error
+	start, depth := 0, 0
+	for i := 0; i <= len(tokens); i++ {
+		if i < len(tokens) {
+			switch tokens[i].Type {
+			case tokenizer.OpenParen, tokenizer.Function:
+				depth++
+			case tokenizer.CloseParen:
+				depth--
+			}
+			if tokens[i].Type != tokenizer.Comma || depth > 0 {
+				continue
+			}
+		}
+		q, err := parseQuery(tokens[start:i])
+		if err != nil {
+			q = Query{Invalid: true}
+			if firstErr == nil {
+				firstErr = fmt.Errorf("media: %w in %q", err, s)
+			}
+		}
+		list = append(list, q)
+		start = i + 1
+	}
+	return list, firstErr
+}
+
+func parseQuery(tokens []tokenizer.Token) (Query, error) {
+	q := Query{}
+	if len(tokens) == 0 {
+		return q, fmt.Errorf("empty query")
+	}
+
+	i := 0
+	if isIdent(tokens[0], "not") || isIdent(tokens[0], "only") {
+		if len(tokens) > 1 && tokens[1].Type == tokenizer.Ident {
+			q.Not = isIdent(tokens[0], "not")
+			i++
+		}
+	}
+	if tokens[i].Type == tokenizer.Ident && !isIdent(tokens[i], "not") {
+		q.Type = strings.ToLower(tokens[i].Value)
+		i++
+		if i == len(tokens) {
+			return q, nil
+		}
+		if !isIdent(tokens[i], "and") {
+			return q, fmt.Errorf("expected and after %q", q.Type)
+		}
+		i++
+		// The condition after a type can't use or at the top level
+		cond, err := parseCondition(tokens[i:])
+		if err != nil {
+			return q, err
+		}
+		if cond.Op == "or" {
+			return q, fmt.Errorf("or after a media type needs brackets")
+		}
+		q.Condition = cond
+		return q, nil
+	}
+
+	cond, err := parseCondition(tokens[i:])
+	q.Condition = cond
+	return q, err
+}
+
+func parseCondition(tokens []tokenizer.Token) (*Condition, error) {
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("expected a condition")
+	}
+	if isIdent(tokens[0], "not") {
+		child, end, err := parseInParens(tokens, 1)
+		if err != nil {
+			return nil, err
+		}
+		if end != len(tokens) {
+			return nil, fmt.Errorf("unexpected %q after not", tokens[end].Raw)
+		}
+		return &Condition{Op: "not", Children: []*Condition{child}}, nil
+	}
+
+	first, i, err := parseInParens(tokens, 0)
+	if err != nil {
+		return nil, err
+	}
+	if i == len(tokens) {
+		return first, nil
+	}
+
+	cond := &Condition{Children: []*Condition{first}}
+	for i < len(tokens) {
+		op := strings.ToLower(tokens[i].Value)
+		if tokens[i].Type != tokenizer.Ident || (op != "and" && op != "or") {
+			return nil, fmt.Errorf("unexpected %q", tokens[i].Raw)
+		}
+		if cond.Op != "" && cond.Op != op {
+			return nil, fmt.Errorf("and and or can't be mixed without brackets")
+		}
+		cond.Op = op
+		var child *Condition
+		child, i, err = parseInParens(tokens, i+1)
+		if err != nil {
+			return nil, err
+		}
+		cond.Children = append(cond.Children, child)
+	}
+	return cond, nil
+}
+
+// parseInParens parses a (condition) or (feature) starting at i and returns the index after it
+func parseInParens(tokens []tokenizer.Token, i int) (*Condition, int, error) {
+	if i >= len(tokens) || tokens[i].Type != tokenizer.OpenParen {
+		return nil, i, fmt.Errorf("expected (")
+	}
+	depth := 0
+	end := -1
+	for j := i; j < len(tokens) && end == -1; j++ {
+		switch tokens[j].Type {
+		case tokenizer.OpenParen, tokenizer.Function:
+			depth++
+		case tokenizer.CloseParen:
+			depth--
+			if depth == 0 {
+				end = j
+			}
+		}
+	}
+	if end == -1 {
+		return nil, i, fmt.Errorf("unclosed (")
+	}
+
+	inner := tokens[i+1 : end]
+	if len(inner) > 0 && (inner[0].Type == tokenizer.OpenParen || isIdent(inner[0], "not")) {
+		cond, err := parseCondition(inner)
+		return cond, end + 1, err
+	}
+	feature, err := parseFeature(inner)
+	return &Condition{Feature: feature}, end + 1, err
+}
+
+// parseFeature parses name, name: value and the range forms (width >= 600px, 400px < width <= 800px)
+func parseFeature(tokens []tokenizer.Token) (Feature, error) {
+	f := Feature{}
+	if len(tokens) == 0 {
+		return f, fmt.Errorf("empty ()")
+	}
+	if len(tokens) == 1 && tokens[0].Type == tokenizer.Ident {
+		f.Name = strings.ToLower(tokens[0].Value)
+		return f, nil
+	}
+	if tokens[0].Type == tokenizer.Ident && len(tokens) > 2 && tokens[1].Type == tokenizer.Colon {
+		f.Name = strings.ToLower(tokens[0].Value)
+		op := "="
+		if name, ok := strings.CutPrefix(f.Name, "min-"); ok {
+			f.Name, op = name, ">="
+		} else if name, ok := strings.CutPrefix(f.Name, "max-"); ok {
+			f.Name, op = name, "<="
+		}
+		f.Comparisons = []Comparison{{Op: op, Value: join(tokens[2:])}}
+		return f, nil
+	}
+
+	// Split the range into its parts and the operators between them
+	parts := [][]tokenizer.Token{{}}
+	ops := []string{}
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.Type != tokenizer.Delim || (t.Value != "<" && t.Value != ">" && t.Value != "=") {
+			parts[len(parts)-1] = append(parts[len(parts)-1], t)
+			continue
+		}
+		op := t.Value
+		if op != "=" && i+1 < len(tokens) && tokens[i+1].Type == tokenizer.Delim && tokens[i+1].Value == "=" {
+			op += "="
+			i++
+		}
+		ops = append(ops, op)
+		parts = append(parts, []tokenizer.Token{})
+	}
+
+	isName := func(p []tokenizer.Token) bool {
+		return len(p) == 1 && p[0].Type == tokenizer.Ident
+	}
+	switch {
+	case len(parts) == 2 && isName(parts[0]):
+		f.Name = strings.ToLower(parts[0][0].Value)
+		f.Comparisons = []Comparison{{Op: ops[0], Value: join(parts[1])}}
+	case len(parts) == 2 && isName(parts[1]):
+		f.Name = strings.ToLower(parts[1][0].Value)
+		f.Comparisons = []Comparison{{Op: flip(ops[0]), Value: join(parts[0])}}
+	case len(parts) == 3 && isName(parts[1]) && ops[0][0] == ops[1][0] && ops[0] != "=":
+		f.Name = strings.ToLower(parts[1][0].Value)
+		f.Comparisons = []Comparison{{Op: flip(ops[0]), Value: join(parts[0])}, {Op: ops[1], Value: join(parts[2])}}
+	default:
+		return f, fmt.Errorf("invalid media feature %q", join(tokens))
+	}
+	for _, v := range f.Comparisons {
+		if v.Value == "" {
+			return f, fmt.Errorf("missing value for %q", f.Name)
+		}
+	}
+	return f, nil
+}
+
+// flip turns "600px < width" around to "width > 600px"
+func flip(op string) string {
+	switch op {
+	case "<":
+		return ">"
+	case ">":
+		return "<"
+	case "<=":
+		return ">="
+	case ">=":
+		return "<="
+	}
+	return op
+}
+
+func join(tokens []tokenizer.Token) string {
+	var b strings.Builder
+	for _, v := range tokens {
+		b.WriteString(v.Raw)
+	}
+	return b.String()
+}
+
+func isIdent(t tokenizer.Token, name string) bool {
+	return t.Type == tokenizer.Ident && strings.EqualFold(t.Value, name)
+}
+
+// Match reports if any query in the list matches env
+func (l List) Match(env Environment) bool {
+	if len(l) == 0 {
+		return true
+	}
+	for _, v := range l {
+		if v.Match(env) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q Query) Match(env Environment) bool {
+	if q.Invalid {
+		return false
+	}
+	// Everything is drawn to a screen
+	matches := q.Type == "" || q.Type == "all" || q.Type == "screen"
+	if matches && q.Condition != nil {
+		matches = q.Condition.Match(env)
+	}
+	return matches != q.Not
+}
+
+func (c *Condition) Match(env Environment) bool {
+	switch c.Op {
+	case "not":
+		return !c.Children[0].Match(env)
+	case "and":
+		for _, v := range c.Children {
+			if !v.Match(env) {
+				return false
+			}
+		}
+		return true
+	case "or":
+		for _, v := range c.Children {
+			if v.Match(env) {
+				return true
+			}
+		}
+		return false
+	}
+	return c.Feature.Match(env)
+}
+
+// Match tests the feature, unknown features and values that can't be read don't match
+func (f Feature) Match(env Environment) bool {
+	colorScheme := env.ColorScheme
+	if colorScheme == "" {
+		colorScheme = "light"
+	}
+	orientation := "landscape"
+	if env.Height >= env.Width {
+		orientation = "portrait"
+	}
+	pixelRatio := env.PixelRatio
+	if pixelRatio == 0 {
+		pixelRatio = 1
+	}
+
+	// Discrete features compare keywords
+	var keyword string
+	switch f.Name {
+	case "orientation":
+		keyword = orientation
+	case "prefers-color-scheme":
+		keyword = colorScheme
+	}
+	if keyword != "" {
+		for _, v := range f.Comparisons {
+			if v.Op != "=" || !strings.EqualFold(v.Value, keyword) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var value float64
+	var parse func(string) (float64, bool)
+	switch f.Name {
+	case "width":
+		value, parse = float64(env.Width), length
+	case "height":
+		value, parse = float64(env.Height), length
+	case "aspect-ratio":
+		if env.Height == 0 {
+			return false
+		}
+		value, parse = float64(env.Width/env.Height), ratio
+	case "resolution":
+		value, parse = float64(pixelRatio), resolution
+	case "color":
+		// Bits per color component
+		value, parse = 8, number
+	case "monochrome", "grid":
+		value, parse = 0, number
+	default:
+		return false
+	}
+
+	if len(f.Comparisons) == 0 {
+		return value != 0
+	}
+	for _, v := range f.Comparisons {
+		want, ok := parse(v.Value)
+		if !ok || !compare(value, v.Op, want) {
+			return false
+		}
+	}
+	return true
+}
+
+func compare(a float64, op string, b float64) bool {
+	switch op {
+	case "=":
+		return math.Abs(a-b) < 0.001
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b+0.001
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b-0.001
+	}
+	return false
+}
+
+// length reads a length in px, em and rem are 16px like the initial font size
+func length(s string) (float64, bool) {
+	s = strings.ToLower(s)
+	for _, unit := range []struct {
+		suffix string
+		scale  float64
+	}{{"px", 1}, {"rem", 16}, {"em", 16}, {"in", 96}, {"cm", 96 / 2.54}, {"mm", 96 / 25.4}, {"pt", 96.0 / 72}} {
+		if v, ok := strings.CutSuffix(s, unit.suffix); ok {
+			n, err := strconv.ParseFloat(v, 64)
+			return n * unit.scale, err == nil
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	return n, err == nil && n == 0
+}
+
+// resolution reads a resolution in dppx
+func resolution(s string) (float64, bool) {
+	s = strings.ToLower(s)
+	for _, unit := range []struct {
+		suffix string
+		scale  float64
+	}{{"dppx", 1}, {"dpcm", 2.54 / 96}, {"dpi", 1.0 / 96}, {"x", 1}} {
+		if v, ok := strings.CutSuffix(s, unit.suffix); ok {
+			n, err := strconv.ParseFloat(v, 64)
+			return n * unit.scale, err == nil
+		}
+	}
+	return 0, false
+}
+
+// ratio reads 16/9 or a single number
+func ratio(s string) (float64, bool) {
+	a, b, found := strings.Cut(s, "/")
+	w, err := strconv.ParseFloat(strings.TrimSpace(a), 64)
+	if err != nil {
+		return 0, false
+	}
+	if !found {
+		return w, true
+	}
+	h, err := strconv.ParseFloat(strings.TrimSpace(b), 64)
+	if err != nil || h == 0 {
+		return 0, false
+	}
+	return w / h, true
+}
+
+func number(s string) (float64, bool) {
+	n, err := strconv.ParseFloat(s, 64)
+	return n, err == nil
+}
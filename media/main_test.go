@@ -0,0 +1,61 @@
+package media
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	env := Environment{Width: 800, Height: 600, PixelRatio: 2, ColorScheme: "dark"}
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"", true},
+		{"all", true},
+		{"screen", true},
+		{"print", false},
+		{"not print", true},
+		{"not screen", false},
+		{"(min-width: 600px)", true},
+		{"(min-width: 801px)", false},
+		{"(max-width: 800px)", true},
+		{"(width: 800px)", true},
+		{"(min-width: 30em)", true},
+		{"(400px < width <= 800px)", true},
+		{"(400px < width < 800px)", false},
+		{"(height > 600px)", false},
+		{"screen and (min-width: 600px) and (max-height: 700px)", true},
+		{"print and (min-width: 600px)", false},
+		{"(max-width: 100px), (orientation: landscape)", true},
+		{"(orientation: portrait)", false},
+		{"(min-aspect-ratio: 4/3)", true},
+		{"(min-aspect-ratio: 16/9)", false},
+		{"(prefers-color-scheme: dark)", true},
+		{"(prefers-color-scheme: light)", false},
+		{"(min-resolution: 2dppx)", true},
+		{"(resolution: 192dpi)", true},
+		{"(min-resolution: 3x)", false},
+		{"not ((max-width: 100px) or (max-height: 100px))", true},
+		{"(width)", true},
+		{"(unknown-feature: 1)", false},
+		{"screen and", false},
+		{"(min-width: 600px) garbage", false},
+	}
+	for _, test := range tests {
+		list, _ := Parse(test.query)
+		if got := list.Match(env); got != test.want {
+			t.Errorf("%q matches = %v, want %v", test.query, got, test.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, v := range []string{"screen and", "(min-width: 600px", "(width <)"} {
+		if _, err := Parse(v); err == nil {
+			t.Errorf("Parse(%q) didn't return an error", v)
+		}
+	}
+	for _, v := range []string{"screen", "(min-width: 600px)", "not all and (color)", "(400px <= width <= 700px)"} {
+		if _, err := Parse(v); err != nil {
+			t.Errorf("Parse(%q): %v", v, err)
+		}
+	}
+}
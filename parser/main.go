@@ -1,88 +1,525 @@
 package parser
 
 import (
+	"fmt"
 	"gui/selector"
-	"regexp"
+	"gui/tokenizer"
+	"slices"
 	"strings"
 )
 
 type StyleMap struct {
-	Selector    [][]string
+	Selector    selector.Selector
 	Styles      *map[string]string
 	SheetNumber int
+	// Important holds the properties of Styles that were marked !important, the flag is removed from the value
+	Important map[string]bool
+	// Specificity is cached from Selector, Order is the position of the rule in its stylesheet
+	Specificity selector.Specificity
+	Order       int
+	Origin      Origin
+	// Media are the queries of the @media rules the rule is inside of, all of them have to match
+	Media []string
 }
 
-func ProcessStyles(selectString string) map[string]*StyleMap {
-	sm := StyleMap{}
-	styleMapMap := map[string]*StyleMap{}
+// Origin is where a rule comes from, it decides the order of the cascade before specificity does
+type Origin int
 
-	parts := strings.Split(selectString, ">")
-	sm.Selector = make([][]string, len(parts))
+const (
+	Author Origin = iota
+	// UserAgent is master.css, its normal declarations lose to everything and its !important ones win over everything
+	UserAgent
+)
 
-	for i, v := range parts {
-		part := selector.SplitSelector(strings.TrimSpace(v))
-		sm.Selector[i] = part
+// ProcessStyles parses a selector list into a StyleMap per selector, keyed by the part of the selector they are
+// + indexed by (see selector.Key). Invalid selectors return nothing so their rule is dropped
+func ProcessStyles(selectString string) map[string][]*StyleMap {
+	styleMapMap := map[string][]*StyleMap{}
 
-		for _, b := range part {
-			styleMapMap[b] = &sm
-		}
+	list, err := selector.Parse(selectString)
+	if err != nil {
+		return styleMapMap
+	}
+
+	for _, v := range list {
+		key := v.Key()
+		styleMapMap[key] = append(styleMapMap[key], &StyleMap{Selector: v, Specificity: v.Specificity()})
 	}
 	return styleMapMap
 }
 
+// ParseCSS parses a stylesheet and flattens its style rules into a map of the declarations by selector and the
+// + StyleMaps by key. Use Parse to get the parse errors and the at-rules
 func ParseCSS(css string) (map[string]*map[string]string, map[string][]*StyleMap) {
-	selectorMap := make(map[string]*map[string]string)
+	return Parse(css).StyleMaps()
+}
+
+// Stylesheet is the rule tree of a stylesheet, rules with errors are left out and reported in Errors
+type Stylesheet struct {
+	Rules  []*Rule
+	Errors []Error
+}
+
+// Rule is a style rule or an at-rule. Style rules and at-rules with a block can hold both declarations
+// + and nested rules (ex: @media holds rules, @font-face holds declarations)
+type Rule struct {
+	// AtRule is the name of an at-rule without the @, it is empty for style rules
+	AtRule string
+	// Prelude is the selector of a style rule or what is between the name of an at-rule and its block
+	Prelude      string
+	Declarations []Declaration
+	Rules        []*Rule
+	// Block is false for at-rules that end with a ; (ex: @import)
+	Block  bool
+	Line   int
+	Column int
+}
+
+type Declaration struct {
+	Property  string
+	Value     string
+	Important bool
+	Line      int
+	Column    int
+}
+
+// Error is a parse error, the rule or declaration it is in is dropped like in browsers
+type Error struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+// Parse tokenizes css and parses it into a rule tree following CSS Syntax Module Level 3
+func Parse(css string) *Stylesheet {
+	p := &cssParser{tokens: tokenizer.Tokenize(css)}
+	sheet := &Stylesheet{Rules: p.rules(true)}
+	// Errors inside of a block are added when the block ends
+	slices.SortStableFunc(p.errors, func(a, b Error) int {
+		if a.Line != b.Line {
+			return a.Line - b.Line
+		}
+		return a.Column - b.Column
+	})
+	sheet.Errors = p.errors
+	return sheet
+}
 
-	// Remove comments
-	css = removeComments(css)
+type cssParser struct {
+	tokens []tokenizer.Token
+	i      int
+	errors []Error
+}
+
+func (p *cssParser) peek() tokenizer.Token {
+	if p.i < len(p.tokens) {
+		return p.tokens[p.i]
+	}
+	return tokenizer.Token{Type: tokenizer.EOF}
+}
 
-	// Parse regular selectors and styles
-	selectorRegex := regexp.MustCompile(`([^{]+){([^}]+)}`)
-	matches := selectorRegex.FindAllStringSubmatch(css, -1)
+func (p *cssParser) errorf(t tokenizer.Token, format string, a ...any) {
+	p.errors = append(p.errors, Error{Line: t.Line, Column: t.Column, Message: fmt.Sprintf(format, a...)})
+}
+
+// rules reads a list of rules, top is set for the stylesheet where <!-- and --> are ignored and @import is allowed
+// + before the other rules
+func (p *cssParser) rules(top bool) []*Rule {
+	rules := []*Rule{}
+	imports := top
+	for {
+		t := p.peek()
+		switch {
+		case t.Type == tokenizer.EOF:
+			return rules
+		case t.Type == tokenizer.Whitespace, top && (t.Type == tokenizer.CDO || t.Type == tokenizer.CDC):
+			p.i++
+		case t.Type == tokenizer.AtKeyword:
+			rule := p.atRule()
+			switch rule.AtRule {
+			case "import":
+				if !imports {
+					p.errorf(t, "@import is only allowed before the other rules")
+					continue
+				}
+				if _, ok := parseImport(rule); !ok {
+					p.errorf(t, "invalid @import %q", rule.Prelude)
+					continue
+				}
+			case "charset", "layer":
+			default:
+				imports = false
+			}
+			rules = append(rules, rule)
+		default:
+			imports = false
+			if rule := p.styleRule(); rule != nil {
+				rules = append(rules, rule)
+			}
+		}
+	}
+}
+
+func (p *cssParser) atRule() *Rule {
+	t := p.peek()
+	p.i++
+	rule := &Rule{AtRule: strings.ToLower(t.Value), Line: t.Line, Column: t.Column}
+	start := p.i
+	for {
+		switch p.peek().Type {
+		case tokenizer.Semicolon:
+			rule.Prelude = join(p.tokens[start:p.i])
+			p.i++
+			return rule
+		case tokenizer.EOF:
+			rule.Prelude = join(p.tokens[start:p.i])
+			return rule
+		case tokenizer.OpenCurly:
+			rule.Prelude = join(p.tokens[start:p.i])
+			rule.Block = true
+			rule.Declarations, rule.Rules = p.block()
+			return rule
+		default:
+			p.skipComponent()
+		}
+	}
+}
+
+// styleRule reads a selector and its block, nil is returned if the file ends before the block
+func (p *cssParser) styleRule() *Rule {
+	t := p.peek()
+	start := p.i
+	for {
+		switch p.peek().Type {
+		case tokenizer.EOF:
+			p.errorf(t, "unexpected end of file, expected { after %q", join(p.tokens[start:p.i]))
+			return nil
+		case tokenizer.OpenCurly:
+			rule := &Rule{Prelude: join(p.tokens[start:p.i]), Block: true, Line: t.Line, Column: t.Column}
+			rule.Declarations, rule.Rules = p.block()
+			if rule.Prelude == "" {
+				p.errorf(t, "missing selector")
+				return nil
+			}
+			return rule
+		default:
+			p.skipComponent()
+		}
+	}
+}
+
+// block reads the contents of a {} block starting at the {, it can hold declarations, at-rules and nested rules
+func (p *cssParser) block() ([]Declaration, []*Rule) {
+	open := p.peek()
+	end := p.matching()
+	if end == -1 {
+		p.errorf(open, "unclosed {")
+		end = len(p.tokens) - 1
+	}
+	// The contents are parsed on their own so an error inside can't read past the }
+	inner := append(p.tokens[p.i+1:end:end], tokenizer.Token{Type: tokenizer.EOF, Line: p.tokens[end].Line, Column: p.tokens[end].Column})
+	sub := &cssParser{tokens: inner}
+	p.i = end + 1
+
+	declarations := []Declaration{}
+	rules := []*Rule{}
+	for {
+		t := sub.peek()
+		switch t.Type {
+		case tokenizer.EOF:
+			p.errors = append(p.errors, sub.errors...)
+			return declarations, rules
+		case tokenizer.Whitespace, tokenizer.Semicolon:
+			sub.i++
+		case tokenizer.AtKeyword:
+			rules = append(rules, sub.atRule())
+		default:
+			// A { before the next ; makes it a nested rule (ex: a:hover { ... } inside of a rule)
+			start := sub.i
+			nested := false
+			for sub.peek().Type != tokenizer.Semicolon && sub.peek().Type != tokenizer.EOF {
+				if sub.peek().Type == tokenizer.OpenCurly {
+					nested = true
+					break
+				}
+				sub.skipComponent()
+			}
+			if nested {
+				sub.i = start
+				if rule := sub.styleRule(); rule != nil {
+					rules = append(rules, rule)
+				}
+			} else if d, ok := sub.declaration(sub.tokens[start:sub.i]); ok {
+				declarations = append(declarations, d)
+			}
+		}
+	}
+}
+
+// declaration parses "property: value !important" from the tokens between two semicolons
+func (p *cssParser) declaration(tokens []tokenizer.Token) (Declaration, bool) {
+	t := tokens[0]
+	if t.Type != tokenizer.Ident {
+		p.errorf(t, "expected a property name, found %q", join(tokens))
+		return Declaration{}, false
+	}
+	d := Declaration{Property: t.Value, Line: t.Line, Column: t.Column}
+	if !strings.HasPrefix(d.Property, "--") {
+		// Custom properties are case sensitive
+		d.Property = strings.ToLower(d.Property)
+	}
+
+	i := 1
+	for i < len(tokens) && tokens[i].Type == tokenizer.Whitespace {
+		i++
+	}
+	if i == len(tokens) || tokens[i].Type != tokenizer.Colon {
+		p.errorf(t, "expected : after %q", d.Property)
+		return d, false
+	}
+	value := tokens[i+1:]
+
+	// !important is the last thing in the value
+	end := len(value)
+	for end > 0 && value[end-1].Type == tokenizer.Whitespace {
+		end--
+	}
+	if end > 0 && value[end-1].Type == tokenizer.Ident && strings.EqualFold(value[end-1].Value, "important") {
+		bang := end - 2
+		for bang >= 0 && value[bang].Type == tokenizer.Whitespace {
+			bang--
+		}
+		if bang >= 0 && value[bang].Type == tokenizer.Delim && value[bang].Value == "!" {
+			d.Important = true
+			value = value[:bang]
+		}
+	}
+
+	for _, v := range value {
+		if v.Type == tokenizer.BadString || v.Type == tokenizer.BadURL {
+			p.errorf(v, "%s in the value of %q", v.Type, d.Property)
+			return d, false
+		}
+	}
+	d.Value = join(value)
+	if d.Value == "" && !strings.HasPrefix(d.Property, "--") {
+		p.errorf(t, "missing value for %q", d.Property)
+		return d, false
+	}
+	return d, true
+}
+
+// skipComponent moves past one token, or a whole block or function if it starts one
+func (p *cssParser) skipComponent() {
+	switch p.peek().Type {
+	case tokenizer.OpenCurly, tokenizer.OpenSquare, tokenizer.OpenParen, tokenizer.Function:
+		end := p.matching()
+		if end == -1 {
+			p.errorf(p.peek(), "unclosed %s", p.peek().Type)
+			p.i = len(p.tokens) - 1
+			return
+		}
+		p.i = end + 1
+	default:
+		p.i++
+	}
+}
+
+// matching finds the token that closes the block or function at p.i, -1 if the file ends first
+func (p *cssParser) matching() int {
+	stack := []tokenizer.Type{}
+	for j := p.i; j < len(p.tokens); j++ {
+		switch p.tokens[j].Type {
+		case tokenizer.OpenCurly:
+			stack = append(stack, tokenizer.CloseCurly)
+		case tokenizer.OpenSquare:
+			stack = append(stack, tokenizer.CloseSquare)
+		case tokenizer.OpenParen, tokenizer.Function:
+			stack = append(stack, tokenizer.CloseParen)
+		case tokenizer.CloseCurly, tokenizer.CloseSquare, tokenizer.CloseParen:
+			// A closing token that doesn't match the innermost block is part of the block's contents
+			if p.tokens[j].Type == stack[len(stack)-1] {
+				stack = stack[:len(stack)-1]
+				if len(stack) == 0 {
+					return j
+				}
+			}
+		}
+	}
+	return -1
+}
+
+// join puts tokens back into text, whitespace is collapsed to a single space and trimmed from the ends
+func join(tokens []tokenizer.Token) string {
+	var b strings.Builder
+	for _, v := range tokens {
+		if v.Type == tokenizer.Whitespace {
+			b.WriteByte(' ')
+		} else {
+			b.WriteString(v.Raw)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// StyleMaps flattens the style rules of the sheet, nested rules are joined to the selector of their parent and
+// + rules inside of @media keep the queries in StyleMap.Media. Selectors that can't be parsed are added to Errors
+func (s *Stylesheet) StyleMaps() (map[string]*map[string]string, map[string][]*StyleMap) {
+	selectorMap := make(map[string]*map[string]string)
 	styleMaps := map[string][]*StyleMap{}
-	for _, match := range matches {
-		selectorBlock := strings.TrimSpace(match[1])
-		styleBlock := match[2]
-
-		selectors := parseSelectors(selectorBlock)
-		for _, selector := range selectors {
-			styles := parseStyles(styleBlock)
-			selectorMap[selector] = &styles
-			smm := ProcessStyles(selector)
-			for k := range smm {
-				smm[k].Styles = &styles
-				if styleMaps[k] == nil {
-					styleMaps[k] = []*StyleMap{}
+	order := 0
+
+	var flatten func(rules []*Rule, parent string, media []string)
+	flatten = func(rules []*Rule, parent string, media []string) {
+		for _, rule := range rules {
+			if rule.AtRule == "media" {
+				flatten(rule.Rules, parent, append(slices.Clip(media), rule.Prelude))
+				continue
+			}
+			if rule.AtRule != "" {
+				continue
+			}
+			selectorBlock := nest(parent, rule.Prelude)
+			styles, important := declarationMap(rule.Declarations)
+
+			for _, selector := range parseSelectors(selectorBlock) {
+				smm := ProcessStyles(selector)
+				if len(smm) == 0 {
+					s.Errors = append(s.Errors, Error{Line: rule.Line, Column: rule.Column, Message: fmt.Sprintf("invalid selector %q", selector)})
+					continue
+				}
+				selectorMap[selector] = &styles
+				for k, v := range smm {
+					for _, sm := range v {
+						sm.Styles = &styles
+						sm.Important = important
+						sm.Order = order
+						sm.Media = media
+					}
+					styleMaps[k] = append(styleMaps[k], v...)
 				}
-				styleMaps[k] = append(styleMaps[k], smm[k])
 			}
+			order++
+			flatten(rule.Rules, selectorBlock, media)
 		}
 	}
+	flatten(s.Rules, "", nil)
 
 	return selectorMap, styleMaps
 }
 
-func parseSelectors(selectorBlock string) []string {
-	// Split by comma and trim each selector
-	selectors := strings.Split(selectorBlock, ",")
-	for i, selector := range selectors {
-		selectors[i] = strings.TrimSpace(selector)
+// Import is an @import rule, Media is the media query list after the url and is empty when it always applies
+type Import struct {
+	URL    string
+	Media  string
+	Line   int
+	Column int
+}
+
+// Imports returns the @import rules of the sheet in order, the rules of an imported sheet come before the rules
+// + of the sheet that imports it
+func (s *Stylesheet) Imports() []Import {
+	imports := []Import{}
+	for _, rule := range s.Rules {
+		if rule.AtRule != "import" {
+			continue
+		}
+		if v, ok := parseImport(rule); ok {
+			imports = append(imports, v)
+		}
 	}
-	return selectors
+	return imports
 }
 
-func parseStyles(styleBlock string) map[string]string {
-	styleRegex := regexp.MustCompile(`([a-zA-Z-]+)\s*:\s*([^;]+);`)
-	matches := styleRegex.FindAllStringSubmatch(styleBlock, -1)
+// parseImport reads the url of an @import, it can be a string, url(a.css) or url("a.css")
+func parseImport(rule *Rule) (Import, bool) {
+	if rule.Block {
+		return Import{}, false
+	}
+	tokens := tokenizer.Tokenize(rule.Prelude)
+	i := 0
+	for i < len(tokens) && tokens[i].Type == tokenizer.Whitespace {
+		i++
+	}
+	v := Import{Line: rule.Line, Column: rule.Column}
+	switch t := tokens[i]; {
+	case t.Type == tokenizer.String, t.Type == tokenizer.URL:
+		v.URL = t.Value
+		i++
+	case t.Type == tokenizer.Function && strings.EqualFold(t.Value, "url"):
+		i++
+		for i < len(tokens) && tokens[i].Type == tokenizer.Whitespace {
+			i++
+		}
+		if tokens[i].Type != tokenizer.String {
+			return Import{}, false
+		}
+		v.URL = tokens[i].Value
+		for i < len(tokens) && tokens[i].Type != tokenizer.CloseParen {
+			i++
+		}
+		if i == len(tokens) {
+			return Import{}, false
+		}
+		i++
+	default:
+		return Import{}, false
+	}
+	v.Media = join(tokens[i:])
+	return v, v.URL != ""
+}
 
+// nest resolves the selector of a nested rule, & is the parent selector and a selector without it is a descendant
+func nest(parent, child string) string {
+	if parent == "" {
+		return child
+	}
+	if len(parseSelectors(parent)) > 1 {
+		parent = ":is(" + parent + ")"
+	}
+	selectors := []string{}
+	for _, v := range parseSelectors(child) {
+		if strings.Contains(v, "&") {
+			selectors = append(selectors, strings.ReplaceAll(v, "&", parent))
+		} else {
+			selectors = append(selectors, parent+" "+v)
+		}
+	}
+	return strings.Join(selectors, ", ")
+}
+
+func parseSelectors(selectorBlock string) []string {
+	// Split by the commas between selectors, not the ones inside :is(a, b) or [title="a,b"]
+	return selector.SplitList(selectorBlock)
+}
+
+// declarationMap turns the declarations of a rule into a map, a later declaration of a property replaces an earlier
+// + one unless only the earlier one is !important
+func declarationMap(declarations []Declaration) (map[string]string, map[string]bool) {
 	styleMap := make(map[string]string)
-	for _, match := range matches {
-		propName := strings.TrimSpace(match[1])
-		propValue := strings.TrimSpace(match[2])
-		styleMap[propName] = propValue
+	important := make(map[string]bool)
+	for _, v := range declarations {
+		if important[v.Property] && !v.Important {
+			continue
+		}
+		styleMap[v.Property] = v.Value
+		important[v.Property] = v.Important
 	}
 
-	return styleMap
+	return styleMap, important
+}
+
+// Important removes a trailing !important from a value and reports if it was there
+func Important(value string) (string, bool) {
+	i := strings.LastIndexByte(value, '!')
+	if i == -1 || !strings.EqualFold(strings.TrimSpace(value[i+1:]), "important") {
+		return value, false
+	}
+	return strings.TrimSpace(value[:i]), true
 }
 
 func ParseStyleAttribute(styleValue string) map[string]string {
@@ -124,8 +561,3 @@ func parseKeyValue(style string) (string, string) {
 	}
 	return "", ""
 }
-
-func removeComments(css string) string {
-	commentRegex := regexp.MustCompile(`(?s)/\*.*?\*/`)
-	return commentRegex.ReplaceAllString(css, "")
-}
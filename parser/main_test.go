@@ -0,0 +1,146 @@
+package parser
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		css   string
+		rules []Rule
+		// errors are the positions of the parse errors as line:column
+		errors []string
+	}{
+		{
+			name: "style rule",
+			css:  "a, b:hover { color: red !important; margin: 0 }",
+			rules: []Rule{{Prelude: "a, b:hover", Block: true, Declarations: []Declaration{
+				{Property: "color", Value: "red", Important: true},
+				{Property: "margin", Value: "0"},
+			}}},
+		},
+		{
+			name: "at-rules",
+			css:  `@import "a.css" screen; @media (min-width: 10px) { p { x: y } }`,
+			rules: []Rule{
+				{AtRule: "import", Prelude: `"a.css" screen`},
+				{AtRule: "media", Prelude: "(min-width: 10px)", Block: true, Rules: []*Rule{
+					{Prelude: "p", Block: true, Declarations: []Declaration{{Property: "x", Value: "y"}}},
+				}},
+			},
+		},
+		{
+			name: "invalid declarations are dropped",
+			css:  "a { ; color } b { c: } d { e: f }",
+			rules: []Rule{
+				{Prelude: "a", Block: true},
+				{Prelude: "b", Block: true},
+				{Prelude: "d", Block: true, Declarations: []Declaration{{Property: "e", Value: "f"}}},
+			},
+			errors: []string{"1:7", "1:19"},
+		},
+		{
+			name: "nested rules",
+			css:  "a { color: red; & b { x: y } }",
+			rules: []Rule{{Prelude: "a", Block: true, Declarations: []Declaration{{Property: "color", Value: "red"}},
+				Rules: []*Rule{{Prelude: "& b", Block: true, Declarations: []Declaration{{Property: "x", Value: "y"}}}}}},
+		},
+		{
+			name:  "html comments at the top level",
+			css:   "<!-- a { x: y } -->",
+			rules: []Rule{{Prelude: "a", Block: true, Declarations: []Declaration{{Property: "x", Value: "y"}}}},
+		},
+	}
+	for _, test := range tests {
+		sheet := Parse(test.css)
+		if got := strip(sheet.Rules); !slices.EqualFunc(got, test.rules, equalRule) {
+			t.Errorf("%s: Parse(%q)\n got %+v\nwant %+v", test.name, test.css, got, test.rules)
+		}
+		errors := []string{}
+		for _, v := range sheet.Errors {
+			errors = append(errors, fmt.Sprintf("%d:%d", v.Line, v.Column))
+		}
+		if !slices.Equal(errors, test.errors) {
+			t.Errorf("%s: Parse(%q) errors = %v, want them at %v", test.name, test.css, sheet.Errors, test.errors)
+		}
+	}
+}
+
+// strip removes the positions from the rules so they can be compared with the tests
+func strip(rules []*Rule) []Rule {
+	list := []Rule{}
+	for _, v := range rules {
+		r := *v
+		r.Line, r.Column = 0, 0
+		r.Declarations = nil
+		for _, d := range v.Declarations {
+			d.Line, d.Column = 0, 0
+			r.Declarations = append(r.Declarations, d)
+		}
+		r.Rules = nil
+		for _, c := range strip(v.Rules) {
+			r.Rules = append(r.Rules, &c)
+		}
+		list = append(list, r)
+	}
+	return list
+}
+
+func equalRule(a, b Rule) bool {
+	return a.AtRule == b.AtRule && a.Prelude == b.Prelude && a.Block == b.Block &&
+		slices.Equal(a.Declarations, b.Declarations) &&
+		slices.EqualFunc(a.Rules, b.Rules, func(a, b *Rule) bool { return equalRule(*a, *b) })
+}
+
+func TestStyleMaps(t *testing.T) {
+	selectors, styleMaps := Parse("a { color: red; color: blue } @media print { b { x: y } } d { & > c { e: f } }").StyleMaps()
+
+	if got := *selectors["a"]; !maps.Equal(got, map[string]string{"color": "blue"}) {
+		t.Errorf(`styles of "a" = %v`, got)
+	}
+	if _, ok := selectors["d > c"]; !ok {
+		t.Errorf("the nested rule wasn't resolved to %q", "d > c")
+	}
+	for _, list := range styleMaps {
+		for _, v := range list {
+			if (*v.Styles)["x"] == "y" && !slices.Equal(v.Media, []string{"print"}) {
+				t.Errorf("Media of the rule in @media print = %v", v.Media)
+			}
+		}
+	}
+}
+
+func TestImports(t *testing.T) {
+	imports := Parse(`@import "a.css"; @import url(b.css) screen; @import url("c.css") (min-width: 10px); a { x: y }`).Imports()
+	want := []Import{{URL: "a.css"}, {URL: "b.css", Media: "screen"}, {URL: "c.css", Media: "(min-width: 10px)"}}
+	if len(imports) != len(want) {
+		t.Fatalf("Imports() = %+v, want %+v", imports, want)
+	}
+	for i, v := range imports {
+		if v.URL != want[i].URL || v.Media != want[i].Media {
+			t.Errorf("import %d = %+v, want %+v", i, v, want[i])
+		}
+	}
+}
+
+func TestImportant(t *testing.T) {
+	tests := []struct {
+		value     string
+		want      string
+		important bool
+	}{
+		{"red", "red", false},
+		{"red !important", "red", true},
+		{"red ! IMPORTANT ", "red", true},
+		{"red !imp", "red !imp", false},
+	}
+	for _, test := range tests {
+		if got, important := Important(test.value); got != test.want || important != test.important {
+			t.Errorf("Important(%q) = %q, %v, want %q, %v", test.value, got, important, test.want, test.important)
+		}
+	}
+}
@@ -1,94 +1,593 @@
 package selector
 
 import (
+	"fmt"
+	"slices"
+	"strconv"
 	"strings"
+)
+
+// List is a comma separated selector list, it matches if any of the selectors match
+type List []Selector
+
+// Selector is a complex selector. Compounds are matched from the last one (the subject) back to the first,
+// + Combinators[i] sits between Compounds[i] and Compounds[i+1]
+type Selector struct {
+	// Text is the selector as it was written
+	Text        string
+	Compounds   []Compound
+	Combinators []Combinator
+	// PseudoElement is the ::name at the end of the selector (ex: "::before"), it is not matched against nodes
+	PseudoElement string
+}
 
-	"golang.org/x/net/html"
+type Combinator byte
+
+const (
+	Descendant        Combinator = ' '
+	Child             Combinator = '>'
+	NextSibling       Combinator = '+'
+	SubsequentSibling Combinator = '~'
 )
 
-// !TODO: Create :not and other selectors
+// Compound is a sequence of simple selectors that all have to match the same node
+type Compound struct {
+	// Tag is empty or "*" when any tag matches
+	Tag        string
+	Id         string
+	Classes    []string
+	Attributes []Attribute
+	Pseudo     []Pseudo
+}
+
+// Attribute is a [name], [name=value] or [name op value i] selector, Operator is empty when only the presence of
+// + the attribute is tested
+type Attribute struct {
+	Name     string
+	Operator string
+	Value    string
+	// CaseInsensitive is set by the i flag
+	CaseInsensitive bool
+}
+
+// Pseudo is a pseudo-class, Argument holds the text between the brackets of functional ones (ex: :not(.a))
+type Pseudo struct {
+	Name     string
+	Argument string
+	// Selectors is the parsed argument of :not, :is, :where and :has, and the "of S" part of :nth-child
+	// + and :nth-last-child. The selectors of :has start with a :scope compound for the node being tested
+	Selectors List
+	// A and B are the An+B of the :nth- pseudo-classes
+	A int
+	B int
+}
+
+// Parse parses a selector list, an invalid selector in the list makes the whole list invalid like in CSS
+func Parse(s string) (List, error) {
+	list := List{}
+	for _, v := range SplitList(s) {
+		sel, err := parseSelector(v)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, sel)
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("selector: empty selector %q", s)
+	}
+	return list, nil
+}
+
+// SplitList splits on the commas that aren't inside brackets or quotes
+func SplitList(s string) []string {
+	parts := []string{}
+	depth := 0
+	var quote rune
+	start := 0
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '(' || r == '[':
+			depth++
+		case r == ')' || r == ']':
+			depth--
+		case r == ',' && depth == 0:
+			parts = append(parts, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	parts = append(parts, strings.TrimSpace(s[start:]))
+	return parts
+}
+
+func parseSelector(s string) (Selector, error) {
+	sel := Selector{Text: s}
+	current := Compound{}
+	empty := true
+	var pending Combinator
 
-func GetInitCSSSelectors(node *html.Node, selectors []string) []string {
-	if node.Type == html.ElementNode {
-		selectors = append(selectors, node.Data)
-		for _, attr := range node.Attr {
-			if attr.Key == "class" {
-				classes := strings.Split(attr.Val, " ")
-				for _, class := range classes {
-					selectors = append(selectors, "."+class)
+	// push ends the current compound, combinators and whitespace come in between
+	push := func() error {
+		if empty {
+			return nil
+		}
+		if len(sel.Compounds) > 0 {
+			if pending == 0 {
+				pending = Descendant
+			}
+			sel.Combinators = append(sel.Combinators, pending)
+		} else if pending != 0 && pending != Descendant {
+			return fmt.Errorf("selector: %q starts with a combinator", s)
+		}
+		sel.Compounds = append(sel.Compounds, current)
+		current = Compound{}
+		empty = true
+		pending = 0
+		return nil
+	}
+
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			if err := push(); err != nil {
+				return sel, err
+			}
+			i++
+		case c == '>' || c == '+' || c == '~':
+			if err := push(); err != nil {
+				return sel, err
+			}
+			if pending != 0 && pending != Descendant || len(sel.Compounds) == 0 {
+				return sel, fmt.Errorf("selector: unexpected %q in %q", c, s)
+			}
+			pending = Combinator(c)
+			i++
+		case sel.PseudoElement != "":
+			return sel, fmt.Errorf("selector: %q has something after the pseudo-element", s)
+		case c == '*':
+			current.Tag = "*"
+			empty = false
+			i++
+		case c == '.' || c == '#':
+			name, next := ident(s, i+1)
+			if name == "" {
+				return sel, fmt.Errorf("selector: expected a name after %q in %q", c, s)
+			}
+			if c == '.' {
+				current.Classes = append(current.Classes, name)
+			} else {
+				current.Id = name
+			}
+			empty = false
+			i = next
+		case c == '[':
+			end := closing(s, i, '[', ']')
+			if end == -1 {
+				return sel, fmt.Errorf("selector: unclosed [ in %q", s)
+			}
+			attr, err := parseAttribute(s[i+1 : end])
+			if err != nil {
+				return sel, err
+			}
+			current.Attributes = append(current.Attributes, attr)
+			empty = false
+			i = end + 1
+		case c == ':' && strings.HasPrefix(s[i:], "::"):
+			// Everything after :: is kept together (ex: ::-webkit-scrollbar-thumb:hover)
+			end := len(s)
+			for j := i; j < len(s); j++ {
+				if strings.ContainsRune(" \t\n\r\f>+~", rune(s[j])) {
+					end = j
+					break
 				}
-			} else if attr.Key == "id" {
-				selectors = append(selectors, "#"+attr.Val)
+			}
+			sel.PseudoElement = s[i:end]
+			empty = false
+			i = end
+		case c == ':':
+			name, next := ident(s, i+1)
+			if name == "" {
+				return sel, fmt.Errorf("selector: expected a name after : in %q", s)
+			}
+			p := Pseudo{Name: strings.ToLower(name)}
+			if next < len(s) && s[next] == '(' {
+				end := closing(s, next, '(', ')')
+				if end == -1 {
+					return sel, fmt.Errorf("selector: unclosed ( in %q", s)
+				}
+				p.Argument = strings.TrimSpace(s[next+1 : end])
+				next = end + 1
+			}
+			if err := parsePseudo(&p); err != nil {
+				return sel, err
+			}
+			current.Pseudo = append(current.Pseudo, p)
+			empty = false
+			i = next
+		default:
+			name, next := ident(s, i)
+			if name == "" || !empty {
+				return sel, fmt.Errorf("selector: unexpected %q in %q", c, s)
+			}
+			current.Tag = strings.ToLower(name)
+			empty = false
+			i = next
+		}
+	}
+	if pending != 0 && pending != Descendant && empty {
+		return sel, fmt.Errorf("selector: %q ends with a combinator", s)
+	}
+	if err := push(); err != nil {
+		return sel, err
+	}
+	if len(sel.Compounds) == 0 {
+		return sel, fmt.Errorf("selector: empty selector %q", s)
+	}
+	return sel, nil
+}
+
+// parseAttribute parses what is between the brackets of a attribute selector
+func parseAttribute(s string) (Attribute, error) {
+	attr := Attribute{}
+	s = strings.TrimSpace(s)
+	name, i := ident(s, 0)
+	if name == "" {
+		return attr, fmt.Errorf("selector: expected a attribute name in [%s]", s)
+	}
+	attr.Name = strings.ToLower(name)
+	rest := strings.TrimSpace(s[i:])
+	if rest == "" {
+		return attr, nil
+	}
+
+	for _, op := range []string{"=", "~=", "|=", "^=", "$=", "*="} {
+		if strings.HasPrefix(rest, op) {
+			attr.Operator = op
+			rest = strings.TrimSpace(rest[len(op):])
+			break
+		}
+	}
+	if attr.Operator == "" {
+		return attr, fmt.Errorf("selector: unknown operator in [%s]", s)
+	}
+
+	if rest != "" && (rest[0] == '"' || rest[0] == '\'') {
+		quote := rest[0]
+		var b strings.Builder
+		j := 1
+		for ; j < len(rest) && rest[j] != quote; j++ {
+			if rest[j] == '\\' && j+1 < len(rest) {
+				j++
+			}
+			b.WriteByte(rest[j])
+		}
+		if j == len(rest) {
+			return attr, fmt.Errorf("selector: unclosed string in [%s]", s)
+		}
+		attr.Value = b.String()
+		rest = strings.TrimSpace(rest[j+1:])
+	} else {
+		value, j := ident(rest, 0)
+		if value == "" {
+			return attr, fmt.Errorf("selector: expected a value in [%s]", s)
+		}
+		attr.Value = value
+		rest = strings.TrimSpace(rest[j:])
+	}
+
+	switch strings.ToLower(rest) {
+	case "":
+	case "i":
+		attr.CaseInsensitive = true
+	case "s":
+		attr.CaseInsensitive = false
+	default:
+		return attr, fmt.Errorf("selector: unexpected %q in [%s]", rest, s)
+	}
+	return attr, nil
+}
+
+// parsePseudo parses the argument of the functional pseudo-classes
+func parsePseudo(p *Pseudo) error {
+	var err error
+	switch p.Name {
+	case "not":
+		p.Selectors, err = Parse(p.Argument)
+	case "is", "where", "matches":
+		// :is and :where are forgiving, the selectors that can't be parsed are dropped instead of the whole list
+		for _, v := range SplitList(p.Argument) {
+			if sel, err := parseSelector(v); err == nil {
+				p.Selectors = append(p.Selectors, sel)
+			}
+		}
+	case "has":
+		p.Selectors, err = parseRelative(p.Argument)
+	case "nth-child", "nth-last-child", "nth-of-type", "nth-last-of-type":
+		nth, of, _ := strings.Cut(p.Argument, " of ")
+		p.A, p.B, err = parseNth(nth)
+		if err == nil && strings.TrimSpace(of) != "" {
+			if strings.HasSuffix(p.Name, "of-type") {
+				err = fmt.Errorf("of S can only be used with :nth-child and :nth-last-child")
 			} else {
-				selectors = append(selectors, "["+attr.Key+"=\""+attr.Val+"\"]")
+				p.Selectors, err = Parse(of)
 			}
 		}
+	case "first-child", "last-child", "first-of-type", "last-of-type":
+		p.B = 1
+	}
+	if err != nil {
+		return fmt.Errorf("selector: invalid :%s(%s): %w", p.Name, p.Argument, err)
 	}
+	return nil
+}
 
-	return selectors
+// parseRelative parses the argument of :has, each selector can start with a combinator (ex: "> img", "+ p") and
+// + is anchored to the node :has is tested on with a :scope compound
+func parseRelative(s string) (List, error) {
+	list := List{}
+	for _, v := range SplitList(s) {
+		combinator := Descendant
+		if v != "" && strings.ContainsRune(">+~", rune(v[0])) {
+			combinator = Combinator(v[0])
+			v = strings.TrimSpace(v[1:])
+		}
+		sel, err := parseSelector(v)
+		if err != nil {
+			return nil, err
+		}
+		sel.Compounds = append([]Compound{{Pseudo: []Pseudo{{Name: "scope"}}}}, sel.Compounds...)
+		sel.Combinators = append([]Combinator{combinator}, sel.Combinators...)
+		list = append(list, sel)
+	}
+	return list, nil
 }
 
-func SplitSelector(s string) []string {
-	var result []string
-	var current strings.Builder
+// parseNth parses the An+B microsyntax, odd and even included
+func parseNth(s string) (int, int, error) {
+	s = strings.ToLower(strings.Join(strings.Fields(s), ""))
+	switch s {
+	case "odd":
+		return 2, 1, nil
+	case "even":
+		return 2, 0, nil
+	case "":
+		return 0, 0, fmt.Errorf("empty An+B")
+	}
 
-	// Check if there's a `::` and split the string
-	var prePseudo string
-	var pseudo string
+	i := strings.IndexByte(s, 'n')
+	if i == -1 {
+		b, err := strconv.Atoi(s)
+		return 0, b, err
+	}
 
-	if idx := strings.Index(s, "::"); idx != -1 {
-		prePseudo = s[:idx]
-		pseudo = s[idx:] // Keep everything after `::` together
-	} else {
-		prePseudo = s
+	a := 1
+	switch s[:i] {
+	case "", "+":
+	case "-":
+		a = -1
+	default:
+		var err error
+		a, err = strconv.Atoi(s[:i])
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	b := 0
+	if rest := s[i+1:]; rest != "" {
+		if rest[0] != '+' && rest[0] != '-' {
+			return 0, 0, fmt.Errorf("unexpected %q", rest)
+		}
+		var err error
+		b, err = strconv.Atoi(rest)
+		if err != nil {
+			return 0, 0, err
+		}
 	}
+	return a, b, nil
+}
 
-	// Process the part before the pseudo-element selector
-	for _, char := range prePseudo {
-		switch char {
-		case '.', '#', '[', ']', ':':
-			if current.Len() > 0 {
-				if char == ']' {
-					current.WriteRune(char)
-				}
-				result = append(result, current.String())
-				current.Reset()
+// Nth reports if the 1 based index is matched by An+B, 0 is used for nodes that aren't counted (the "of S" of
+// + :nth-child doesn't match them) and never matches
+func (p Pseudo) Nth(index int) bool {
+	if index < 1 {
+		return false
+	}
+	if p.A == 0 {
+		return index == p.B
+	}
+	n := (index - p.B) / p.A
+	return n >= 0 && (index-p.B)%p.A == 0
+}
+
+// Match tests the value of the attribute on a node, has is false when the node doesn't have the attribute
+func (a Attribute) Match(value string, has bool) bool {
+	if !has {
+		return false
+	}
+	want := a.Value
+	if a.CaseInsensitive {
+		value = strings.ToLower(value)
+		want = strings.ToLower(want)
+	}
+	switch a.Operator {
+	case "":
+		return true
+	case "=":
+		return value == want
+	case "~=":
+		// One of the space separated words
+		return want != "" && !strings.ContainsAny(want, " \t\n") && slices.Contains(strings.Fields(value), want)
+	case "|=":
+		return value == want || strings.HasPrefix(value, want+"-")
+	case "^=":
+		return want != "" && strings.HasPrefix(value, want)
+	case "$=":
+		return want != "" && strings.HasSuffix(value, want)
+	case "*=":
+		return want != "" && strings.Contains(value, want)
+	}
+	return false
+}
+
+// ident reads a name (tag, class, id, pseudo-class) starting at i, backslash escapes are kept as the escaped character
+func ident(s string, i int) (string, int) {
+	var b strings.Builder
+	for i < len(s) {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) {
+			b.WriteByte(s[i+1])
+			i += 2
+			continue
+		}
+		if c == '-' || c == '_' || c >= 0x80 || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+			b.WriteByte(c)
+			i++
+			continue
+		}
+		break
+	}
+	return b.String(), i
+}
+
+// closing finds the bracket that closes the one at i, skipping quoted strings and nested brackets
+func closing(s string, i int, open, close byte) int {
+	depth := 0
+	var quote byte
+	for j := i; j < len(s); j++ {
+		c := s[j]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				j++
+			} else if c == quote {
+				quote = 0
 			}
-			if char != ']' {
-				current.WriteRune(char)
+		case c == '"' || c == '\'':
+			quote = c
+		case c == open:
+			depth++
+		case c == close:
+			depth--
+			if depth == 0 {
+				return j
 			}
-		default:
-			current.WriteRune(char)
 		}
 	}
+	return -1
+}
 
-	if current.Len() > 0 {
-		result = append(result, current.String())
+// Subject is the compound the selector is matched against first
+func (s Selector) Subject() Compound {
+	return s.Compounds[len(s.Compounds)-1]
+}
+
+// Key is the most selective part of the subject, stylesheets are indexed by it so only rules that can match a node
+// + are tested. "*" is used when the subject has no tag, id or class
+func (s Selector) Key() string {
+	subject := s.Subject()
+	if subject.Id != "" {
+		return "#" + subject.Id
+	}
+	if len(subject.Classes) > 0 {
+		return "." + subject.Classes[0]
 	}
+	if subject.Tag != "" && subject.Tag != "*" {
+		return subject.Tag
+	}
+	return "*"
+}
 
-	// Add the pseudo-element (if any) as a single item
-	if pseudo != "" {
-		result = append(result, pseudo)
+// Specificity is the (ids, classes, tags) weight of a selector, attributes and pseudo-classes count as classes and
+// + pseudo-elements as tags
+type Specificity [3]int
+
+// Compare returns -1, 0 or 1 when s is less, equally or more specific than o
+func (s Specificity) Compare(o Specificity) int {
+	for i := range s {
+		if s[i] != o[i] {
+			if s[i] < o[i] {
+				return -1
+			}
+			return 1
+		}
 	}
+	return 0
+}
 
-	return result
+func (s Specificity) add(o Specificity) Specificity {
+	return Specificity{s[0] + o[0], s[1] + o[1], s[2] + o[2]}
 }
 
-func Contains(selector []string, node []string) bool {
-	selectorSet := make(map[string]struct{}, len(node))
-	for _, s := range node {
-		selectorSet[s] = struct{}{}
+// Specificity follows Selectors Level 4: :is, :not and :has take the most specific selector of their argument,
+// + :where counts for nothing and :nth-child(An+B of S) is a class plus the most specific selector of S
+func (s Selector) Specificity() Specificity {
+	spec := Specificity{}
+	for _, c := range s.Compounds {
+		if c.Id != "" {
+			spec[0]++
+		}
+		spec[1] += len(c.Classes) + len(c.Attributes)
+		if c.Tag != "" && c.Tag != "*" {
+			spec[2]++
+		}
+		for _, p := range c.Pseudo {
+			switch p.Name {
+			case "where", "scope":
+			case "is", "matches", "not", "has":
+				spec = spec.add(p.Selectors.maxSpecificity())
+			case "nth-child", "nth-last-child":
+				spec[1]++
+				spec = spec.add(p.Selectors.maxSpecificity())
+			default:
+				spec[1]++
+			}
+		}
+	}
+	if s.PseudoElement != "" {
+		spec[2]++
 	}
+	return spec
+}
 
-	for _, s := range selector {
-		if _, exists := selectorSet[s]; !exists {
-			return false
+func (l List) maxSpecificity() Specificity {
+	spec := Specificity{}
+	for _, v := range l {
+		if vs := v.Specificity(); vs.Compare(spec) > 0 {
+			spec = vs
 		}
 	}
-	return true
+	return spec
 }
 
-// precompile selectors so you don't have to split selector on every style sheet and every selector everytime, put in a map
-// if the selector is the same as another merge them.
-// if the selector has a parent or child selector then make a css prop "Selector": "full selector". should be blank if not
-// can run the actual test in that case, just see if a part of the selector matches, can be cleaned up later
+// Structural is true when matching depends on other nodes in the tree than the node and its ancestors (siblings
+// + with + and ~, children with :has or :empty, the position with :nth-child). Adding or restyling a node can then
+// + change the styles of its siblings and ancestors
+func (s Selector) Structural() bool {
+	for _, v := range s.Combinators {
+		if v == NextSibling || v == SubsequentSibling {
+			return true
+		}
+	}
+	for _, c := range s.Compounds {
+		for _, p := range c.Pseudo {
+			switch p.Name {
+			case "has", "empty", "focus-within", "first-child", "last-child", "only-child", "first-of-type",
+				"last-of-type", "only-of-type", "nth-child", "nth-last-child", "nth-of-type", "nth-last-of-type":
+				return true
+			}
+			for _, v := range p.Selectors {
+				if v.Structural() {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
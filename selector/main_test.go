@@ -0,0 +1,165 @@
+package selector
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		selector    string
+		compounds   int
+		combinators []Combinator
+		key         string
+	}{
+		{"div", 1, nil, "div"},
+		{"ul li > a", 3, []Combinator{Descendant, Child}, "a"},
+		{"h1 + p ~ .note", 3, []Combinator{NextSibling, SubsequentSibling}, ".note"},
+		{"a>b", 2, []Combinator{Child}, "b"},
+		{"#main.card[data-x] :hover", 2, []Combinator{Descendant}, "*"},
+		{"p#intro.lead", 1, nil, "#intro"},
+	}
+	for _, test := range tests {
+		list, err := Parse(test.selector)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", test.selector, err)
+			continue
+		}
+		s := list[0]
+		if len(s.Compounds) != test.compounds || !slices.Equal(s.Combinators, test.combinators) {
+			t.Errorf("Parse(%q) = %d compounds %q, want %d %q", test.selector, len(s.Compounds), s.Combinators, test.compounds, test.combinators)
+		}
+		if key := s.Key(); key != test.key {
+			t.Errorf("Parse(%q).Key() = %q, want %q", test.selector, key, test.key)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, v := range []string{"", "a,", "> a", "a >", "[x", ":not(", "a, b[=x]", ":nth-child(foo)"} {
+		if _, err := Parse(v); err == nil {
+			t.Errorf("Parse(%q) didn't return an error", v)
+		}
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	got := SplitList(`a, :is(b, c), [title="d,e"]`)
+	want := []string{"a", ":is(b, c)", `[title="d,e"]`}
+	if !slices.Equal(got, want) {
+		t.Errorf("SplitList = %q, want %q", got, want)
+	}
+}
+
+func TestSpecificity(t *testing.T) {
+	tests := []struct {
+		selector string
+		want     Specificity
+	}{
+		{"*", Specificity{0, 0, 0}},
+		{"li", Specificity{0, 0, 1}},
+		{"ul li", Specificity{0, 0, 2}},
+		{"ul ol+li", Specificity{0, 0, 3}},
+		{".a.b", Specificity{0, 2, 0}},
+		{"a[href]:hover", Specificity{0, 2, 1}},
+		{"#x .y z", Specificity{1, 1, 1}},
+		{"p::before", Specificity{0, 0, 2}},
+		{":is(#a, .b) c", Specificity{1, 0, 1}},
+		{":where(#a, .b) c", Specificity{0, 0, 1}},
+		{":not(.a, #b)", Specificity{1, 0, 0}},
+		{"div:has(> .x)", Specificity{0, 1, 1}},
+		{":nth-child(2n+1 of .a)", Specificity{0, 2, 0}},
+	}
+	for _, test := range tests {
+		list, err := Parse(test.selector)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", test.selector, err)
+			continue
+		}
+		if got := list[0].Specificity(); got != test.want {
+			t.Errorf("Specificity(%q) = %v, want %v", test.selector, got, test.want)
+		}
+	}
+}
+
+func TestSpecificityCompare(t *testing.T) {
+	tests := []struct {
+		a, b Specificity
+		want int
+	}{
+		{Specificity{1, 0, 0}, Specificity{0, 10, 10}, 1},
+		{Specificity{0, 1, 0}, Specificity{0, 0, 10}, 1},
+		{Specificity{0, 1, 1}, Specificity{0, 1, 2}, -1},
+		{Specificity{0, 1, 1}, Specificity{0, 1, 1}, 0},
+	}
+	for _, test := range tests {
+		if got := test.a.Compare(test.b); got != test.want {
+			t.Errorf("%v.Compare(%v) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestNth(t *testing.T) {
+	tests := []struct {
+		argument string
+		matches  []int
+	}{
+		{"odd", []int{1, 3, 5, 7}},
+		{"even", []int{2, 4, 6, 8}},
+		{"3", []int{3}},
+		{"3n", []int{3, 6}},
+		{"2n+3", []int{3, 5, 7}},
+		{"-n+3", []int{1, 2, 3}},
+	}
+	for _, test := range tests {
+		list, err := Parse(":nth-child(" + test.argument + ")")
+		if err != nil {
+			t.Errorf("Parse(:nth-child(%s)): %v", test.argument, err)
+			continue
+		}
+		p := list[0].Subject().Pseudo[0]
+		matches := []int{}
+		for i := 1; i <= 8; i++ {
+			if p.Nth(i) {
+				matches = append(matches, i)
+			}
+		}
+		if !slices.Equal(matches, test.matches) {
+			t.Errorf(":nth-child(%s) matches %v, want %v", test.argument, matches, test.matches)
+		}
+	}
+}
+
+func TestAttributeMatch(t *testing.T) {
+	tests := []struct {
+		selector string
+		value    string
+		has      bool
+		want     bool
+	}{
+		{"[x]", "", true, true},
+		{"[x]", "", false, false},
+		{"[x=a]", "a", true, true},
+		{"[x=a]", "A", true, false},
+		{"[x=a i]", "A", true, true},
+		{"[x~=b]", "a b c", true, true},
+		{"[x~=b]", "abc", true, false},
+		{"[x|=en]", "en-US", true, true},
+		{"[x|=en]", "eng", true, false},
+		{"[x^=ht]", "http", true, true},
+		{`[x$=".png"]`, "a.png", true, true},
+		{"[x*=ell]", "hello", true, true},
+		{`[x^=""]`, "a", true, false},
+	}
+	for _, test := range tests {
+		list, err := Parse(test.selector)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", test.selector, err)
+			continue
+		}
+		a := list[0].Subject().Attributes[0]
+		if got := a.Match(test.value, test.has); got != test.want {
+			t.Errorf("%s.Match(%q, %v) = %v, want %v", test.selector, test.value, test.has, got, test.want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"gui"
 	"gui/adapters/raylib"
 	// "github.com/pkg/profile"
@@ -14,7 +15,11 @@ func main() {
 	// defer profile.Start(profile.MemProfile, profile.ProfilePath(".")).Stop() // Memory
 	// defaults read ~/Library/Preferences/.GlobalPreferences.plist
 	// !ISSUE: Flex2 doesn't work anymore
-	window := gui.Open("./src/index.html", raylib.Init())
+	window, err := gui.Open("./src/index.html", raylib.Init())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
 
 	// document := window.Document
 
@@ -0,0 +1,173 @@
+package timers
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is where timers read the time from, swap it for a ManualClock to step time in tests
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// ManualClock only moves when Advance is called
+type ManualClock struct {
+	Time time.Time
+}
+
+func (c *ManualClock) Now() time.Time {
+	return c.Time
+}
+
+func (c *ManualClock) Advance(d time.Duration) {
+	c.Time = c.Time.Add(d)
+}
+
+// Timers holds the callbacks scheduled with SetTimeout, SetInterval and RequestAnimationFrame. They are only called
+// + from Run, which the main loop calls once per frame before styling
+type Timers struct {
+	// Clock has to be set before anything is scheduled, nil uses the system clock
+	Clock   Clock
+	mu      sync.Mutex
+	started bool
+	start   time.Time
+	nextId  int
+	timers  map[int]*timer
+	frames  map[int]func(time.Duration)
+}
+
+type timer struct {
+	id       int
+	due      time.Time
+	interval time.Duration
+	callback func()
+}
+
+// SetTimeout calls callback once after delay, the returned id can be passed to Clear
+func (t *Timers) SetTimeout(callback func(), delay time.Duration) int {
+	return t.add(callback, delay, 0)
+}
+
+// SetInterval calls callback every interval until it is cleared
+func (t *Timers) SetInterval(callback func(), interval time.Duration) int {
+	if interval <= 0 {
+		interval = time.Millisecond
+	}
+	return t.add(callback, interval, interval)
+}
+
+// RequestAnimationFrame calls callback once on the next frame with the time since the timers started
+func (t *Timers) RequestAnimationFrame(callback func(time.Duration)) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.init()
+	t.nextId++
+	t.frames[t.nextId] = callback
+	return t.nextId
+}
+
+// Clear cancels a timeout, interval or animation frame
+func (t *Timers) Clear(id int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.timers, id)
+	delete(t.frames, id)
+}
+
+// Run calls every timer that is due and the animation frames requested before this frame. Callbacks scheduled
+// + while running are left for the next frame
+func (t *Timers) Run() {
+	t.mu.Lock()
+	t.init()
+	now := t.Clock.Now()
+
+	due := []*timer{}
+	for _, v := range t.timers {
+		if !v.due.After(now) {
+			due = append(due, v)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if due[i].due.Equal(due[j].due) {
+			return due[i].id < due[j].id
+		}
+		return due[i].due.Before(due[j].due)
+	})
+
+	frameIds := make([]int, 0, len(t.frames))
+	for id := range t.frames {
+		frameIds = append(frameIds, id)
+	}
+	sort.Ints(frameIds)
+	elapsed := now.Sub(t.start)
+	t.mu.Unlock()
+
+	for _, v := range due {
+		t.mu.Lock()
+		// A callback before this one might have cleared it
+		_, active := t.timers[v.id]
+		if active {
+			if v.interval > 0 {
+				v.due = v.due.Add(v.interval)
+				if !v.due.After(now) {
+					// Don't try to catch up on missed intervals
+					v.due = now.Add(v.interval)
+				}
+			} else {
+				delete(t.timers, v.id)
+			}
+		}
+		t.mu.Unlock()
+
+		if active {
+			v.callback()
+		}
+	}
+
+	for _, id := range frameIds {
+		t.mu.Lock()
+		// Frames can be cancelled by the callbacks before them too
+		frame, active := t.frames[id]
+		delete(t.frames, id)
+		t.mu.Unlock()
+
+		if active {
+			frame(elapsed)
+		}
+	}
+}
+
+func (t *Timers) add(callback func(), delay, interval time.Duration) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.init()
+	t.nextId++
+	t.timers[t.nextId] = &timer{
+		id:       t.nextId,
+		due:      t.Clock.Now().Add(delay),
+		interval: interval,
+		callback: callback,
+	}
+	return t.nextId
+}
+
+func (t *Timers) init() {
+	if t.Clock == nil {
+		t.Clock = systemClock{}
+	}
+	if !t.started {
+		t.started = true
+		t.start = t.Clock.Now()
+	}
+	if t.timers == nil {
+		t.timers = map[int]*timer{}
+		t.frames = map[int]func(time.Duration){}
+	}
+}
@@ -0,0 +1,143 @@
+package timers
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTimers(t *testing.T) {
+	clock := &ManualClock{Time: time.Unix(0, 0)}
+	timers := &Timers{Clock: clock}
+	calls := []string{}
+	record := func(name string) func() {
+		return func() {
+			calls = append(calls, name)
+		}
+	}
+
+	timers.SetTimeout(record("timeout 30"), 30*time.Millisecond)
+	timers.SetTimeout(record("timeout 10"), 10*time.Millisecond)
+	interval := timers.SetInterval(record("interval"), 20*time.Millisecond)
+	cleared := timers.SetTimeout(record("cleared"), 5*time.Millisecond)
+	timers.Clear(cleared)
+
+	steps := []struct {
+		advance time.Duration
+		want    []string
+	}{
+		{0, nil},
+		{10 * time.Millisecond, []string{"timeout 10"}},
+		{10 * time.Millisecond, []string{"interval"}},
+		{10 * time.Millisecond, []string{"timeout 30"}},
+		{10 * time.Millisecond, []string{"interval"}},
+		// A late frame calls an interval once instead of catching up
+		{100 * time.Millisecond, []string{"interval"}},
+		{10 * time.Millisecond, nil},
+		{10 * time.Millisecond, []string{"interval"}},
+	}
+	for i, step := range steps {
+		calls = nil
+		clock.Advance(step.advance)
+		timers.Run()
+		if !slices.Equal(calls, step.want) {
+			t.Errorf("step %d: called %q, want %q", i, calls, step.want)
+		}
+	}
+
+	timers.Clear(interval)
+	calls = nil
+	clock.Advance(time.Second)
+	timers.Run()
+	if len(calls) != 0 {
+		t.Errorf("called %q after every timer was cleared or done", calls)
+	}
+}
+
+func TestSameDueTime(t *testing.T) {
+	clock := &ManualClock{}
+	timers := &Timers{Clock: clock}
+	calls := []int{}
+	for i := range 5 {
+		timers.SetTimeout(func() {
+			calls = append(calls, i)
+		}, 10*time.Millisecond)
+	}
+	clock.Advance(10 * time.Millisecond)
+	timers.Run()
+	if !slices.Equal(calls, []int{0, 1, 2, 3, 4}) {
+		t.Errorf("timers with the same due time ran in the order %v", calls)
+	}
+}
+
+func TestClearFromCallback(t *testing.T) {
+	clock := &ManualClock{}
+	timers := &Timers{Clock: clock}
+	var second int
+	ran := false
+	timers.SetTimeout(func() {
+		timers.Clear(second)
+	}, 10*time.Millisecond)
+	second = timers.SetTimeout(func() {
+		ran = true
+	}, 10*time.Millisecond)
+
+	clock.Advance(10 * time.Millisecond)
+	timers.Run()
+	if ran {
+		t.Error("a timer cleared by a callback in the same frame still ran")
+	}
+}
+
+func TestRequestAnimationFrame(t *testing.T) {
+	clock := &ManualClock{Time: time.Unix(100, 0)}
+	timers := &Timers{Clock: clock}
+	frames := []time.Duration{}
+	var frame func(time.Duration)
+	frame = func(elapsed time.Duration) {
+		frames = append(frames, elapsed)
+		// Frames requested from a frame run on the next one
+		timers.RequestAnimationFrame(frame)
+	}
+	timers.RequestAnimationFrame(frame)
+	cleared := timers.RequestAnimationFrame(func(time.Duration) {
+		t.Error("a cleared animation frame ran")
+	})
+	timers.Clear(cleared)
+
+	for range 3 {
+		clock.Advance(16 * time.Millisecond)
+		timers.Run()
+	}
+	want := []time.Duration{16 * time.Millisecond, 32 * time.Millisecond, 48 * time.Millisecond}
+	if !slices.Equal(frames, want) {
+		t.Errorf("frames got %v, want %v", frames, want)
+	}
+}
+
+func TestClearFrameFromCallback(t *testing.T) {
+	clock := &ManualClock{}
+	timers := &Timers{Clock: clock}
+	var second, third int
+	ran := []string{}
+	timers.SetTimeout(func() {
+		ran = append(ran, "timeout")
+		timers.Clear(third)
+	}, 0)
+	timers.RequestAnimationFrame(func(time.Duration) {
+		ran = append(ran, "first")
+		timers.Clear(second)
+	})
+	second = timers.RequestAnimationFrame(func(time.Duration) {
+		ran = append(ran, "second")
+	})
+	third = timers.RequestAnimationFrame(func(time.Duration) {
+		ran = append(ran, "third")
+	})
+
+	timers.Run()
+	timers.Run()
+	if want := []string{"timeout", "first"}; !slices.Equal(ran, want) {
+		t.Errorf("ran %v, want %v without the frames cleared in the same frame", ran, want)
+	}
+}
@@ -0,0 +1,440 @@
+package tokenizer
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Type is the kind of a token, they follow CSS Syntax Module Level 3
+type Type int
+
+const (
+	EOF Type = iota
+	Ident
+	Function
+	AtKeyword
+	Hash
+	String
+	BadString
+	URL
+	BadURL
+	Delim
+	Number
+	Percentage
+	Dimension
+	Whitespace
+	CDO
+	CDC
+	Colon
+	Semicolon
+	Comma
+	OpenSquare
+	CloseSquare
+	OpenParen
+	CloseParen
+	OpenCurly
+	CloseCurly
+)
+
+var typeNames = []string{"EOF", "ident", "function", "at-keyword", "hash", "string", "bad string", "url", "bad url",
+	"delim", "number", "percentage", "dimension", "whitespace", "<!--", "-->", ":", ";", ",", "[", "]", "(", ")", "{", "}"}
+
+func (t Type) String() string {
+	if int(t) < len(typeNames) {
+		return typeNames[t]
+	}
+	return "token(" + strconv.Itoa(int(t)) + ")"
+}
+
+type Token struct {
+	Type Type
+	// Value is the unescaped name of idents, functions, at-keywords and hashes, the contents of strings and urls,
+	// + the character of a delim and the unit of a dimension
+	Value string
+	// Number is the value of numbers, percentages and dimensions
+	Number float64
+	// Raw is the source of the token as it was written, comments around it are not included
+	Raw string
+	// Line and Column are where the token starts, both start at 1
+	Line   int
+	Column int
+}
+
+type tokenizer struct {
+	src  []rune
+	pos  int
+	line int
+	col  int
+}
+
+// Tokenize splits css into tokens, the last token is always EOF. Comments are removed and invalid input becomes
+// + BadString, BadURL or Delim tokens instead of an error so the parser can recover from it
+func Tokenize(css string) []Token {
+	css = strings.ReplaceAll(css, "\r\n", "\n")
+	css = strings.NewReplacer("\r", "\n", "\f", "\n", "\x00", "\uFFFD").Replace(css)
+	t := tokenizer{src: []rune(css), line: 1, col: 1}
+
+	tokens := []Token{}
+	for {
+		tok := t.next()
+		tokens = append(tokens, tok)
+		if tok.Type == EOF {
+			return tokens
+		}
+	}
+}
+
+func (t *tokenizer) peek(i int) rune {
+	if t.pos+i < len(t.src) {
+		return t.src[t.pos+i]
+	}
+	return -1
+}
+
+func (t *tokenizer) advance(count int) {
+	for ; count > 0 && t.pos < len(t.src); count-- {
+		if t.src[t.pos] == '\n' {
+			t.line++
+			t.col = 1
+		} else {
+			t.col++
+		}
+		t.pos++
+	}
+}
+
+func (t *tokenizer) next() Token {
+	t.skipComments()
+	start, line, col := t.pos, t.line, t.col
+	tok := t.consume()
+	tok.Raw = string(t.src[start:t.pos])
+	tok.Line, tok.Column = line, col
+	return tok
+}
+
+func (t *tokenizer) skipComments() {
+	for t.peek(0) == '/' && t.peek(1) == '*' {
+		t.advance(2)
+		for t.pos < len(t.src) && !(t.peek(0) == '*' && t.peek(1) == '/') {
+			t.advance(1)
+		}
+		t.advance(2)
+	}
+}
+
+func (t *tokenizer) consume() Token {
+	c := t.peek(0)
+	switch {
+	case c == -1:
+		return Token{Type: EOF}
+	case isWhitespace(c):
+		for isWhitespace(t.peek(0)) {
+			t.advance(1)
+		}
+		return Token{Type: Whitespace}
+	case c == '"' || c == '\'':
+		return t.consumeString(c)
+	case c == '#':
+		if isName(t.peek(1)) || validEscape(t.peek(1), t.peek(2)) {
+			t.advance(1)
+			return Token{Type: Hash, Value: t.consumeName()}
+		}
+	case c == '(':
+		t.advance(1)
+		return Token{Type: OpenParen}
+	case c == ')':
+		t.advance(1)
+		return Token{Type: CloseParen}
+	case c == '[':
+		t.advance(1)
+		return Token{Type: OpenSquare}
+	case c == ']':
+		t.advance(1)
+		return Token{Type: CloseSquare}
+	case c == '{':
+		t.advance(1)
+		return Token{Type: OpenCurly}
+	case c == '}':
+		t.advance(1)
+		return Token{Type: CloseCurly}
+	case c == ',':
+		t.advance(1)
+		return Token{Type: Comma}
+	case c == ':':
+		t.advance(1)
+		return Token{Type: Colon}
+	case c == ';':
+		t.advance(1)
+		return Token{Type: Semicolon}
+	case c == '+' || c == '.':
+		if startsNumber(c, t.peek(1), t.peek(2)) {
+			return t.consumeNumeric()
+		}
+	case c == '-':
+		if startsNumber(c, t.peek(1), t.peek(2)) {
+			return t.consumeNumeric()
+		}
+		if t.peek(1) == '-' && t.peek(2) == '>' {
+			t.advance(3)
+			return Token{Type: CDC}
+		}
+		if startsIdent(c, t.peek(1), t.peek(2)) {
+			return t.consumeIdentLike()
+		}
+	case c == '<':
+		if t.peek(1) == '!' && t.peek(2) == '-' && t.peek(3) == '-' {
+			t.advance(4)
+			return Token{Type: CDO}
+		}
+	case c == '@':
+		if startsIdent(t.peek(1), t.peek(2), t.peek(3)) {
+			t.advance(1)
+			return Token{Type: AtKeyword, Value: t.consumeName()}
+		}
+	case c == '\\':
+		if validEscape(c, t.peek(1)) {
+			return t.consumeIdentLike()
+		}
+	case c >= '0' && c <= '9':
+		return t.consumeNumeric()
+	case isNameStart(c):
+		return t.consumeIdentLike()
+	}
+	t.advance(1)
+	return Token{Type: Delim, Value: string(c)}
+}
+
+func (t *tokenizer) consumeString(quote rune) Token {
+	t.advance(1)
+	var b strings.Builder
+	for {
+		c := t.peek(0)
+		switch {
+		case c == -1:
+			// Unclosed at the end of the file, it is still a string
+			return Token{Type: String, Value: b.String()}
+		case c == quote:
+			t.advance(1)
+			return Token{Type: String, Value: b.String()}
+		case c == '\n':
+			// The newline is left for the next token
+			return Token{Type: BadString, Value: b.String()}
+		case c == '\\':
+			if t.peek(1) == -1 {
+				t.advance(1)
+			} else if t.peek(1) == '\n' {
+				t.advance(2)
+			} else {
+				t.advance(1)
+				b.WriteRune(t.consumeEscape())
+			}
+		default:
+			b.WriteRune(c)
+			t.advance(1)
+		}
+	}
+}
+
+func (t *tokenizer) consumeNumeric() Token {
+	start := t.pos
+	if c := t.peek(0); c == '+' || c == '-' {
+		t.advance(1)
+	}
+	t.digits()
+	if t.peek(0) == '.' && isDigit(t.peek(1)) {
+		t.advance(1)
+		t.digits()
+	}
+	if c := t.peek(0); c == 'e' || c == 'E' {
+		if isDigit(t.peek(1)) {
+			t.advance(1)
+			t.digits()
+		} else if (t.peek(1) == '+' || t.peek(1) == '-') && isDigit(t.peek(2)) {
+			t.advance(2)
+			t.digits()
+		}
+	}
+	number, _ := strconv.ParseFloat(string(t.src[start:t.pos]), 64)
+
+	if startsIdent(t.peek(0), t.peek(1), t.peek(2)) {
+		return Token{Type: Dimension, Number: number, Value: t.consumeName()}
+	}
+	if t.peek(0) == '%' {
+		t.advance(1)
+		return Token{Type: Percentage, Number: number}
+	}
+	return Token{Type: Number, Number: number}
+}
+
+func (t *tokenizer) digits() {
+	for isDigit(t.peek(0)) {
+		t.advance(1)
+	}
+}
+
+func (t *tokenizer) consumeIdentLike() Token {
+	name := t.consumeName()
+	if t.peek(0) != '(' {
+		return Token{Type: Ident, Value: name}
+	}
+	t.advance(1)
+	if !strings.EqualFold(name, "url") {
+		return Token{Type: Function, Value: name}
+	}
+
+	// url("a.png") is a function with a string in it, url(a.png) is a url token
+	i := 0
+	for isWhitespace(t.peek(i)) {
+		i++
+	}
+	if c := t.peek(i); c == '"' || c == '\'' {
+		return Token{Type: Function, Value: name}
+	}
+	return t.consumeURL()
+}
+
+func (t *tokenizer) consumeURL() Token {
+	for isWhitespace(t.peek(0)) {
+		t.advance(1)
+	}
+	var b strings.Builder
+	for {
+		c := t.peek(0)
+		switch {
+		case c == ')' || c == -1:
+			t.advance(1)
+			return Token{Type: URL, Value: b.String()}
+		case isWhitespace(c):
+			for isWhitespace(t.peek(0)) {
+				t.advance(1)
+			}
+			if t.peek(0) == ')' || t.peek(0) == -1 {
+				t.advance(1)
+				return Token{Type: URL, Value: b.String()}
+			}
+			t.consumeBadURL()
+			return Token{Type: BadURL}
+		case c == '"' || c == '\'' || c == '(' || c < 0x20 || c == 0x7f:
+			t.consumeBadURL()
+			return Token{Type: BadURL}
+		case c == '\\':
+			if !validEscape(c, t.peek(1)) {
+				t.consumeBadURL()
+				return Token{Type: BadURL}
+			}
+			t.advance(1)
+			b.WriteRune(t.consumeEscape())
+		default:
+			b.WriteRune(c)
+			t.advance(1)
+		}
+	}
+}
+
+// consumeBadURL skips to the end of a broken url so the rest of the file can still be read
+func (t *tokenizer) consumeBadURL() {
+	for {
+		c := t.peek(0)
+		if c == -1 {
+			return
+		}
+		if c == ')' {
+			t.advance(1)
+			return
+		}
+		if validEscape(c, t.peek(1)) {
+			t.advance(1)
+			t.consumeEscape()
+			continue
+		}
+		t.advance(1)
+	}
+}
+
+func (t *tokenizer) consumeName() string {
+	var b strings.Builder
+	for {
+		c := t.peek(0)
+		if isName(c) {
+			b.WriteRune(c)
+			t.advance(1)
+		} else if validEscape(c, t.peek(1)) {
+			t.advance(1)
+			b.WriteRune(t.consumeEscape())
+		} else {
+			return b.String()
+		}
+	}
+}
+
+// consumeEscape reads the character after a backslash, hex escapes can be up to 6 digits and end with a space
+func (t *tokenizer) consumeEscape() rune {
+	c := t.peek(0)
+	if c == -1 {
+		return utf8.RuneError
+	}
+	if !isHex(c) {
+		t.advance(1)
+		return c
+	}
+	hex := 0
+	for i := 0; i < 6 && isHex(t.peek(0)); i++ {
+		v, _ := strconv.ParseInt(string(t.peek(0)), 16, 32)
+		hex = hex*16 + int(v)
+		t.advance(1)
+	}
+	if isWhitespace(t.peek(0)) {
+		t.advance(1)
+	}
+	if hex == 0 || hex > utf8.MaxRune || (hex >= 0xD800 && hex <= 0xDFFF) {
+		return utf8.RuneError
+	}
+	return rune(hex)
+}
+
+func isWhitespace(c rune) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+func isDigit(c rune) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHex(c rune) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isNameStart(c rune) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_' || c >= 0x80
+}
+
+func isName(c rune) bool {
+	return isNameStart(c) || isDigit(c) || c == '-'
+}
+
+func validEscape(a, b rune) bool {
+	return a == '\\' && b != '\n' && b != -1
+}
+
+func startsIdent(a, b, c rune) bool {
+	switch {
+	case a == '-':
+		return isNameStart(b) || b == '-' || validEscape(b, c)
+	case isNameStart(a):
+		return true
+	case a == '\\':
+		return validEscape(a, b)
+	}
+	return false
+}
+
+func startsNumber(a, b, c rune) bool {
+	switch {
+	case a == '+' || a == '-':
+		return isDigit(b) || (b == '.' && isDigit(c))
+	case a == '.':
+		return isDigit(b)
+	}
+	return isDigit(a)
+}
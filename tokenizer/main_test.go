@@ -0,0 +1,72 @@
+package tokenizer
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		css    string
+		tokens []Token
+	}{
+		{"a{color:red}", []Token{
+			{Type: Ident, Value: "a"}, {Type: OpenCurly}, {Type: Ident, Value: "color"}, {Type: Colon},
+			{Type: Ident, Value: "red"}, {Type: CloseCurly},
+		}},
+		{"10px 50% -.5e2 +3", []Token{
+			{Type: Dimension, Value: "px", Number: 10}, {Type: Whitespace}, {Type: Percentage, Number: 50},
+			{Type: Whitespace}, {Type: Number, Number: -50}, {Type: Whitespace}, {Type: Number, Number: 3},
+		}},
+		{`#id .c @media`, []Token{
+			{Type: Hash, Value: "id"}, {Type: Whitespace}, {Type: Delim, Value: "."}, {Type: Ident, Value: "c"},
+			{Type: Whitespace}, {Type: AtKeyword, Value: "media"},
+		}},
+		{`"a\"b" 'bad` + "\n", []Token{
+			{Type: String, Value: `a"b`}, {Type: Whitespace}, {Type: BadString, Value: "bad"}, {Type: Whitespace},
+		}},
+		{`url(a.png) url( "b.png" ) url(a b)`, []Token{
+			{Type: URL, Value: "a.png"}, {Type: Whitespace}, {Type: Function, Value: "url"}, {Type: Whitespace},
+			{Type: String, Value: "b.png"}, {Type: Whitespace}, {Type: CloseParen}, {Type: Whitespace}, {Type: BadURL},
+		}},
+		{`\31 0 a/* comment */b`, []Token{
+			{Type: Ident, Value: "10"}, {Type: Whitespace}, {Type: Ident, Value: "a"}, {Type: Ident, Value: "b"},
+		}},
+		{"<!-- --> fn(1,2)", []Token{
+			{Type: CDO}, {Type: Whitespace}, {Type: CDC}, {Type: Whitespace}, {Type: Function, Value: "fn"},
+			{Type: Number, Number: 1}, {Type: Comma}, {Type: Number, Number: 2}, {Type: CloseParen},
+		}},
+	}
+	for _, test := range tests {
+		tokens := Tokenize(test.css)
+		if last := tokens[len(tokens)-1]; last.Type != EOF {
+			t.Errorf("Tokenize(%q) ends with %v, want EOF", test.css, last.Type)
+			continue
+		}
+		// Only the type, value and number are compared, Raw and the position have their own test
+		got := []Token{}
+		for _, v := range tokens[:len(tokens)-1] {
+			got = append(got, Token{Type: v.Type, Value: v.Value, Number: v.Number})
+		}
+		if !slices.Equal(got, test.tokens) {
+			t.Errorf("Tokenize(%q)\n got %v\nwant %v", test.css, got, test.tokens)
+		}
+	}
+}
+
+func TestTokenizePosition(t *testing.T) {
+	tokens := Tokenize("a {\n  color: red;\r\n}")
+	want := []struct {
+		raw          string
+		line, column int
+	}{
+		{"a", 1, 1}, {" ", 1, 2}, {"{", 1, 3}, {"\n  ", 1, 4}, {"color", 2, 3}, {":", 2, 8}, {" ", 2, 9},
+		{"red", 2, 10}, {";", 2, 13}, {"\n", 2, 14}, {"}", 3, 1},
+	}
+	for i, w := range want {
+		v := tokens[i]
+		if v.Raw != w.raw || v.Line != w.line || v.Column != w.column {
+			t.Errorf("token %d = %q at %d:%d, want %q at %d:%d", i, v.Raw, v.Line, v.Column, w.raw, w.line, w.column)
+		}
+	}
+}
@@ -5,7 +5,12 @@ import (
 	"fmt"
 	"gui/element"
 	ic "image/color"
+	"io/fs"
 	"math"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"strings"
@@ -35,130 +40,175 @@ type WidthHeight struct {
 	Height float32
 }
 
+// GetWH returns the size of the content and padding of n, the width and height in CSS are of the content box
+// + unless box-sizing is border-box then the padding and border are taken out of them
 func GetWH(n element.Node, state *map[string]element.State) WidthHeight {
 	s := *state
 	self := s[n.Properties.Id]
-	var parent element.State
 
 	if n.Style == nil {
 		n.Style = make(map[string]string)
 	}
 
 	fs := self.EM
+	cb := ContainingBlock(n, state)
 
-	var pwh WidthHeight
+	var p, m element.MarginPadding
 	if n.Parent != nil {
-		parent = s[n.Parent.Properties.Id]
-		// pwh = GetWH(*n.Parent, state)
-		pwh = WidthHeight{
-			Width:  parent.Width,
-			Height: parent.Height,
-		}
-	} else {
-		pwh = WidthHeight{}
-		if width, exists := n.Style["width"]; exists {
-			if f, err := strconv.ParseFloat(strings.TrimSuffix(width, "px"), 32); err == nil {
-				pwh.Width = float32(f)
-			}
-		}
-		if height, exists := n.Style["height"]; exists {
-			if f, err := strconv.ParseFloat(strings.TrimSuffix(height, "px"), 32); err == nil {
-				pwh.Height = float32(f)
-			}
-		}
+		p = sides(n, fs, cb.Width, "padding")
+		m = sides(n, fs, cb.Width, "margin")
 	}
 
-	wStyle := n.Style["width"]
-
-	if wStyle == "" && n.Style["display"] != "inline" {
-		wStyle = "100%"
+	// The space the padding and border take from a border-box size
+	var bw, bh float32
+	if n.Style["box-sizing"] == "border-box" {
+		bw = p.Left + p.Right + self.Border.Left.Width + self.Border.Right.Width
+		bh = p.Top + p.Bottom + self.Border.Top.Width + self.Border.Bottom.Width
 	}
 
-	width := ConvertToPixels(wStyle, fs, pwh.Width)
-	height := ConvertToPixels(n.Style["height"], fs, pwh.Height)
-
-	if minWidth, exists := n.Style["min-width"]; exists {
-		width = Max(width, ConvertToPixels(minWidth, fs, pwh.Width))
+	wStyle := n.Style["width"]
+	if wStyle == "auto" {
+		wStyle = ""
 	}
-	if maxWidth, exists := n.Style["max-width"]; exists {
-		width = Min(width, ConvertToPixels(maxWidth, fs, pwh.Width))
+	hStyle := n.Style["height"]
+	if hStyle == "auto" {
+		hStyle = ""
 	}
-	if minHeight, exists := n.Style["min-height"]; exists {
-		height = Max(height, ConvertToPixels(minHeight, fs, pwh.Height))
+
+	var width, height float32
+	if wStyle != "" {
+		width = ConvertToPixels(wStyle, fs, cb.Width) - bw
+	} else if n.Style["display"] != "inline" && n.TagName != "img" {
+		// Blocks fill the line, images keep their own size
+		width = cb.Width - m.Left - m.Right - self.Border.Left.Width - self.Border.Right.Width - p.Left - p.Right
 	}
-	if maxHeight, exists := n.Style["max-height"]; exists {
-		height = Min(height, ConvertToPixels(maxHeight, fs, pwh.Height))
+	if hStyle != "" {
+		height = ConvertToPixels(hStyle, fs, cb.Height) - bh
 	}
 
-	wh := WidthHeight{
-		Width:  width,
-		Height: height,
+	if n.TagName == "img" {
+		width, height = imageSize(n, width, height)
 	}
 
-	if n.Parent != nil {
-		wh.Width += self.Padding.Left + self.Padding.Right
-		wh.Height += self.Padding.Top + self.Padding.Bottom
+	// The min sizes are applied last so they win over the max sizes
+	if maxWidth, exists := n.Style["max-width"]; exists && maxWidth != "" && maxWidth != "none" {
+		width = Min(width, ConvertToPixels(maxWidth, fs, cb.Width)-bw)
 	}
-
-	if wStyle == "100%" {
-		wh.Width -= (self.Margin.Right + self.Margin.Left + self.Border.Left.Width + self.Border.Right.Width + parent.Padding.Left + parent.Padding.Right + self.Padding.Left + self.Padding.Right)
+	if minWidth, exists := n.Style["min-width"]; exists && minWidth != "" {
+		width = Max(width, ConvertToPixels(minWidth, fs, cb.Width)-bw)
+	}
+	if maxHeight, exists := n.Style["max-height"]; exists && maxHeight != "" && maxHeight != "none" {
+		height = Min(height, ConvertToPixels(maxHeight, fs, cb.Height)-bh)
+	}
+	if minHeight, exists := n.Style["min-height"]; exists && minHeight != "" {
+		height = Max(height, ConvertToPixels(minHeight, fs, cb.Height)-bh)
 	}
 
-	if n.Style["height"] == "100%" {
-		if n.Style["position"] == "absolute" {
-			wh.Height -= (self.Margin.Top + self.Margin.Bottom)
-		} else {
-			wh.Height -= (self.Margin.Top + self.Margin.Bottom + parent.Padding.Top + parent.Padding.Bottom)
-		}
+	return WidthHeight{
+		Width:  Max(width, 0) + p.Left + p.Right,
+		Height: Max(height, 0) + p.Top + p.Bottom,
 	}
+}
 
-	return wh
+// MinHeight raises height (the content and padding of n like GetWH returns) to the min-height of n, for plugins
+// + that set the height of n from its children
+func MinHeight(n *element.Node, height float32, state *map[string]element.State) float32 {
+	value := n.Style["min-height"]
+	if value == "" {
+		return height
+	}
+	self := (*state)[n.Properties.Id]
+	minHeight := ConvertToPixels(value, self.EM, ContainingBlock(*n, state).Height)
+	if n.Style["box-sizing"] == "border-box" {
+		minHeight -= self.Border.Top.Width + self.Border.Bottom.Width
+	} else {
+		minHeight += self.Padding.Top + self.Padding.Bottom
+	}
+	return Max(height, minHeight)
 }
 
-func GetMP(n element.Node, wh WidthHeight, state *map[string]element.State, t string) element.MarginPadding {
+// ContainingBlock returns the size percentages of n are resolved against, the content box of the parent for
+// + elements in the flow, the padding box of the positioned ancestor for absolute and the root for fixed ones
+func ContainingBlock(n element.Node, state *map[string]element.State) WidthHeight {
 	s := *state
-	self := s[n.Properties.Id]
-	fs := self.EM
-	m := element.MarginPadding{}
-
-	// Cache style properties
-	style := n.Style
-	leftKey, rightKey, topKey, bottomKey := t+"-left", t+"-right", t+"-top", t+"-bottom"
-
-	leftStyle := style[leftKey]
-	rightStyle := style[rightKey]
-	topStyle := style[topKey]
-	bottomStyle := style[bottomKey]
-
-	if style[t] != "" {
-		left, right, top, bottom := convertMarginToIndividualProperties(style[t])
-		if leftStyle == "" {
-			leftStyle = left
-		}
-		if rightStyle == "" {
-			rightStyle = right
+	if n.Parent == nil {
+		wh := WidthHeight{}
+		if f, err := strconv.ParseFloat(strings.TrimSuffix(n.Style["width"], "px"), 32); err == nil {
+			wh.Width = float32(f)
 		}
-		if topStyle == "" {
-			topStyle = top
+		if f, err := strconv.ParseFloat(strings.TrimSuffix(n.Style["height"], "px"), 32); err == nil {
+			wh.Height = float32(f)
 		}
-		if bottomStyle == "" {
-			bottomStyle = bottom
+		return wh
+	}
+
+	switch n.Style["position"] {
+	case "absolute":
+		base := s[GetPositionOffsetNode(n.Parent).Properties.Id]
+		return WidthHeight{Width: base.Width, Height: base.Height}
+	case "fixed":
+		r := n.Parent
+		for r.Parent != nil {
+			r = r.Parent
 		}
+		base := s[r.Properties.Id]
+		return WidthHeight{Width: base.Width, Height: base.Height}
+	}
+
+	parent := s[n.Parent.Properties.Id]
+	return WidthHeight{
+		Width:  parent.Width - parent.Padding.Left - parent.Padding.Right,
+		Height: parent.Height - parent.Padding.Top - parent.Padding.Bottom,
 	}
+}
 
-	// Convert left and right properties
-	if leftStyle != "" || rightStyle != "" {
-		m.Left = ConvertToPixels(leftStyle, fs, wh.Width)
-		m.Right = ConvertToPixels(rightStyle, fs, wh.Width)
+// imageSize fills in the width and height of a <img> that aren't set in CSS from its width/height attributes
+// + or the size of the decoded image, keeping the aspect ratio when only one is set
+func imageSize(n element.Node, width, height float32) (float32, float32) {
+	var iw, ih float32
+	if n.Image != nil {
+		iw, ih = float32(n.Image.Bounds().Dx()), float32(n.Image.Bounds().Dy())
+	}
+	ratio := float32(0)
+	if iw > 0 && ih > 0 {
+		ratio = iw / ih
+	}
+	if v, err := strconv.ParseFloat(n.GetAttribute("width"), 32); err == nil {
+		iw = float32(v)
+	}
+	if v, err := strconv.ParseFloat(n.GetAttribute("height"), 32); err == nil {
+		ih = float32(v)
+	}
+	if ratio == 0 && iw > 0 && ih > 0 {
+		ratio = iw / ih
 	}
 
-	// Convert top and bottom properties
-	if topStyle != "" || bottomStyle != "" {
-		m.Top = ConvertToPixels(topStyle, fs, wh.Height)
-		m.Bottom = ConvertToPixels(bottomStyle, fs, wh.Height)
+	hasWidth, hasHeight := n.Style["width"] != "", n.Style["height"] != ""
+	switch {
+	case !hasWidth && !hasHeight:
+		if n.GetAttribute("width") != "" && n.GetAttribute("height") == "" && ratio > 0 {
+			ih = iw / ratio
+		} else if n.GetAttribute("height") != "" && n.GetAttribute("width") == "" && ratio > 0 {
+			iw = ih * ratio
+		}
+		return iw, ih
+	case !hasWidth && ratio > 0:
+		return height * ratio, height
+	case !hasHeight && ratio > 0:
+		return width, width / ratio
 	}
+	return width, height
+}
 
-	if t == "margin" {
+// GetMP returns the margin or padding (t) of n, percentages on all four sides are of the width of the containing block
+func GetMP(n element.Node, wh WidthHeight, state *map[string]element.State, t string) element.MarginPadding {
+	s := *state
+	self := s[n.Properties.Id]
+	cb := ContainingBlock(n, state)
+	m := sides(n, self.EM, cb.Width, t)
+
+	// The margins of floats don't collapse
+	if t == "margin" && !IsFloat(&n) {
 		siblingMargin := float32(0)
 		firstChild := false
 		// Margin Collapse
@@ -205,32 +255,77 @@ func GetMP(n element.Node, wh WidthHeight, state *map[string]element.State, t st
 			}
 		}
 
-		// Handle auto margins
-		if style["margin"] == "auto" && leftStyle == "" && rightStyle == "" {
-			// pwh := GetWH(*n.Parent, state)
-			parent := s[n.Parent.Properties.Id]
-			pwh := WidthHeight{
-				Width: parent.Width,
+		// Handle auto margins, the space left on the line goes to the auto sides
+		left, right, _, _ := sideStyles(n, t)
+		if left == "auto" || right == "auto" {
+			free := Max(cb.Width-wh.Width-self.Border.Left.Width-self.Border.Right.Width-m.Left-m.Right, 0)
+			if left == "auto" && right == "auto" {
+				m.Left = free / 2
+				m.Right = m.Left
+			} else if left == "auto" {
+				m.Left = free
+			} else {
+				m.Right = free
 			}
-			m.Left = Max((pwh.Width-wh.Width)/2, 0)
-			m.Right = m.Left
 		}
 	}
 
 	return m
 }
 
+// sideStyles returns the left, right, top and bottom values of t, the longhand properties are used over the shorthand
+func sideStyles(n element.Node, t string) (string, string, string, string) {
+	style := n.Style
+	left, right, top, bottom := style[t+"-left"], style[t+"-right"], style[t+"-top"], style[t+"-bottom"]
+
+	if style[t] != "" {
+		l, r, tp, b := convertMarginToIndividualProperties(style[t])
+		if left == "" {
+			left = l
+		}
+		if right == "" {
+			right = r
+		}
+		if top == "" {
+			top = tp
+		}
+		if bottom == "" {
+			bottom = b
+		}
+	}
+	return left, right, top, bottom
+}
+
+// sides converts the four sides of t to pixels, auto is 0 here and is filled in by GetMP
+func sides(n element.Node, em, width float32, t string) element.MarginPadding {
+	left, right, top, bottom := sideStyles(n, t)
+	px := func(v string) float32 {
+		if v == "" || v == "auto" {
+			return 0
+		}
+		return ConvertToPixels(v, em, width)
+	}
+	return element.MarginPadding{
+		Left:   px(left),
+		Right:  px(right),
+		Top:    px(top),
+		Bottom: px(bottom),
+	}
+}
+
+// convertMarginToIndividualProperties splits a margin or padding shorthand (top right bottom left) into its
+// + left, right, top and bottom values
 func convertMarginToIndividualProperties(margin string) (string, string, string, string) {
 	parts := strings.Fields(margin)
 	switch len(parts) {
 	case 1:
 		return parts[0], parts[0], parts[0], parts[0]
 	case 2:
-		return parts[0], parts[1], parts[0], parts[1]
+		return parts[1], parts[1], parts[0], parts[0]
 	case 3:
-		return parts[0], parts[1], parts[2], parts[1]
+		return parts[1], parts[1], parts[0], parts[2]
 	case 4:
-		return parts[0], parts[1], parts[2], parts[3]
+		return parts[3], parts[1], parts[0], parts[2]
 	}
 	return "0px", "0px", "0px", "0px"
 }
@@ -430,10 +525,49 @@ func GetInnerText(n *html.Node) string {
 	return result.String()
 }
 
+// ResolvePath joins href onto the directory of the file that linked it. URLs are returned as is, paths inside
+// + fsys are slash separated and absolute hrefs start at the root of fsys
+func ResolvePath(fsys fs.FS, dir, href string) string {
+	// Check if the file path has a scheme, indicating it's a URL
+	u, err := url.Parse(href)
+	if err == nil && u.Scheme != "" {
+		return href
+	}
+
+	if fsys != nil {
+		if strings.HasPrefix(href, "/") {
+			return path.Clean(strings.TrimPrefix(href, "/"))
+		}
+		return path.Join(dir, href)
+	}
+
+	if filepath.IsAbs(href) {
+		return href
+	}
+
+	// Join the root path and the file path to create an absolute path
+	absPath := filepath.Join(dir, href)
+
+	// If the absolute path is the same as the original path, return it
+	if absPath == href || filepath.IsAbs(absPath) {
+		return absPath
+	}
+
+	return "./" + absPath
+}
+
+// ReadFile reads name from fsys, or from the os file system if fsys is nil
+func ReadFile(fsys fs.FS, name string) ([]byte, error) {
+	if fsys == nil {
+		return os.ReadFile(name)
+	}
+	return fs.ReadFile(fsys, name)
+}
+
 func GetPositionOffsetNode(n *element.Node) *element.Node {
 	pos := n.Style["position"]
 
-	if pos == "relative" || pos == "absolute" {
+	if pos == "relative" || pos == "absolute" || pos == "fixed" || pos == "sticky" {
 		return n
 	} else {
 		if n.Parent.TagName != "ROOT" {
@@ -463,6 +597,144 @@ func IsParent(n element.Node, name string) bool {
 	}
 }
 
+// IsFloat reports if n is floated, float has no effect on absolute and fixed elements or on flex, grid and table items
+func IsFloat(n *element.Node) bool {
+	if f := n.Style["float"]; f != "left" && f != "right" {
+		return false
+	}
+	if pos := n.Style["position"]; pos == "absolute" || pos == "fixed" {
+		return false
+	}
+	if n.Parent != nil {
+		switch n.Parent.Style["display"] {
+		case "flex", "inline-flex", "grid", "inline-grid", "table", "inline-table", "table-row", "table-row-group", "table-header-group", "table-footer-group":
+			return false
+		}
+	}
+	return true
+}
+
+// IsBFC reports if n starts a new block formatting context, the floats inside of it don't reach the content outside
+// + of it and n grows to contain them
+func IsBFC(n *element.Node) bool {
+	if n.Parent == nil || n.Parent.TagName == "ROOT" || IsFloat(n) {
+		return true
+	}
+	for _, v := range []string{"overflow", "overflow-x", "overflow-y"} {
+		if o := n.Style[v]; o != "" && o != "visible" && o != "clip" {
+			return true
+		}
+	}
+	switch n.Style["display"] {
+	case "flow-root", "inline-block", "table-cell", "table-caption", "flex", "inline-flex", "grid", "inline-grid", "table", "inline-table":
+		return true
+	}
+	if pos := n.Style["position"]; pos == "absolute" || pos == "fixed" {
+		return true
+	}
+	switch n.Parent.Style["display"] {
+	case "flex", "inline-flex", "grid", "inline-grid":
+		return true
+	}
+	return false
+}
+
+// FormattingContext returns the node that starts the block formatting context n is in
+func FormattingContext(n *element.Node) *element.Node {
+	root := n.Parent
+	for root != nil && !IsBFC(root) {
+		root = root.Parent
+	}
+	return root
+}
+
+// GetFloats returns the floats in the block formatting context of n that come before n in the document. Nodes are
+// + laid out in document order so those are the floats AddFloat has added to the context so far
+func GetFloats(n *element.Node) []*element.Node {
+	if root := FormattingContext(n); root != nil {
+		return root.Properties.Floats
+	}
+	return nil
+}
+
+// AddFloat adds a float to its block formatting context once it has been placed
+func AddFloat(n *element.Node) {
+	if root := FormattingContext(n); root != nil {
+		root.Properties.Floats = append(root.Properties.Floats, n)
+	}
+}
+
+// Move shifts n and everything in it. Fixed elements are placed against the viewport so they (and what is in them)
+// + stay where they are
+func Move(n *element.Node, dx, dy float32, state *map[string]element.State) {
+	if dx == 0 && dy == 0 {
+		return
+	}
+	self := (*state)[n.Properties.Id]
+	self.X += dx
+	self.Y += dy
+	(*state)[n.Properties.Id] = self
+	MoveChildren(n, dx, dy, state)
+}
+
+// MoveChildren is Move for everything in n but not n itself, for when n has already been placed
+func MoveChildren(n *element.Node, dx, dy float32, state *map[string]element.State) {
+	if dx == 0 && dy == 0 {
+		return
+	}
+	for _, v := range n.Children {
+		if v.Style["position"] != "fixed" {
+			Move(v, dx, dy, state)
+		}
+	}
+}
+
+// FloatBox returns the margin box of a float
+func FloatBox(f element.State) (float32, float32, float32, float32) {
+	return f.X - f.Margin.Left,
+		f.Y - f.Margin.Top,
+		f.X + f.Width + f.Border.Left.Width + f.Border.Right.Width + f.Margin.Right,
+		f.Y + f.Height + f.Border.Top.Width + f.Border.Bottom.Width + f.Margin.Bottom
+}
+
+// FloatBottom returns the lowest bottom of the floats before n on the side (left, right or both) that n clears
+func FloatBottom(n *element.Node, state *map[string]element.State, side string) float32 {
+	if side != "left" && side != "right" && side != "both" {
+		return 0
+	}
+	s := *state
+	var bottom float32
+	for _, f := range GetFloats(n) {
+		if side == "both" || f.Style["float"] == side {
+			_, _, _, y2 := FloatBox(s[f.Properties.Id])
+			bottom = Max(bottom, y2)
+		}
+	}
+	return bottom
+}
+
+// FloatSpace narrows left and right to the space the floats leave free between y and y+h, next is the top of the
+// + first line below a float that is in the way (0 when no float is in the way)
+func FloatSpace(floats []*element.Node, state *map[string]element.State, y, h, left, right float32) (float32, float32, float32) {
+	s := *state
+	var next float32
+	for _, f := range floats {
+		x1, y1, x2, y2 := FloatBox(s[f.Properties.Id])
+		if y1 >= y+Max(h, 1) || y2 <= y || x2 <= x1 {
+			continue
+		}
+		if f.Style["float"] == "left" {
+			left = Max(left, x2)
+		} else {
+			right = Min(right, x1)
+		}
+		if next == 0 || y2 < next {
+			next = y2
+		}
+	}
+	return left, right, next
+}
+
 func ChildrenHaveText(n *element.Node) bool {
 	for _, child := range n.Children {
 		if len(strings.TrimSpace(child.InnerText)) != 0 {
@@ -477,9 +749,9 @@ func ChildrenHaveText(n *element.Node) bool {
 }
 
 func NodeToHTML(node *element.Node) (string, string) {
-	// if node.TagName == "notaspan" {
-	// 	return node.InnerText + " ", ""
-	// }
+	if node.TagName == "#text" {
+		return html.EscapeString(node.InnerText), ""
+	}
 
 	var buffer bytes.Buffer
 	buffer.WriteString("<" + node.TagName)
@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"gui/element"
+	"image"
+	"testing"
+)
+
+// box returns a div with style in a 400x300 parent with 10px of padding, the containing block of the div is
+// + 380x280. The div comes after a sibling so its top margin doesn't go to the parent
+func box(style map[string]string, border float32) (element.Node, *map[string]element.State) {
+	root := &element.Node{TagName: "ROOT", Style: map[string]string{}}
+	parent := root.CreateElement("div")
+	sibling := root.CreateElement("div")
+	n := root.CreateElement("div")
+	root.AppendChild(&parent)
+	parent.AppendChild(&sibling)
+	parent.AppendChild(&n)
+	n.Style = style
+
+	side := element.BorderSide{Width: border}
+	state := map[string]element.State{
+		parent.Properties.Id: {Width: 400, Height: 300, Padding: element.MarginPadding{Left: 10, Right: 10, Top: 10, Bottom: 10}},
+		n.Properties.Id:      {EM: 16, Border: element.Border{Left: side, Right: side, Top: side, Bottom: side}},
+	}
+	return *parent.Children[1], &state
+}
+
+func TestGetWH(t *testing.T) {
+	tests := []struct {
+		name   string
+		style  map[string]string
+		border float32
+		want   WidthHeight
+	}{
+		{"content-box", map[string]string{"width": "200px", "height": "50px", "padding": "10px"}, 5, WidthHeight{220, 70}},
+		{"border-box", map[string]string{"width": "200px", "height": "50px", "padding": "10px", "box-sizing": "border-box"}, 5, WidthHeight{190, 40}},
+		{"auto width", map[string]string{"margin": "10px", "padding": "5px"}, 2, WidthHeight{356, 10}},
+		{"auto width with border-box", map[string]string{"margin": "10px", "padding": "5px", "box-sizing": "border-box"}, 2, WidthHeight{356, 10}},
+		{"percentage width", map[string]string{"width": "50%", "height": "50%"}, 0, WidthHeight{190, 140}},
+		{"min-width", map[string]string{"width": "100px", "min-width": "250px", "padding": "5px"}, 0, WidthHeight{260, 10}},
+		{"max-width", map[string]string{"width": "300px", "max-width": "50%"}, 0, WidthHeight{190, 0}},
+		{"max-width with border-box", map[string]string{"width": "300px", "max-width": "150px", "padding": "10px", "box-sizing": "border-box"}, 0, WidthHeight{150, 20}},
+		{"min-height", map[string]string{"width": "10px", "min-height": "10%"}, 0, WidthHeight{10, 28}},
+		{"max-height", map[string]string{"width": "10px", "height": "200px", "max-height": "100px"}, 0, WidthHeight{10, 100}},
+		{"min-width over max-width", map[string]string{"width": "10px", "min-width": "80px", "max-width": "40px"}, 0, WidthHeight{80, 0}},
+		{"percentage padding", map[string]string{"width": "100px", "padding": "10%"}, 0, WidthHeight{176, 76}},
+	}
+	for _, test := range tests {
+		n, state := box(test.style, test.border)
+		if got := GetWH(n, state); got != test.want {
+			t.Errorf("%s: GetWH = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+// TestGetMP checks that percentages on all four sides of the margin and padding are of the width of the
+// + containing block
+func TestGetMP(t *testing.T) {
+	tests := []struct {
+		name  string
+		style map[string]string
+		t     string
+		want  element.MarginPadding
+	}{
+		{"padding", map[string]string{"padding": "10%"}, "padding", element.MarginPadding{Left: 38, Right: 38, Top: 38, Bottom: 38}},
+		{"padding sides", map[string]string{"padding": "5px 10%", "padding-top": "5%"}, "padding", element.MarginPadding{Left: 38, Right: 38, Top: 19, Bottom: 5}},
+		{"margin", map[string]string{"width": "100px", "margin": "5%"}, "margin", element.MarginPadding{Left: 19, Right: 19, Top: 19, Bottom: 19}},
+		{"auto margin", map[string]string{"width": "100px", "margin": "0 auto"}, "margin", element.MarginPadding{Left: 140, Right: 140}},
+	}
+	for _, test := range tests {
+		n, state := box(test.style, 0)
+		if got := GetMP(n, GetWH(n, state), state, test.t); got != test.want {
+			t.Errorf("%s: GetMP = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+// TestImageSize checks the size of a <img> with a 40x20 image from its attributes and styles
+func TestImageSize(t *testing.T) {
+	tests := []struct {
+		name  string
+		image bool
+		attrs map[string]string
+		style map[string]string
+		want  WidthHeight
+	}{
+		{"intrinsic", true, nil, nil, WidthHeight{40, 20}},
+		{"width attribute", true, map[string]string{"width": "80"}, nil, WidthHeight{80, 40}},
+		{"height attribute", true, map[string]string{"height": "10"}, nil, WidthHeight{20, 10}},
+		{"both attributes", true, map[string]string{"width": "10", "height": "30"}, nil, WidthHeight{10, 30}},
+		{"css width", true, map[string]string{"width": "10"}, map[string]string{"width": "100px"}, WidthHeight{100, 50}},
+		{"css height", true, nil, map[string]string{"height": "40px"}, WidthHeight{80, 40}},
+		{"css width and height", true, nil, map[string]string{"width": "10px", "height": "50%"}, WidthHeight{10, 140}},
+		{"percentage width", true, nil, map[string]string{"width": "50%"}, WidthHeight{190, 95}},
+		{"not loaded", false, map[string]string{"width": "30", "height": "15"}, nil, WidthHeight{30, 15}},
+	}
+	for _, test := range tests {
+		style := map[string]string{"display": "inline"}
+		for k, v := range test.style {
+			style[k] = v
+		}
+		n, state := box(style, 0)
+		n.TagName = "img"
+		if test.image {
+			n.Image = image.NewRGBA(image.Rect(0, 0, 40, 20))
+		}
+		for k, v := range test.attrs {
+			n.SetAttribute(k, v)
+		}
+		if got := GetWH(n, state); got != test.want {
+			t.Errorf("%s: GetWH = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package watch
+
+import (
+	"io/fs"
+	"os"
+	"time"
+)
+
+// Files polls the modification times of a list of files, there are no OS notifications so it works on every platform
+type Files struct {
+	// FS is where the files are stat'ed from, nil uses the os file system
+	FS    fs.FS
+	times map[string]time.Time
+}
+
+// Set replaces the watched files and records their current modification times
+func (f *Files) Set(paths []string) {
+	f.times = map[string]time.Time{}
+	for _, v := range paths {
+		f.times[v], _ = f.modTime(v)
+	}
+}
+
+// Changed returns the files modified since the last call to Set or Changed. A file that can't be stat'ed (editors
+// + that save by replacing the file remove it for a moment) is skipped until it is back
+func (f *Files) Changed() []string {
+	changed := []string{}
+	for path, last := range f.times {
+		t, err := f.modTime(path)
+		if err != nil {
+			continue
+		}
+		if !t.Equal(last) {
+			f.times[path] = t
+			changed = append(changed, path)
+		}
+	}
+	return changed
+}
+
+func (f *Files) modTime(path string) (time.Time, error) {
+	var info fs.FileInfo
+	var err error
+	if f.FS == nil {
+		info, err = os.Stat(path)
+	} else {
+		info, err = fs.Stat(f.FS, path)
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}